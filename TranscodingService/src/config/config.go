@@ -0,0 +1,458 @@
+package config
+
+import (
+	"TranscodingService/src/domain"
+	"TranscodingService/src/storage"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config mirrors the layout of config.yaml
+type Config struct {
+	Server      ServerConfig      `yaml:"server"`
+	Transcoding TranscodingConfig `yaml:"transcoding"`
+	Storage     StorageConfig     `yaml:"storage"`
+	Database    DatabaseConfig    `yaml:"database"`
+	Queue       QueueConfig       `yaml:"queue"`
+	RetryPolicy RetryPolicyConfig `yaml:"retry_policy"`
+}
+
+// ServerConfig holds the HTTP listener settings
+type ServerConfig struct {
+	Port int    `yaml:"port"`
+	Host string `yaml:"host"`
+}
+
+// TranscodingConfig holds the encoding and worker pool settings
+type TranscodingConfig struct {
+	// Formats lists the video codecs jobs may use
+	Formats           []string `yaml:"formats"`
+	Resolutions       []string `yaml:"resolutions"`
+	MaxConcurrentJobs int      `yaml:"max_concurrent_jobs"`
+	QueueSize         int      `yaml:"queue_size"`
+	// PriorityAgingSeconds is how long a job waits to gain one priority level
+	PriorityAgingSeconds int `yaml:"priority_aging_seconds"`
+	// InputRoots and OutputRoots are the directories jobs may read from and write to
+	InputRoots   []string           `yaml:"input_roots"`
+	OutputRoots  []string           `yaml:"output_roots"`
+	BitrateRange BitrateRangeConfig `yaml:"bitrate_range"`
+	Audio        AudioConfig        `yaml:"audio"`
+	// Profiles are named encoder settings jobs can select, keyed by name
+	Profiles  map[string]ProfileConfig `yaml:"profiles"`
+	Trickplay TrickplayConfig          `yaml:"trickplay"`
+	Posters   PosterConfig             `yaml:"posters"`
+	Subtitles SubtitleConfig           `yaml:"subtitles"`
+	Chunking  ChunkingConfig           `yaml:"chunking"`
+	TwoPass   TwoPassConfig            `yaml:"two_pass"`
+	Workers   WorkerConfig             `yaml:"workers"`
+}
+
+// WorkerConfig selects where jobs run
+type WorkerConfig struct {
+	// Mode is local to run jobs where they were accepted, or distributed to let any registered worker claim them
+	Mode             string `yaml:"mode"`
+	LeaseSeconds     int    `yaml:"lease_seconds"`     // 60 when unset
+	HeartbeatSeconds int    `yaml:"heartbeat_seconds"` // 15 when unset
+	PollSeconds      int    `yaml:"poll_seconds"`      // 5 when unset
+}
+
+// Distributed reports whether jobs are claimed from the database by worker processes
+func (w WorkerConfig) Distributed() bool {
+	return w.Mode == "distributed"
+}
+
+// Options returns the lease settings, falling back to defaults for unset fields
+func (w WorkerConfig) Options() domain.LeaseOptions {
+	options := domain.LeaseOptions{
+		Lease:     time.Duration(w.LeaseSeconds) * time.Second,
+		Heartbeat: time.Duration(w.HeartbeatSeconds) * time.Second,
+		Poll:      time.Duration(w.PollSeconds) * time.Second,
+	}
+	if options.Lease == 0 {
+		options.Lease = 60 * time.Second
+	}
+	if options.Heartbeat == 0 {
+		options.Heartbeat = 15 * time.Second
+	}
+	if options.Poll == 0 {
+		options.Poll = 5 * time.Second
+	}
+	return options
+}
+
+// TwoPassConfig holds the constraints of two-pass encodes, relative to the average bitrate they target
+type TwoPassConfig struct {
+	MaxRateFactor float64 `yaml:"max_rate_factor"` // peak bitrate, 1.5 when unset
+	BufferFactor  float64 `yaml:"buffer_factor"`   // decoder buffer size, 2 when unset
+}
+
+// Options returns the two-pass constraints, falling back to defaults for unset fields
+func (t TwoPassConfig) Options() domain.TwoPassOptions {
+	options := domain.TwoPassOptions{MaxRateFactor: t.MaxRateFactor, BufferFactor: t.BufferFactor}
+	if options.MaxRateFactor == 0 {
+		options.MaxRateFactor = 1.5
+	}
+	if options.BufferFactor == 0 {
+		options.BufferFactor = 2
+	}
+	return options
+}
+
+// ChunkingConfig holds the settings for splitting long inputs across the worker pool
+type ChunkingConfig struct {
+	// MinDurationSeconds is the input length from which progressive outputs are encoded in chunks, 0 for always
+	MinDurationSeconds int `yaml:"min_duration_seconds"`
+	ChunkSeconds       int `yaml:"chunk_seconds"` // 120 when unset
+	MaxAttempts        int `yaml:"max_attempts"`  // per chunk, 3 when unset
+}
+
+// Options returns the chunking settings, falling back to defaults for unset fields
+func (c ChunkingConfig) Options() domain.ChunkOptions {
+	options := domain.ChunkOptions{
+		MinDuration: time.Duration(c.MinDurationSeconds) * time.Second,
+		Length:      time.Duration(c.ChunkSeconds) * time.Second,
+		Attempts:    c.MaxAttempts,
+	}
+	if options.Length == 0 {
+		options.Length = 120 * time.Second
+	}
+	if options.Attempts == 0 {
+		options.Attempts = 3
+	}
+	return options
+}
+
+// SubtitleConfig holds the subtitle conversion settings
+type SubtitleConfig struct {
+	// FallbackCharset is the encoding assumed for sidecars that are not UTF-8, CP1252 when unset
+	FallbackCharset string `yaml:"fallback_charset"`
+}
+
+// Charset returns the fallback encoding for legacy sidecars
+func (s SubtitleConfig) Charset() string {
+	if s.FallbackCharset == "" {
+		return "CP1252"
+	}
+	return s.FallbackCharset
+}
+
+// TrickplayConfig holds the defaults for scrub-bar thumbnail jobs
+type TrickplayConfig struct {
+	IntervalSeconds float64 `yaml:"interval_seconds"`
+	Columns         int     `yaml:"columns"`
+	Rows            int     `yaml:"rows"`
+	Width           int     `yaml:"width"`
+}
+
+// Options returns the defaults, falling back to a 5x5 grid of 160 pixel wide thumbnails every 10 seconds
+func (t TrickplayConfig) Options() domain.TrickplayOptions {
+	return domain.TrickplayOptions{
+		IntervalSeconds: t.IntervalSeconds,
+		Columns:         t.Columns,
+		Rows:            t.Rows,
+		Width:           t.Width,
+	}.WithDefaults(domain.TrickplayOptions{IntervalSeconds: 10, Columns: 5, Rows: 5, Width: 160})
+}
+
+// PosterConfig holds the defaults for poster frame jobs
+type PosterConfig struct {
+	Candidates      int     `yaml:"candidates"`
+	Widths          []int   `yaml:"widths"`
+	IntervalSeconds float64 `yaml:"interval_seconds"`
+}
+
+// Options returns the defaults, falling back to five candidates 5 seconds apart at 1280, 640 and 320 pixels wide
+func (p PosterConfig) Options() domain.PosterOptions {
+	return domain.PosterOptions{
+		Candidates:      p.Candidates,
+		Widths:          p.Widths,
+		IntervalSeconds: p.IntervalSeconds,
+	}.WithDefaults(domain.PosterOptions{Candidates: 5, Widths: []int{1280, 640, 320}, IntervalSeconds: 5})
+}
+
+// ProfileConfig describes a named encoding profile
+type ProfileConfig struct {
+	VideoCodec  string             `yaml:"video_codec"`
+	CRF         int                `yaml:"crf"`
+	Bitrate     string             `yaml:"bitrate"`
+	Preset      string             `yaml:"preset"`
+	GOPSize     int                `yaml:"gop_size"`
+	PixelFormat string             `yaml:"pixel_format"`
+	Audio       ProfileAudioConfig `yaml:"audio"`
+}
+
+// ProfileAudioConfig holds the audio settings of an encoding profile
+type ProfileAudioConfig struct {
+	Codec      string `yaml:"codec"`
+	Bitrate    string `yaml:"bitrate"`
+	Channels   int    `yaml:"channels"`
+	SampleRate int    `yaml:"sample_rate"`
+}
+
+// EncodingProfiles converts and validates the configured profiles
+func (t TranscodingConfig) EncodingProfiles() (map[string]domain.EncodingProfile, error) {
+	profiles := make(map[string]domain.EncodingProfile, len(t.Profiles))
+	for name, p := range t.Profiles {
+		profile := domain.EncodingProfile{
+			Name:            name,
+			VideoCodec:      domain.VideoCodec(p.VideoCodec),
+			CRF:             p.CRF,
+			Bitrate:         p.Bitrate,
+			Preset:          p.Preset,
+			GOPSize:         p.GOPSize,
+			PixelFormat:     p.PixelFormat,
+			AudioCodec:      domain.AudioCodec(p.Audio.Codec),
+			AudioBitrate:    p.Audio.Bitrate,
+			AudioChannels:   p.Audio.Channels,
+			AudioSampleRate: p.Audio.SampleRate,
+		}
+		if err := profile.Validate(); err != nil {
+			return nil, err
+		}
+		profiles[name] = profile
+	}
+	return profiles, nil
+}
+
+// AudioConfig holds the audio encoding settings
+type AudioConfig struct {
+	Codecs []string `yaml:"codecs"`
+	// Channels and SampleRate are what tracks are downmixed and resampled to without a profile; zero keeps the source's
+	Channels   int            `yaml:"channels"`
+	SampleRate int            `yaml:"sample_rate"`
+	Loudness   LoudnessConfig `yaml:"loudness"`
+}
+
+// LoudnessConfig holds the EBU R128 normalization settings
+type LoudnessConfig struct {
+	// Enabled normalizes every job's audio unless the job opts out
+	Enabled    bool    `yaml:"enabled"`
+	Integrated float64 `yaml:"integrated"` // -23 LUFS when unset
+	TruePeak   float64 `yaml:"true_peak"`  // -1 dBTP when unset
+	Range      float64 `yaml:"range"`      // 7 LU when unset
+}
+
+// Target returns the normalization target, falling back to the EBU R128 defaults
+func (l LoudnessConfig) Target() domain.LoudnessTarget {
+	target := domain.LoudnessTarget{Integrated: l.Integrated, TruePeak: l.TruePeak, Range: l.Range}
+	if target.Integrated == 0 {
+		target.Integrated = -23
+	}
+	if target.TruePeak == 0 {
+		target.TruePeak = -1
+	}
+	if target.Range == 0 {
+		target.Range = 7
+	}
+	return target
+}
+
+// BitrateRangeConfig bounds the video bitrates of a ladder, e.g. 1000k to 8000k
+type BitrateRangeConfig struct {
+	Min string `yaml:"min"`
+	Max string `yaml:"max"`
+}
+
+// Range parses the configured bounds
+func (b BitrateRangeConfig) Range() (domain.BitrateRange, error) {
+	min, err := domain.ParseBitrate(b.Min)
+	if err != nil {
+		return domain.BitrateRange{}, fmt.Errorf("bitrate_range.min: %v", err)
+	}
+	max, err := domain.ParseBitrate(b.Max)
+	if err != nil {
+		return domain.BitrateRange{}, fmt.Errorf("bitrate_range.max: %v", err)
+	}
+	bitrates := domain.BitrateRange{MinKbps: min, MaxKbps: max}
+	return bitrates, bitrates.Validate()
+}
+
+// PriorityAgingInterval returns the aging interval as a duration
+func (t TranscodingConfig) PriorityAgingInterval() time.Duration {
+	return time.Duration(t.PriorityAgingSeconds) * time.Second
+}
+
+// StorageConfig selects the storage jobs may address by URI besides local paths
+type StorageConfig struct {
+	// Type is local to accept file URIs only, or s3 to also accept s3 URIs in the configured bucket
+	Type string   `yaml:"type"`
+	S3   S3Config `yaml:"s3"`
+	// Workspace is where jobs addressed by URI stage their files, a directory under the system temp dir when unset
+	Workspace string `yaml:"workspace"`
+}
+
+// S3Enabled reports whether jobs may address objects in the configured bucket
+func (s StorageConfig) S3Enabled() bool {
+	return s.Type == "s3"
+}
+
+// WorkspaceDir returns the staging directory, falling back to the default
+func (s StorageConfig) WorkspaceDir() string {
+	if s.Workspace == "" {
+		return filepath.Join(os.TempDir(), "transcoding")
+	}
+	return s.Workspace
+}
+
+// S3Config holds the S3-compatible service settings
+type S3Config struct {
+	BucketName      string `yaml:"bucket_name"`
+	Region          string `yaml:"region"`
+	AccessKeyID     string `yaml:"access_key_id"`
+	SecretAccessKey string `yaml:"secret_access_key"`
+	Endpoint        string `yaml:"endpoint"`
+	// PathStyle puts the bucket in the request path, as MinIO and most self-hosted services expect
+	PathStyle bool `yaml:"path_style"`
+}
+
+// Options returns the connection settings of the service
+func (s S3Config) Options() storage.S3Options {
+	return storage.S3Options{
+		Endpoint:        s.Endpoint,
+		Region:          s.Region,
+		AccessKeyID:     s.AccessKeyID,
+		SecretAccessKey: s.SecretAccessKey,
+		PathStyle:       s.PathStyle,
+	}
+}
+
+// DatabaseConfig holds the job store connection settings
+type DatabaseConfig struct {
+	Type  string      `yaml:"type"`
+	MySQL MySQLConfig `yaml:"mysql"`
+}
+
+// MySQLConfig holds the MySQL connection settings
+type MySQLConfig struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	DBName   string `yaml:"dbname"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+}
+
+// QueueConfig selects the backend that carries queued jobs to the worker pool
+type QueueConfig struct {
+	// Type is memory to keep queued jobs in the process, or rabbitmq to share them through a broker
+	Type     string         `yaml:"type"`
+	RabbitMQ RabbitMQConfig `yaml:"rabbitmq"`
+}
+
+// Brokered reports whether queued jobs travel through RabbitMQ
+func (q QueueConfig) Brokered() bool {
+	return q.Type == "rabbitmq"
+}
+
+// RabbitMQConfig holds the broker connection and consumer settings
+type RabbitMQConfig struct {
+	URL       string `yaml:"url"`
+	QueueName string `yaml:"queue_name"`
+	// PrefetchCount is how many unacknowledged jobs the broker hands a process, max_concurrent_jobs when unset
+	PrefetchCount int `yaml:"prefetch_count"`
+}
+
+// RetryPolicyConfig bounds how often an interrupted job is run again
+type RetryPolicyConfig struct {
+	MaxRetries   int `yaml:"max_retries"`   // runs after the first, so a job runs at most MaxRetries+1 times
+	DelaySeconds int `yaml:"delay_seconds"` // wait before a job marked for retry runs again
+}
+
+// Delay returns how long a job marked for retry waits before it runs again
+func (r RetryPolicyConfig) Delay() time.Duration {
+	return time.Duration(r.DelaySeconds) * time.Second
+}
+
+// Load reads and parses the configuration file at path
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read config file: %v", err)
+	}
+
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("could not parse config file: %v", err)
+	}
+
+	if cfg.Transcoding.MaxConcurrentJobs <= 0 {
+		cfg.Transcoding.MaxConcurrentJobs = runtime.NumCPU()
+	}
+	if cfg.Transcoding.QueueSize <= 0 {
+		cfg.Transcoding.QueueSize = 100
+	}
+	if cfg.Queue.RabbitMQ.PrefetchCount <= 0 {
+		cfg.Queue.RabbitMQ.PrefetchCount = cfg.Transcoding.MaxConcurrentJobs
+	}
+	if _, err := cfg.Transcoding.BitrateRange.Range(); err != nil {
+		return nil, fmt.Errorf("invalid transcoding config: %v", err)
+	}
+	if _, err := cfg.Transcoding.EncodingProfiles(); err != nil {
+		return nil, fmt.Errorf("invalid transcoding config: %v", err)
+	}
+	if err := cfg.Transcoding.Trickplay.Options().Validate(); err != nil {
+		return nil, fmt.Errorf("invalid transcoding config: %v", err)
+	}
+	if err := cfg.Transcoding.Posters.Options().Validate(); err != nil {
+		return nil, fmt.Errorf("invalid transcoding config: %v", err)
+	}
+	if err := cfg.Transcoding.Audio.Loudness.Target().Validate(); err != nil {
+		return nil, fmt.Errorf("invalid transcoding config: %v", err)
+	}
+	if err := cfg.Transcoding.Chunking.Options().Validate(); err != nil {
+		return nil, fmt.Errorf("invalid transcoding config: %v", err)
+	}
+	if err := cfg.Transcoding.TwoPass.Options().Validate(); err != nil {
+		return nil, fmt.Errorf("invalid transcoding config: %v", err)
+	}
+	if cfg.RetryPolicy.MaxRetries < 0 || cfg.RetryPolicy.DelaySeconds < 0 {
+		return nil, fmt.Errorf("invalid retry policy: max_retries and delay_seconds cannot be negative")
+	}
+	switch cfg.Transcoding.Workers.Mode {
+	case "", "local":
+	case "distributed":
+		if err := cfg.Transcoding.Workers.Options().Validate(); err != nil {
+			return nil, fmt.Errorf("invalid transcoding config: %v", err)
+		}
+	default:
+		return nil, fmt.Errorf("invalid transcoding config: unknown worker mode %q", cfg.Transcoding.Workers.Mode)
+	}
+	switch cfg.Storage.Type {
+	case "", "local":
+	case "s3":
+		if cfg.Storage.S3.BucketName == "" {
+			return nil, fmt.Errorf("invalid storage config: s3 needs a bucket_name")
+		}
+		if endpoint, err := url.Parse(cfg.Storage.S3.Endpoint); err != nil || endpoint.Host == "" {
+			return nil, fmt.Errorf("invalid storage config: s3 endpoint %q is not a URL", cfg.Storage.S3.Endpoint)
+		}
+	default:
+		return nil, fmt.Errorf("invalid storage config: unknown storage type %q", cfg.Storage.Type)
+	}
+	switch cfg.Queue.Type {
+	case "", "memory":
+	case "rabbitmq":
+		if cfg.Queue.RabbitMQ.URL == "" || cfg.Queue.RabbitMQ.QueueName == "" {
+			return nil, fmt.Errorf("invalid queue config: rabbitmq needs a url and a queue_name")
+		}
+		// Instances sharing the broker lease the jobs they run like worker processes
+		if err := cfg.Transcoding.Workers.Options().Validate(); err != nil {
+			return nil, fmt.Errorf("invalid transcoding config: %v", err)
+		}
+	default:
+		return nil, fmt.Errorf("invalid queue config: unknown queue type %q", cfg.Queue.Type)
+	}
+
+	return &cfg, nil
+}
+
+// DataSourceName builds the driver DSN for the configured database
+func (d DatabaseConfig) DataSourceName() string {
+	m := d.MySQL
+	return fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?parseTime=true", m.User, m.Password, m.Host, m.Port, m.DBName)
+}
@@ -2,8 +2,11 @@ package controllers
 
 import (
 	"TranscodingService/src/domain"
+	"TranscodingService/src/repositories"
 	"TranscodingService/src/services"
+	"TranscodingService/src/storage"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"strconv"
@@ -35,7 +38,7 @@ func (c *TranscodingController) TranscodeVideo(w http.ResponseWriter, r *http.Re
 	result, err := c.TranscodingService.Transcode(transcodingRequest)
 	if err != nil {
 		log.Printf("Error during transcoding: %v", err)
-		http.Error(w, "Transcoding failed", http.StatusInternalServerError)
+		http.Error(w, "Transcoding failed", errorStatus(err))
 		return
 	}
 
@@ -51,7 +54,7 @@ func (c *TranscodingController) GetTranscodingStatus(w http.ResponseWriter, r *h
 	status, err := c.TranscodingService.GetStatus(jobID)
 	if err != nil {
 		log.Printf("Error fetching transcoding status: %v", err)
-		http.Error(w, "Unable to fetch status", http.StatusInternalServerError)
+		http.Error(w, "Unable to fetch status", errorStatus(err))
 		return
 	}
 
@@ -80,7 +83,7 @@ func (c *TranscodingController) CancelTranscodingJob(w http.ResponseWriter, r *h
 	err := c.TranscodingService.CancelJob(jobID)
 	if err != nil {
 		log.Printf("Error canceling transcoding job: %v", err)
-		http.Error(w, "Failed to cancel transcoding job", http.StatusInternalServerError)
+		http.Error(w, "Failed to cancel transcoding job", errorStatus(err))
 		return
 	}
 
@@ -95,7 +98,7 @@ func (c *TranscodingController) GetJobLogs(w http.ResponseWriter, r *http.Reques
 	logs, err := c.TranscodingService.GetJobLogs(jobID)
 	if err != nil {
 		log.Printf("Error fetching logs for job: %v", err)
-		http.Error(w, "Unable to fetch logs", http.StatusInternalServerError)
+		http.Error(w, "Unable to fetch logs", errorStatus(err))
 		return
 	}
 
@@ -111,7 +114,7 @@ func (c *TranscodingController) ResubmitFailedJob(w http.ResponseWriter, r *http
 	err := c.TranscodingService.ResubmitJob(jobID)
 	if err != nil {
 		log.Printf("Error resubmitting job: %v", err)
-		http.Error(w, "Failed to resubmit job", http.StatusInternalServerError)
+		http.Error(w, "Failed to resubmit job", errorStatus(err))
 		return
 	}
 
@@ -126,6 +129,15 @@ func (c *TranscodingController) TranscodingControllerRoutes(router *mux.Router)
 	router.HandleFunc("/transcode/cancel/{jobID}", c.CancelTranscodingJob).Methods("DELETE")
 	router.HandleFunc("/transcode/logs/{jobID}", c.GetJobLogs).Methods("GET")
 	router.HandleFunc("/transcode/resubmit/{jobID}", c.ResubmitFailedJob).Methods("POST")
+	router.HandleFunc("/transcode/formats", c.GetVideoFormats).Methods("GET")
+	router.HandleFunc("/transcode/priority/{jobID}/{priority}", c.ChangePriority).Methods("PUT")
+	router.HandleFunc("/transcode/webhook", c.HandleWebhook).Methods("POST")
+	router.HandleFunc("/transcode/pause/{jobID}", c.PauseJob).Methods("POST")
+	router.HandleFunc("/transcode/resume/{jobID}", c.ResumeJob).Methods("POST")
+	router.HandleFunc("/transcode/health", c.HealthCheck).Methods("GET")
+	router.HandleFunc("/transcode/probe", c.ProbeMedia).Methods("GET")
+	router.HandleFunc("/transcode/profiles", c.GetEncodingProfiles).Methods("GET")
+	router.HandleFunc("/transcode/workers", c.GetWorkers).Methods("GET")
 }
 
 // GetVideoFormats retrieves supported video formats for transcoding
@@ -155,7 +167,7 @@ func (c *TranscodingController) ChangePriority(w http.ResponseWriter, r *http.Re
 	err = c.TranscodingService.UpdatePriority(jobID, priority)
 	if err != nil {
 		log.Printf("Error updating priority: %v", err)
-		http.Error(w, "Failed to update priority", http.StatusInternalServerError)
+		http.Error(w, "Failed to update priority", errorStatus(err))
 		return
 	}
 
@@ -174,7 +186,7 @@ func (c *TranscodingController) HandleWebhook(w http.ResponseWriter, r *http.Req
 	err = c.TranscodingService.ProcessWebhook(notification)
 	if err != nil {
 		log.Printf("Error processing webhook: %v", err)
-		http.Error(w, "Webhook processing failed", http.StatusInternalServerError)
+		http.Error(w, "Webhook processing failed", errorStatus(err))
 		return
 	}
 
@@ -189,7 +201,7 @@ func (c *TranscodingController) PauseJob(w http.ResponseWriter, r *http.Request)
 	err := c.TranscodingService.PauseJob(jobID)
 	if err != nil {
 		log.Printf("Error pausing job: %v", err)
-		http.Error(w, "Failed to pause job", http.StatusInternalServerError)
+		http.Error(w, "Failed to pause job", errorStatus(err))
 		return
 	}
 
@@ -204,7 +216,7 @@ func (c *TranscodingController) ResumeJob(w http.ResponseWriter, r *http.Request
 	err := c.TranscodingService.ResumeJob(jobID)
 	if err != nil {
 		log.Printf("Error resuming job: %v", err)
-		http.Error(w, "Failed to resume job", http.StatusInternalServerError)
+		http.Error(w, "Failed to resume job", errorStatus(err))
 		return
 	}
 
@@ -218,3 +230,62 @@ func (c *TranscodingController) HealthCheck(w http.ResponseWriter, r *http.Reque
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(status)
 }
+
+// GetEncodingProfiles lists the named encoding profiles jobs can select
+func (c *TranscodingController) GetEncodingProfiles(w http.ResponseWriter, r *http.Request) {
+	profiles := c.TranscodingService.GetProfiles()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(profiles)
+}
+
+// GetWorkers lists the worker processes registered to claim jobs
+func (c *TranscodingController) GetWorkers(w http.ResponseWriter, r *http.Request) {
+	workers, err := c.TranscodingService.GetWorkers()
+	if err != nil {
+		log.Printf("Error fetching transcoding workers: %v", err)
+		http.Error(w, "Unable to fetch transcoding workers", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(workers)
+}
+
+// ProbeMedia describes the container and streams of an input file
+func (c *TranscodingController) ProbeMedia(w http.ResponseWriter, r *http.Request) {
+	inputFile := r.URL.Query().Get("input_file")
+	if inputFile == "" {
+		http.Error(w, "input_file is required", http.StatusBadRequest)
+		return
+	}
+
+	media, err := c.TranscodingService.Probe(inputFile)
+	if err != nil {
+		log.Printf("Error probing media: %v", err)
+		http.Error(w, "Unable to probe media", errorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(media)
+}
+
+// errorStatus maps service errors onto HTTP status codes
+func errorStatus(err error) int {
+	if errors.Is(err, repositories.ErrJobNotFound) {
+		return http.StatusNotFound
+	}
+	var transitionErr *domain.TransitionError
+	if errors.As(err, &transitionErr) {
+		return http.StatusConflict
+	}
+	if errors.Is(err, domain.ErrPathNotAllowed) {
+		return http.StatusForbidden
+	}
+	if errors.Is(err, domain.ErrInvalidMedia) || errors.Is(err, domain.ErrUnsupportedCodec) || errors.Is(err, domain.ErrUnknownProfile) ||
+		errors.Is(err, storage.ErrUnsupportedScheme) {
+		return http.StatusUnprocessableEntity
+	}
+	return http.StatusInternalServerError
+}
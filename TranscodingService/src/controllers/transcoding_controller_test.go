@@ -0,0 +1,60 @@
+package controllers
+
+import (
+	"TranscodingService/src/domain"
+	"TranscodingService/src/repositories"
+	"TranscodingService/src/services"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// fakeService answers every job lookup with err; methods the tests do not need panic through the nil interface
+type fakeService struct {
+	services.TranscodingService
+	err error
+}
+
+func (s fakeService) GetStatus(string) (*services.JobStatus, error) { return nil, s.err }
+func (s fakeService) GetJobLogs(string) ([]string, error)           { return nil, s.err }
+func (s fakeService) UpdatePriority(string, int) error              { return s.err }
+func (s fakeService) CancelJob(string) error                        { return s.err }
+func (s fakeService) PauseJob(string) error                         { return s.err }
+
+func TestJobEndpointsStatus(t *testing.T) {
+	notFound := fmt.Errorf("%w: job-1", repositories.ErrJobNotFound)
+	requests := []struct{ method, path string }{
+		{http.MethodGet, "/transcode/status/job-1"},
+		{http.MethodGet, "/transcode/logs/job-1"},
+		{http.MethodPut, "/transcode/priority/job-1/5"},
+		{http.MethodDelete, "/transcode/cancel/job-1"},
+		{http.MethodPost, "/transcode/pause/job-1"},
+	}
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{name: "unknown job", err: notFound, want: http.StatusNotFound},
+		{name: "disallowed transition", err: &domain.TransitionError{From: domain.Completed, To: domain.Paused}, want: http.StatusConflict},
+		{name: "repository failure", err: errors.New("connection refused"), want: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		router := mux.NewRouter()
+		NewTranscodingController(fakeService{err: tt.err}).TranscodingControllerRoutes(router)
+		for _, req := range requests {
+			t.Run(tt.name+" "+req.path, func(t *testing.T) {
+				recorder := httptest.NewRecorder()
+				router.ServeHTTP(recorder, httptest.NewRequest(req.method, req.path, nil))
+				if recorder.Code != tt.want {
+					t.Errorf("%s %s = %d, want %d", req.method, req.path, recorder.Code, tt.want)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package domain
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// loudnormSampleRate is the default rate of normalized audio, since loudnorm itself outputs 192kHz
+const loudnormSampleRate = 48000
+
+// LoudnessTarget is an EBU R128 normalization target
+type LoudnessTarget struct {
+	Integrated float64 `json:"integrated"` // in LUFS
+	TruePeak   float64 `json:"true_peak"`  // in dBTP
+	Range      float64 `json:"range"`      // loudness range in LU
+}
+
+// Validate checks that the target lies within what ffmpeg's loudnorm filter accepts
+func (t LoudnessTarget) Validate() error {
+	if t.Integrated < -70 || t.Integrated > -5 {
+		return fmt.Errorf("integrated loudness %.1f must be between -70 and -5 LUFS", t.Integrated)
+	}
+	if t.TruePeak < -9 || t.TruePeak > 0 {
+		return fmt.Errorf("true peak %.1f must be between -9 and 0 dBTP", t.TruePeak)
+	}
+	if t.Range < 1 || t.Range > 50 {
+		return fmt.Errorf("loudness range %.1f must be between 1 and 50 LU", t.Range)
+	}
+	return nil
+}
+
+// LoudnessMeasurement is what the loudnorm first pass measured on a track
+type LoudnessMeasurement struct {
+	Integrated float64 `json:"integrated"`
+	TruePeak   float64 `json:"true_peak"`
+	Range      float64 `json:"range"`
+	Threshold  float64 `json:"threshold"`
+	Offset     float64 `json:"target_offset"`
+}
+
+// AudioTrack is an audio stream of the source carried into a job's outputs
+type AudioTrack struct {
+	Stream   int                  `json:"stream"` // index of the stream in the input
+	Language string               `json:"language"`
+	Title    string               `json:"title,omitempty"`
+	Channels int                  `json:"source_channels,omitempty"`
+	Loudness *LoudnessMeasurement `json:"measured_loudness,omitempty"`
+	Playlist string               `json:"playlist,omitempty"` // audio-only HLS playlist of a track after the first
+}
+
+// AudioPlan is how a job's audio tracks are encoded into each rendition, zero values keeping the source's
+type AudioPlan struct {
+	Tracks     []AudioTrack
+	Channels   int
+	SampleRate int
+	Loudness   *LoudnessTarget // nil leaves levels untouched
+}
+
+// SelectAudioTracks picks the source audio streams in the given languages, or all of them when none are given
+func SelectAudioTracks(media *MediaInfo, languages []string) ([]AudioTrack, error) {
+	streams := media.StreamsOfType(AudioStream)
+	track := func(stream MediaStream) AudioTrack {
+		language := stream.Language
+		if language == "" {
+			language = "und"
+		}
+		return AudioTrack{Stream: stream.Index, Language: language, Title: stream.Title, Channels: stream.Channels}
+	}
+
+	var tracks []AudioTrack
+	if len(languages) == 0 {
+		for _, stream := range streams {
+			tracks = append(tracks, track(stream))
+		}
+		return tracks, nil
+	}
+	picked := make(map[int]bool)
+	for _, language := range languages {
+		found := false
+		for _, stream := range streams {
+			if strings.EqualFold(stream.Language, language) {
+				found = true
+				if !picked[stream.Index] {
+					picked[stream.Index] = true
+					tracks = append(tracks, track(stream))
+				}
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%w: the input has no %s audio track", ErrInvalidMedia, language)
+		}
+	}
+	return tracks, nil
+}
+
+// NewLoudnessMeasureCommand builds the first loudnorm pass, which logs a stream's measured loudness as JSON
+func NewLoudnessMeasureCommand(policy PathPolicy, inputFile string, track AudioTrack, channels int, target LoudnessTarget) *FFmpegCommand {
+	filter := fmt.Sprintf("loudnorm=I=%.2f:TP=%.2f:LRA=%.2f:print_format=json", target.Integrated, target.TruePeak, target.Range)
+	if channels > 0 {
+		filter = "aformat=channel_layouts=" + channelLayout(channels) + "," + filter
+	}
+	return NewFFmpegCommand(policy).
+		Input(inputFile).
+		Set("-map", fmt.Sprintf("0:%d", track.Stream)).
+		Set("-af", filter).
+		Flag("-vn").
+		Flag("-sn").
+		NullOutput()
+}
+
+// ParseLoudnessMeasurement reads the JSON block the loudnorm first pass logs when it finishes
+func ParseLoudnessMeasurement(output []byte) (*LoudnessMeasurement, error) {
+	start := bytes.LastIndexByte(output, '{')
+	end := bytes.LastIndexByte(output, '}')
+	if start < 0 || end < start {
+		return nil, errors.New("loudnorm reported no measurement")
+	}
+	var values map[string]string
+	if err := json.Unmarshal(output[start:end+1], &values); err != nil {
+		return nil, fmt.Errorf("unreadable loudnorm measurement: %v", err)
+	}
+
+	var m LoudnessMeasurement
+	for key, field := range map[string]*float64{
+		"input_i":       &m.Integrated,
+		"input_tp":      &m.TruePeak,
+		"input_lra":     &m.Range,
+		"input_thresh":  &m.Threshold,
+		"target_offset": &m.Offset,
+	} {
+		value, err := strconv.ParseFloat(values[key], 64)
+		if err != nil {
+			return nil, fmt.Errorf("loudnorm measured %s as %q: %v", key, values[key], err)
+		}
+		*field = value
+	}
+	// A silent track measures -inf, which cannot be normalized
+	if m.Integrated < -70 {
+		return nil, fmt.Errorf("track is silent at %.1f LUFS", m.Integrated)
+	}
+	return &m, nil
+}
+
+// filter returns the downmix, loudness normalization and resampling chain of a track
+func (p *AudioPlan) filter(track AudioTrack) string {
+	var filters []string
+	if p.Channels > 0 {
+		filters = append(filters, "aformat=channel_layouts="+channelLayout(p.Channels))
+	}
+	if t, m := p.Loudness, track.Loudness; t != nil && m != nil {
+		filters = append(filters, fmt.Sprintf("loudnorm=I=%.2f:TP=%.2f:LRA=%.2f:measured_I=%.2f:measured_TP=%.2f:measured_LRA=%.2f:measured_thresh=%.2f:offset=%.2f:linear=true",
+			t.Integrated, t.TruePeak, t.Range, m.Integrated, m.TruePeak, m.Range, m.Threshold, m.Offset))
+		rate := p.SampleRate
+		if rate == 0 {
+			rate = loudnormSampleRate
+		}
+		filters = append(filters, fmt.Sprintf("aresample=%d", rate))
+	}
+	return strings.Join(filters, ",")
+}
+
+// mapAudioTrack queues a source audio stream as the nth audio stream of the next output
+func mapAudioTrack(cmd *FFmpegCommand, input int, plan *AudioPlan, track AudioTrack, n int) {
+	cmd.Set("-map", fmt.Sprintf("%d:%d", input, track.Stream))
+	if filter := plan.filter(track); filter != "" {
+		cmd.Set(fmt.Sprintf("-filter:a:%d", n), filter)
+	}
+	if track.Language != "und" {
+		cmd.Set(fmt.Sprintf("-metadata:s:a:%d", n), "language="+track.Language)
+	}
+}
+
+// HLSAudioPath returns where the audio-only playlist of the nth track of an HLS job is written
+func HLSAudioPath(outputDir string, n int, language string) string {
+	return filepath.Join(outputDir, "audio", fmt.Sprintf("%d_%s", n, language), "index.m3u8")
+}
+
+// channelLayout names the usual layout for a channel count
+func channelLayout(channels int) string {
+	switch channels {
+	case 1:
+		return "mono"
+	case 2:
+		return "stereo"
+	case 6:
+		return "5.1"
+	case 8:
+		return "7.1"
+	default:
+		return fmt.Sprintf("%dc", channels)
+	}
+}
+
+// name is how a track is labelled in a manifest
+func (t AudioTrack) name() string {
+	if t.Title != "" {
+		return t.Title
+	}
+	return t.Language
+}
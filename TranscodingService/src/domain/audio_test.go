@@ -0,0 +1,147 @@
+package domain
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestSelectAudioTracks(t *testing.T) {
+	media := &MediaInfo{Streams: []MediaStream{
+		{Index: 0, Type: VideoStream, Codec: "h264"},
+		{Index: 1, Type: AudioStream, Codec: "ac3", Language: "eng", Channels: 6, Title: "Surround"},
+		{Index: 2, Type: AudioStream, Codec: "aac", Language: "fre", Channels: 2},
+		{Index: 3, Type: AudioStream, Codec: "aac", Channels: 2},
+		{Index: 4, Type: AudioStream, Codec: "aac", Language: "eng", Channels: 2, Title: "Commentary"},
+	}}
+
+	tests := []struct {
+		name      string
+		languages []string
+		want      []int
+		wantErr   bool
+	}{
+		{name: "every track by default", want: []int{1, 2, 3, 4}},
+		{name: "in the requested order", languages: []string{"FRE", "eng"}, want: []int{2, 1, 4}},
+		{name: "each track once", languages: []string{"eng", "eng"}, want: []int{1, 4}},
+		{name: "missing language", languages: []string{"ger"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracks, err := SelectAudioTracks(media, tt.languages)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidMedia) {
+					t.Fatalf("SelectAudioTracks() = %v, want %v", err, ErrInvalidMedia)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SelectAudioTracks() = %v", err)
+			}
+			var got []int
+			for _, track := range tracks {
+				got = append(got, track.Stream)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SelectAudioTracks() streams = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	tracks, _ := SelectAudioTracks(media, nil)
+	if want := (AudioTrack{Stream: 3, Language: "und", Channels: 2}); tracks[2] != want {
+		t.Errorf("untagged track = %+v, want %+v", tracks[2], want)
+	}
+}
+
+func TestParseLoudnessMeasurement(t *testing.T) {
+	measured := `[Parsed_loudnorm_1 @ 0x55d0c4] 
+{
+	"input_i" : "-27.61",
+	"input_tp" : "-4.47",
+	"input_lra" : "18.06",
+	"input_thresh" : "-39.20",
+	"output_i" : "-23.00",
+	"normalization_type" : "dynamic",
+	"target_offset" : "0.58"
+}
+`
+	silent := `{
+	"input_i" : "-inf",
+	"input_tp" : "-inf",
+	"input_lra" : "0.00",
+	"input_thresh" : "-70.00",
+	"target_offset" : "inf"
+}`
+
+	tests := []struct {
+		name    string
+		output  string
+		want    *LoudnessMeasurement
+		wantErr bool
+	}{
+		{name: "measured", output: "size=N/A time=00:01:30.00\n" + measured, want: &LoudnessMeasurement{Integrated: -27.61, TruePeak: -4.47, Range: 18.06, Threshold: -39.2, Offset: 0.58}},
+		{name: "silent track", output: silent, wantErr: true},
+		{name: "no measurement", output: "Error while decoding stream #0:1\n", wantErr: true},
+		{name: "missing value", output: `{"input_i" : "-20.00"}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseLoudnessMeasurement([]byte(tt.output))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseLoudnessMeasurement() = %v, want error %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseLoudnessMeasurement() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAudioPlanFilter(t *testing.T) {
+	measured := AudioTrack{Stream: 1, Loudness: &LoudnessMeasurement{Integrated: -27.61, TruePeak: -4.47, Range: 18.06, Threshold: -39.2, Offset: 0.58}}
+	target := &LoudnessTarget{Integrated: -23, TruePeak: -1, Range: 7}
+	loudnorm := "loudnorm=I=-23.00:TP=-1.00:LRA=7.00:measured_I=-27.61:measured_TP=-4.47:measured_LRA=18.06:measured_thresh=-39.20:offset=0.58:linear=true"
+
+	tests := []struct {
+		name  string
+		plan  AudioPlan
+		track AudioTrack
+		want  string
+	}{
+		{name: "source audio kept", plan: AudioPlan{}, track: measured, want: ""},
+		{name: "downmix only", plan: AudioPlan{Channels: 2}, track: measured, want: "aformat=channel_layouts=stereo"},
+		{name: "normalized at the default rate", plan: AudioPlan{Loudness: target}, track: measured, want: loudnorm + ",aresample=48000"},
+		{name: "downmixed, normalized and resampled", plan: AudioPlan{Channels: 6, SampleRate: 44100, Loudness: target}, track: measured, want: "aformat=channel_layouts=5.1," + loudnorm + ",aresample=44100"},
+		{name: "unmeasured track left at its level", plan: AudioPlan{Channels: 1, Loudness: target}, track: AudioTrack{Stream: 2}, want: "aformat=channel_layouts=mono"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.plan.filter(tt.track); got != tt.want {
+				t.Errorf("filter() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoudnessTargetValidate(t *testing.T) {
+	tests := []struct {
+		target LoudnessTarget
+		valid  bool
+	}{
+		{LoudnessTarget{Integrated: -23, TruePeak: -1, Range: 7}, true},
+		{LoudnessTarget{Integrated: -16, TruePeak: 0, Range: 50}, true},
+		{LoudnessTarget{Integrated: -4, TruePeak: -1, Range: 7}, false},
+		{LoudnessTarget{Integrated: -23, TruePeak: 1, Range: 7}, false},
+		{LoudnessTarget{Integrated: -23, TruePeak: -1, Range: 0.5}, false},
+	}
+
+	for _, tt := range tests {
+		if err := tt.target.Validate(); (err == nil) != tt.valid {
+			t.Errorf("Validate(%+v) = %v, want valid %v", tt.target, err, tt.valid)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package domain
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// chunkFilePattern names encoded chunks by position and span in milliseconds, so only chunks of the same split are reused
+const chunkFilePattern = "chunk_%05d_%d_%d.mkv"
+
+// ChunkOptions controls when and how long inputs are split for parallel encoding
+type ChunkOptions struct {
+	MinDuration time.Duration // inputs shorter than this are encoded in one piece; zero disables chunking
+	Length      time.Duration // target length of each chunk
+	Attempts    int           // encodes of a chunk before the job fails
+}
+
+// Validate checks that the options describe a usable split
+func (o ChunkOptions) Validate() error {
+	if o.MinDuration == 0 {
+		return nil
+	}
+	if o.MinDuration < 0 {
+		return errors.New("chunking minimum duration cannot be negative")
+	}
+	if o.Length < 10*time.Second {
+		return fmt.Errorf("chunk length %s must be at least 10s", o.Length)
+	}
+	if o.Attempts < 1 {
+		return fmt.Errorf("chunk attempts %d must be at least 1", o.Attempts)
+	}
+	return nil
+}
+
+// Chunk is one keyframe-aligned span of the source encoded on its own
+type Chunk struct {
+	Index int
+	Start time.Duration
+	End   time.Duration
+	File  string
+}
+
+// Duration is the length of the source the chunk covers
+func (c Chunk) Duration() time.Duration {
+	return c.End - c.Start
+}
+
+// ParseKeyframes returns the keyframe times from ffprobe pts_time,flags lines
+func ParseKeyframes(output []byte) ([]time.Duration, error) {
+	var keyframes []time.Duration
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		pts, flags, ok := strings.Cut(strings.TrimSpace(scanner.Text()), ",")
+		if !ok || !strings.Contains(flags, "K") {
+			continue
+		}
+		seconds, err := strconv.ParseFloat(pts, 64)
+		if err != nil {
+			continue
+		}
+		t := time.Duration(math.Round(seconds*1e6)) * time.Microsecond
+		if len(keyframes) == 0 || t > keyframes[len(keyframes)-1] {
+			keyframes = append(keyframes, t)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(keyframes) == 0 {
+		return nil, errors.New("ffprobe reported no keyframes")
+	}
+	return keyframes, nil
+}
+
+// PlanChunks splits a source at the first keyframe at or after every multiple of length
+func PlanChunks(keyframes []time.Duration, duration, length time.Duration, dir string) []Chunk {
+	var chunks []Chunk
+	start := time.Duration(0)
+	next := length
+	for _, keyframe := range keyframes {
+		if keyframe < next || keyframe <= start {
+			continue
+		}
+		if duration-keyframe < length/2 {
+			// Fold a short tail into the last chunk
+			break
+		}
+		chunks = append(chunks, Chunk{Index: len(chunks) + 1, Start: start, End: keyframe})
+		start = keyframe
+		for next <= keyframe {
+			next += length
+		}
+	}
+	chunks = append(chunks, Chunk{Index: len(chunks) + 1, Start: start, End: duration})
+	for i := range chunks {
+		chunks[i].File = filepath.Join(dir, fmt.Sprintf(chunkFilePattern, chunks[i].Index, chunks[i].Start.Milliseconds(), chunks[i].End.Milliseconds()))
+	}
+	return chunks
+}
+
+// PartialChunkFile is where a chunk is encoded before it is known to be complete
+func PartialChunkFile(chunk Chunk) string {
+	return strings.TrimSuffix(chunk.File, filepath.Ext(chunk.File)) + ".part" + filepath.Ext(chunk.File)
+}
+
+// NewChunkCommand builds the video-only encode of one chunk of a rendition
+func NewChunkCommand(policy PathPolicy, inputFile string, rendition Rendition, chunk Chunk) *FFmpegCommand {
+	cmd := NewFFmpegCommand(policy).
+		Set("-ss", formatSeconds(chunk.Start)).
+		Set("-t", formatSeconds(chunk.Duration())).
+		Input(inputFile).
+		Set("-map", "0:v:0").
+		Set("-vf", rendition.videoFilter())
+	setVideoEncoder(cmd, MKV, rendition)
+	if rendition.Bitrate != "" {
+		cmd.Set("-b:v", rendition.Bitrate)
+	}
+	return cmd.Flag("-an").
+		Flag("-sn").
+		Set("-f", "matroska").
+		Output(PartialChunkFile(chunk))
+}
+
+// WriteChunkList writes the concat demuxer list joining chunks in order and returns its path
+func WriteChunkList(dir string, chunks []Chunk) (string, error) {
+	var b strings.Builder
+	b.WriteString("ffconcat version 1.0\n")
+	for _, chunk := range chunks {
+		// Single quotes are escaped as the concat demuxer expects
+		fmt.Fprintf(&b, "file '%s'\n", strings.ReplaceAll(filepath.Base(chunk.File), "'", `'\''`))
+	}
+	path := filepath.Join(dir, "chunks.txt")
+	if err := os.WriteFile(path, []byte(b.String()), 0644); err != nil {
+		return "", fmt.Errorf("failed to write chunk list: %v", err)
+	}
+	return path, nil
+}
+
+// NewChunkJoinCommand builds the pass that concatenates the encoded chunks and muxes in the audio
+func NewChunkJoinCommand(policy PathPolicy, format VideoFormat, inputFile, listFile string, rendition Rendition) *FFmpegCommand {
+	cmd := NewFFmpegCommand(policy).
+		Set("-f", "concat").
+		Set("-safe", "0").
+		IntermediateInput(listFile).
+		Input(inputFile).
+		Set("-map", "0:v:0")
+	if rendition.Audio != nil {
+		for n, track := range rendition.Audio.Tracks {
+			mapAudioTrack(cmd, 1, rendition.Audio, track, n)
+		}
+	} else {
+		cmd.Set("-map", "1:a:0?")
+	}
+	cmd.Set("-c:v", "copy")
+	if rendition.VideoCodec == H265 && (format == MP4 || format == MOV) {
+		cmd.Set("-tag:v", "hvc1")
+	}
+	setAudioEncoder(cmd, rendition)
+	return cmd.Output(rendition.OutputFile)
+}
+
+// formatSeconds renders a duration as ffmpeg seconds with microsecond precision
+func formatSeconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 6, 64)
+}
@@ -0,0 +1,134 @@
+package domain
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseKeyframes(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		want    []time.Duration
+		wantErr bool
+	}{
+		{
+			name:   "keyframes only",
+			output: "0.000000,K_\n0.041708,__\n2.002000,K_\n2.043708,__\n4.5,K\n",
+			want:   []time.Duration{0, 2002 * time.Millisecond, 4500 * time.Millisecond},
+		},
+		{
+			name:   "repeated and out of order timestamps dropped",
+			output: "0.000000,K_\n2.002000,K_\n2.002000,K_\n1.000000,K_\n",
+			want:   []time.Duration{0, 2002 * time.Millisecond},
+		},
+		{
+			name:   "unusable lines skipped",
+			output: "N/A,K_\n\nstream\n 6.0,K_ \n",
+			want:   []time.Duration{6 * time.Second},
+		},
+		{
+			name:    "no keyframes",
+			output:  "0.000000,__\n0.041708,__\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseKeyframes([]byte(tt.output))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseKeyframes() = %v, want error %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseKeyframes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlanChunks(t *testing.T) {
+	s := time.Second
+	every := func(interval, until time.Duration) []time.Duration {
+		var keyframes []time.Duration
+		for t := time.Duration(0); t < until; t += interval {
+			keyframes = append(keyframes, t)
+		}
+		return keyframes
+	}
+	type span struct{ start, end time.Duration }
+
+	tests := []struct {
+		name      string
+		keyframes []time.Duration
+		duration  time.Duration
+		want      []span
+	}{
+		{
+			name:      "regular keyframes",
+			keyframes: every(2*s, 300*s),
+			duration:  300 * s,
+			want:      []span{{0, 60 * s}, {60 * s, 120 * s}, {120 * s, 180 * s}, {180 * s, 240 * s}, {240 * s, 300 * s}},
+		},
+		{
+			name:      "cut at the first keyframe past each boundary",
+			keyframes: []time.Duration{0, 50 * s, 65 * s, 130 * s, 170 * s, 250 * s, 290 * s},
+			duration:  300 * s,
+			want:      []span{{0, 65 * s}, {65 * s, 130 * s}, {130 * s, 250 * s}, {250 * s, 300 * s}},
+		},
+		{
+			name:      "short tail folded into the last chunk",
+			keyframes: []time.Duration{0, 60 * s, 120 * s},
+			duration:  140 * s,
+			want:      []span{{0, 60 * s}, {60 * s, 140 * s}},
+		},
+		{
+			name:      "no keyframe past the start",
+			keyframes: []time.Duration{0},
+			duration:  300 * s,
+			want:      []span{{0, 300 * s}},
+		},
+		{
+			name:     "no keyframes",
+			duration: 300 * s,
+			want:     []span{{0, 300 * s}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks := PlanChunks(tt.keyframes, tt.duration, 60*s, "/work/720p")
+			var got []span
+			for i, chunk := range chunks {
+				if chunk.Index != i+1 {
+					t.Errorf("chunk %d has index %d", i+1, chunk.Index)
+				}
+				got = append(got, span{chunk.Start, chunk.End})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("PlanChunks() spans = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChunkFiles(t *testing.T) {
+	chunks := PlanChunks([]time.Duration{0, 61500 * time.Millisecond}, 2*time.Minute, time.Minute, "/work/720p")
+	want := []string{
+		filepath.Join("/work/720p", "chunk_00001_0_61500.mkv"),
+		filepath.Join("/work/720p", "chunk_00002_61500_120000.mkv"),
+	}
+	if len(chunks) != len(want) {
+		t.Fatalf("PlanChunks() = %+v, want files %v", chunks, want)
+	}
+	for i, chunk := range chunks {
+		if chunk.File != want[i] {
+			t.Errorf("chunk %d file = %s, want %s", chunk.Index, chunk.File, want[i])
+		}
+	}
+	if got, want := PartialChunkFile(chunks[0]), filepath.Join("/work/720p", "chunk_00001_0_61500.part.mkv"); got != want {
+		t.Errorf("PartialChunkFile() = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,194 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrUnsupportedCodec is returned when a codec cannot be used for a job
+var ErrUnsupportedCodec = errors.New("unsupported codec")
+
+// VideoCodec names a video compression format
+type VideoCodec string
+
+const (
+	H264 VideoCodec = "h264"
+	H265 VideoCodec = "h265"
+	VP9  VideoCodec = "vp9"
+	AV1  VideoCodec = "av1"
+)
+
+// AudioCodec names an audio compression format
+type AudioCodec string
+
+const (
+	AAC  AudioCodec = "aac"
+	Opus AudioCodec = "opus"
+)
+
+// containerCodecs lists the codecs each output format can carry, defaults first
+var containerCodecs = map[VideoFormat]struct {
+	Video []VideoCodec
+	Audio []AudioCodec
+}{
+	MP4:  {Video: []VideoCodec{H264, H265, AV1}, Audio: []AudioCodec{AAC, Opus}},
+	MKV:  {Video: []VideoCodec{H264, H265, VP9, AV1}, Audio: []AudioCodec{AAC, Opus}},
+	AVI:  {Video: []VideoCodec{H264}, Audio: []AudioCodec{AAC}},
+	MOV:  {Video: []VideoCodec{H264, H265}, Audio: []AudioCodec{AAC}},
+	WebM: {Video: []VideoCodec{VP9, AV1}, Audio: []AudioCodec{Opus}},
+	HLS:  {Video: []VideoCodec{H264}, Audio: []AudioCodec{AAC}},
+	DASH: {Video: []VideoCodec{H264, H265, VP9, AV1}, Audio: []AudioCodec{AAC, Opus}},
+}
+
+// FormatSupport describes the codecs a job targeting Format may request
+type FormatSupport struct {
+	Format      VideoFormat  `json:"format"`
+	VideoCodecs []VideoCodec `json:"video_codecs"`
+	AudioCodecs []AudioCodec `json:"audio_codecs"`
+}
+
+// Encoder returns the ffmpeg encoder used for the codec
+func (c VideoCodec) Encoder() string {
+	switch c {
+	case H265:
+		return "libx265"
+	case VP9:
+		return "libvpx-vp9"
+	case AV1:
+		return "libaom-av1"
+	default:
+		return "libx264"
+	}
+}
+
+// Encoder returns the ffmpeg encoder used for the codec
+func (c AudioCodec) Encoder() string {
+	if c == Opus {
+		return "libopus"
+	}
+	return "aac"
+}
+
+// Muxer returns the ffmpeg muxer that writes the format
+func (f VideoFormat) Muxer() string {
+	switch f {
+	case MKV:
+		return "matroska"
+	default:
+		return string(f)
+	}
+}
+
+// DefaultCodecs returns the codecs used when a job targeting the format does not choose its own
+func DefaultCodecs(format VideoFormat) (VideoCodec, AudioCodec) {
+	codecs, ok := containerCodecs[format]
+	if !ok {
+		return H264, AAC
+	}
+	return codecs.Video[0], codecs.Audio[0]
+}
+
+// CheckCodecs reports whether the format can carry the given codecs
+func CheckCodecs(format VideoFormat, video VideoCodec, audio AudioCodec) error {
+	codecs, ok := containerCodecs[format]
+	if !ok {
+		return errors.New("unsupported video format: " + string(format))
+	}
+	if !containsVideoCodec(codecs.Video, video) {
+		return fmt.Errorf("%w: %s video cannot be written to %s", ErrUnsupportedCodec, video, format)
+	}
+	if !containsAudioCodec(codecs.Audio, audio) {
+		return fmt.Errorf("%w: %s audio cannot be written to %s", ErrUnsupportedCodec, audio, format)
+	}
+	return nil
+}
+
+// FormatSupportFor lists the codecs each format can carry that pass the filters
+func FormatSupportFor(formatOK func(VideoFormat) bool, videoOK func(VideoCodec) bool, audioOK func(AudioCodec) bool) []FormatSupport {
+	var support []FormatSupport
+	for _, format := range SupportedFormats() {
+		if !formatOK(format) {
+			continue
+		}
+		entry := FormatSupport{Format: format}
+		for _, codec := range containerCodecs[format].Video {
+			if videoOK(codec) {
+				entry.VideoCodecs = append(entry.VideoCodecs, codec)
+			}
+		}
+		for _, codec := range containerCodecs[format].Audio {
+			if audioOK(codec) {
+				entry.AudioCodecs = append(entry.AudioCodecs, codec)
+			}
+		}
+		if len(entry.VideoCodecs) > 0 && len(entry.AudioCodecs) > 0 {
+			support = append(support, entry)
+		}
+	}
+	return support
+}
+
+// codecLevel picks the lowest level of the codec's level scheme that fits the resolution at up to 30fps
+func codecLevel(resolution Resolution) int {
+	switch resolution {
+	case FHD:
+		return 40
+	case UHD:
+		return 51
+	default:
+		return 31
+	}
+}
+
+// videoCodecString returns the RFC 6381 codecs value matching the encode settings of a rendition
+func videoCodecString(codec VideoCodec, resolution Resolution, tenBit bool) string {
+	level := codecLevel(resolution)
+	switch codec {
+	case H265:
+		// Main or Main 10 profile, with the level multiplied by 3 as HEVC signals it
+		if tenBit {
+			return fmt.Sprintf("hvc1.2.4.L%d.B0", level*3)
+		}
+		return fmt.Sprintf("hvc1.1.6.L%d.B0", level*3)
+	case VP9:
+		if tenBit {
+			return fmt.Sprintf("vp09.02.%d.10", level)
+		}
+		return fmt.Sprintf("vp09.00.%d.08", level)
+	case AV1:
+		seqLevel := map[int]int{31: 5, 40: 8, 51: 13}[level]
+		if tenBit {
+			return fmt.Sprintf("av01.0.%02dM.10", seqLevel)
+		}
+		return fmt.Sprintf("av01.0.%02dM.08", seqLevel)
+	default:
+		// High profile
+		return fmt.Sprintf("avc1.6400%02x", level)
+	}
+}
+
+// audioCodecString returns the RFC 6381 codecs value of an audio codec
+func audioCodecString(codec AudioCodec) string {
+	if codec == Opus {
+		return "opus"
+	}
+	return "mp4a.40.2" // AAC-LC
+}
+
+func containsVideoCodec(codecs []VideoCodec, codec VideoCodec) bool {
+	for _, c := range codecs {
+		if c == codec {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAudioCodec(codecs []AudioCodec, codec AudioCodec) bool {
+	for _, c := range codecs {
+		if c == codec {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckCodecs(t *testing.T) {
+	tests := []struct {
+		format VideoFormat
+		video  VideoCodec
+		audio  AudioCodec
+		ok     bool
+	}{
+		{MP4, H264, AAC, true},
+		{MP4, H265, AAC, true},
+		{MP4, AV1, Opus, true},
+		{MP4, VP9, AAC, false},
+		{WebM, VP9, Opus, true},
+		{WebM, AV1, Opus, true},
+		{WebM, H264, Opus, false},
+		{WebM, VP9, AAC, false},
+		{MOV, H265, AAC, true},
+		{MOV, H265, Opus, false},
+		{HLS, H264, AAC, true},
+		{HLS, H265, AAC, false},
+		{DASH, VP9, Opus, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.format)+"/"+string(tt.video)+"+"+string(tt.audio), func(t *testing.T) {
+			err := CheckCodecs(tt.format, tt.video, tt.audio)
+			if tt.ok {
+				if err != nil {
+					t.Errorf("CheckCodecs() = %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrUnsupportedCodec) {
+				t.Errorf("CheckCodecs() = %v, want %v", err, ErrUnsupportedCodec)
+			}
+		})
+	}
+
+	if err := CheckCodecs("flv", H264, AAC); err == nil || errors.Is(err, ErrUnsupportedCodec) {
+		t.Errorf("CheckCodecs() of an unknown format = %v, want an unsupported format error", err)
+	}
+}
+
+func TestDefaultCodecs(t *testing.T) {
+	tests := []struct {
+		format VideoFormat
+		video  VideoCodec
+		audio  AudioCodec
+	}{
+		{MP4, H264, AAC},
+		{WebM, VP9, Opus},
+		{HLS, H264, AAC},
+		{"flv", H264, AAC},
+	}
+
+	for _, tt := range tests {
+		if video, audio := DefaultCodecs(tt.format); video != tt.video || audio != tt.audio {
+			t.Errorf("DefaultCodecs(%s) = %s, %s, want %s, %s", tt.format, video, audio, tt.video, tt.audio)
+		}
+	}
+}
+
+func TestCodecEncoders(t *testing.T) {
+	videos := map[VideoCodec]string{H264: "libx264", H265: "libx265", VP9: "libvpx-vp9", AV1: "libaom-av1"}
+	for codec, want := range videos {
+		if got := codec.Encoder(); got != want {
+			t.Errorf("%s encoder = %s, want %s", codec, got, want)
+		}
+	}
+	audios := map[AudioCodec]string{AAC: "aac", Opus: "libopus"}
+	for codec, want := range audios {
+		if got := codec.Encoder(); got != want {
+			t.Errorf("%s encoder = %s, want %s", codec, got, want)
+		}
+	}
+	if got := MKV.Muxer(); got != "matroska" {
+		t.Errorf("mkv muxer = %s, want matroska", got)
+	}
+}
@@ -0,0 +1,352 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// ErrPathNotAllowed is returned when a file lies outside every allowed root
+var ErrPathNotAllowed = errors.New("path is outside the allowed roots")
+
+// PathPolicy restricts the files a transcoding command may read and write, allowing any path when a root list is empty
+type PathPolicy struct {
+	InputRoots  []string
+	OutputRoots []string
+}
+
+// ResolveInput returns the absolute, symlink-free form of an input path that lies under an input root
+func (p PathPolicy) ResolveInput(path string) (string, error) {
+	resolved, err := normalizePath(path)
+	if err != nil {
+		return "", err
+	}
+	resolved = resolveSymlinks(resolved)
+	if !withinRoots(resolved, p.InputRoots) {
+		return "", fmt.Errorf("input file %s: %w", path, ErrPathNotAllowed)
+	}
+	return resolved, nil
+}
+
+// ResolveOutput returns the absolute form of an output path, which need not exist yet, that lies under an output root
+func (p PathPolicy) ResolveOutput(path string) (string, error) {
+	resolved, err := normalizePath(path)
+	if err != nil {
+		return "", err
+	}
+	resolved = resolveSymlinks(resolved)
+	if !withinRoots(resolved, p.OutputRoots) {
+		return "", fmt.Errorf("output file %s: %w", path, ErrPathNotAllowed)
+	}
+	return resolved, nil
+}
+
+// normalizePath cleans a path and makes it absolute so it can never be read as an ffmpeg option
+func normalizePath(path string) (string, error) {
+	if strings.TrimSpace(path) == "" {
+		return "", errors.New("path cannot be empty")
+	}
+	if strings.ContainsRune(path, 0) {
+		return "", fmt.Errorf("path contains a NUL byte: %q", path)
+	}
+	return filepath.Abs(path)
+}
+
+// resolveSymlinks resolves the symlinks in the longest existing ancestor of an absolute path and rejoins the rest
+func resolveSymlinks(path string) string {
+	missing := ""
+	for dir := path; ; dir = filepath.Dir(dir) {
+		if real, err := filepath.EvalSymlinks(dir); err == nil {
+			return filepath.Join(real, missing)
+		}
+		if parent := filepath.Dir(dir); parent == dir {
+			return path
+		}
+		missing = filepath.Join(filepath.Base(dir), missing)
+	}
+}
+
+// withinRoots reports whether path is one of roots or lies beneath one
+func withinRoots(path string, roots []string) bool {
+	if len(roots) == 0 {
+		return true
+	}
+	for _, root := range roots {
+		root, err := filepath.Abs(root)
+		if err != nil {
+			continue
+		}
+		if real, err := filepath.EvalSymlinks(root); err == nil {
+			root = real
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			continue
+		}
+		if rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// FFmpegCommand builds an ffmpeg argument vector whose options apply to the next Input or Output, as on the command line
+type FFmpegCommand struct {
+	policy  PathPolicy
+	global  []string
+	args    []string
+	pending []string
+	outputs int
+	err     error
+}
+
+// NewFFmpegCommand starts a command whose files are checked against policy
+func NewFFmpegCommand(policy PathPolicy) *FFmpegCommand {
+	return &FFmpegCommand{
+		policy: policy,
+		global: []string{"-hide_banner", "-nostdin", "-y"},
+	}
+}
+
+// Global appends options that apply to the whole invocation
+func (c *FFmpegCommand) Global(args ...string) *FFmpegCommand {
+	c.global = append(c.global, args...)
+	return c
+}
+
+// Flag queues a valueless option for the next input or output
+func (c *FFmpegCommand) Flag(name string) *FFmpegCommand {
+	c.pending = append(c.pending, name)
+	return c
+}
+
+// Set queues an option and its value for the next input or output
+func (c *FFmpegCommand) Set(name, value string) *FFmpegCommand {
+	c.pending = append(c.pending, name, value)
+	return c
+}
+
+// SetPath queues an option whose value is an output path, such as a segment filename pattern
+func (c *FFmpegCommand) SetPath(name, path string) *FFmpegCommand {
+	resolved, err := c.policy.ResolveOutput(path)
+	if err != nil {
+		c.fail(err)
+		return c
+	}
+	c.pending = append(c.pending, name, "file:"+resolved)
+	return c
+}
+
+// Input adds an input file along with any queued options
+func (c *FFmpegCommand) Input(path string) *FFmpegCommand {
+	resolved, err := c.policy.ResolveInput(path)
+	if err != nil {
+		c.fail(err)
+		return c
+	}
+	c.args = append(c.args, c.pending...)
+	c.args = append(c.args, "-i", "file:"+resolved)
+	c.pending = nil
+	return c
+}
+
+// IntermediateInput adds a file an earlier pass wrote under the output roots, such as a chunk list, as an input
+func (c *FFmpegCommand) IntermediateInput(path string) *FFmpegCommand {
+	resolved, err := c.policy.ResolveOutput(path)
+	if err != nil {
+		c.fail(err)
+		return c
+	}
+	c.args = append(c.args, c.pending...)
+	c.args = append(c.args, "-i", "file:"+resolved)
+	c.pending = nil
+	return c
+}
+
+// Output adds an output file along with any queued options
+func (c *FFmpegCommand) Output(path string) *FFmpegCommand {
+	resolved, err := c.policy.ResolveOutput(path)
+	if err != nil {
+		c.fail(err)
+		return c
+	}
+	c.args = append(c.args, c.pending...)
+	c.args = append(c.args, "file:"+resolved)
+	c.pending = nil
+	c.outputs++
+	return c
+}
+
+// NullOutput discards the decoded output, for passes that only analyse their input
+func (c *FFmpegCommand) NullOutput() *FFmpegCommand {
+	c.args = append(c.args, c.pending...)
+	c.args = append(c.args, "-f", "null", "-")
+	c.pending = nil
+	c.outputs++
+	return c
+}
+
+// Build returns the argument vector, without the ffmpeg binary itself
+func (c *FFmpegCommand) Build() ([]string, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	if c.outputs == 0 {
+		return nil, errors.New("ffmpeg command has no output")
+	}
+	if len(c.pending) > 0 {
+		return nil, fmt.Errorf("ffmpeg options %v are not followed by an input or output", c.pending)
+	}
+
+	args := make([]string, 0, len(c.global)+len(c.args))
+	args = append(args, c.global...)
+	return append(args, c.args...), nil
+}
+
+// fail keeps the first error hit while building
+func (c *FFmpegCommand) fail(err error) {
+	if c.err == nil {
+		c.err = err
+	}
+}
+
+// NewTranscodingCommand builds the single-output encode used for a transcoding job
+func NewTranscodingCommand(policy PathPolicy, inputFile, outputFile string, resolution Resolution) *FFmpegCommand {
+	return NewRenditionCommand(policy, "", inputFile, Rendition{Resolution: resolution, OutputFile: outputFile})
+}
+
+// NewRenditionCommand builds the progressive encode of one rendition into a file of the given format
+func NewRenditionCommand(policy PathPolicy, format VideoFormat, inputFile string, rendition Rendition) *FFmpegCommand {
+	cmd := NewFFmpegCommand(policy).Input(inputFile)
+	addRenditionOutput(cmd, format, rendition, "")
+	return cmd
+}
+
+// addRenditionOutput adds the progressive encode of one rendition as an output of cmd, its video from videoLabel when set
+func addRenditionOutput(cmd *FFmpegCommand, format VideoFormat, rendition Rendition, videoLabel string) {
+	mapStreams(cmd, rendition, videoLabel, -1)
+	setProgressiveVideo(cmd, format, rendition)
+	setAudioEncoder(cmd, rendition)
+	cmd.Output(rendition.OutputFile)
+}
+
+// setProgressiveVideo queues the video encoder of a progressive rendition with its bitrate and two-pass peaks
+func setProgressiveVideo(cmd *FFmpegCommand, format VideoFormat, rendition Rendition) {
+	setVideoEncoder(cmd, format, rendition)
+	if rendition.Bitrate == "" {
+		return
+	}
+	cmd.Set("-b:v", rendition.Bitrate)
+	if plan := rendition.TwoPass; plan != nil {
+		cmd.Set("-maxrate", FormatBitrate(plan.MaxRateKbps)).
+			Set("-bufsize", FormatBitrate(plan.BufferKbps))
+	}
+}
+
+// mapStreams queues the video and up to maxTracks audio tracks of a rendition's output, every track when negative
+func mapStreams(cmd *FFmpegCommand, rendition Rendition, videoLabel string, maxTracks int) {
+	if videoLabel != "" {
+		cmd.Set("-map", "["+videoLabel+"]")
+	} else {
+		cmd.Set("-map", "0:v:0").Set("-vf", rendition.videoFilter())
+	}
+	audio := rendition.Audio
+	if audio == nil {
+		cmd.Set("-map", "0:a:0?")
+		return
+	}
+	tracks := audio.Tracks
+	if maxTracks >= 0 && len(tracks) > maxTracks {
+		tracks = tracks[:maxTracks]
+	}
+	for n, track := range tracks {
+		mapAudioTrack(cmd, 0, audio, track, n)
+	}
+}
+
+// setVideoEncoder queues the encoder options for a rendition's codec, bitrate, pass and profile
+func setVideoEncoder(cmd *FFmpegCommand, format VideoFormat, rendition Rendition) {
+	codec := rendition.VideoCodec
+	profile := rendition.Profile
+	if profile == nil {
+		profile = &EncodingProfile{}
+	}
+	preset := profile.Preset
+	if preset == "" {
+		preset = "fast"
+	}
+	crf := func(fallback int) string {
+		if profile.CRF != 0 {
+			return fmt.Sprint(profile.CRF)
+		}
+		return fmt.Sprint(fallback)
+	}
+
+	cmd.Set("-c:v", codec.Encoder())
+	switch codec {
+	case H265:
+		cmd.Set("-preset", preset)
+		if rendition.Bitrate == "" {
+			cmd.Set("-crf", crf(26))
+		}
+		if format == MP4 || format == MOV || format.IsStreaming() {
+			// Apple players only accept HEVC tagged as hvc1
+			cmd.Set("-tag:v", "hvc1")
+		}
+	case VP9:
+		cmd.Set("-deadline", "good").Set("-cpu-used", "2").Set("-row-mt", "1")
+		if rendition.Bitrate == "" {
+			cmd.Set("-crf", crf(32)).Set("-b:v", "0")
+		}
+	case AV1:
+		cmd.Set("-cpu-used", "6").Set("-row-mt", "1")
+		if rendition.Bitrate == "" {
+			cmd.Set("-crf", crf(30)).Set("-b:v", "0")
+		}
+	default:
+		cmd.Set("-preset", preset)
+		if rendition.Bitrate == "" {
+			cmd.Set("-crf", crf(22))
+		}
+	}
+
+	if profile.GOPSize > 0 {
+		cmd.Set("-g", fmt.Sprint(profile.GOPSize))
+	}
+	if profile.PixelFormat != "" {
+		cmd.Set("-pix_fmt", profile.PixelFormat)
+	}
+	if rendition.TwoPass != nil {
+		setPass(cmd, codec, rendition.TwoPass)
+	}
+}
+
+// setAudioEncoder queues the encoder options for a rendition's audio codec and channel layout
+func setAudioEncoder(cmd *FFmpegCommand, rendition Rendition) {
+	cmd.Set("-c:a", rendition.AudioCodec.Encoder()).
+		Set("-b:a", FormatBitrate(rendition.audioKbps()))
+	channels, sampleRate := rendition.audioLayout()
+	if channels > 0 {
+		cmd.Set("-ac", fmt.Sprint(channels))
+	}
+	if sampleRate > 0 {
+		cmd.Set("-ar", fmt.Sprint(sampleRate))
+	}
+}
+
+// resolutionDimensions maps a resolution onto its nominal 16:9 frame size
+func resolutionDimensions(resolution Resolution) string {
+	switch resolution {
+	case SD:
+		return "854x480"
+	case HD:
+		return "1280x720"
+	case FHD:
+		return "1920x1080"
+	case UHD:
+		return "3840x2160"
+	default:
+		return "1280x720" // Default to HD
+	}
+}
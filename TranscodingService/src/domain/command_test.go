@@ -0,0 +1,88 @@
+package domain
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPathPolicyResolve(t *testing.T) {
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	inputs := filepath.Join(dir, "inputs")
+	outputs := filepath.Join(dir, "outputs")
+	outside := filepath.Join(dir, "outside")
+	for _, d := range []string{inputs, outputs, outside, filepath.Join(dir, "inputs-other")} {
+		if err := os.Mkdir(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	secret := filepath.Join(outside, "secret.mp4")
+	if err := os.WriteFile(secret, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(secret, filepath.Join(inputs, "linked.mp4")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(outputs, "linked")); err != nil {
+		t.Fatal(err)
+	}
+	policy := PathPolicy{InputRoots: []string{inputs}, OutputRoots: []string{outputs}}
+
+	tests := []struct {
+		name    string
+		resolve func(string) (string, error)
+		path    string
+		want    string
+		wantErr error
+	}{
+		{name: "input under root", resolve: policy.ResolveInput, path: filepath.Join(inputs, "movie.mp4"), want: filepath.Join(inputs, "movie.mp4")},
+		{name: "input cleaned", resolve: policy.ResolveInput, path: inputs + "/./sub/../movie.mp4", want: filepath.Join(inputs, "movie.mp4")},
+		{name: "input named like a parent", resolve: policy.ResolveInput, path: filepath.Join(inputs, "..movie.mp4"), want: filepath.Join(inputs, "..movie.mp4")},
+		{name: "input climbing out", resolve: policy.ResolveInput, path: inputs + "/../outside/secret.mp4", wantErr: ErrPathNotAllowed},
+		{name: "input in a sibling sharing the root prefix", resolve: policy.ResolveInput, path: filepath.Join(dir, "inputs-other", "movie.mp4"), wantErr: ErrPathNotAllowed},
+		{name: "input symlinked out of root", resolve: policy.ResolveInput, path: filepath.Join(inputs, "linked.mp4"), wantErr: ErrPathNotAllowed},
+		{name: "input under an output root", resolve: policy.ResolveInput, path: filepath.Join(outputs, "movie.mp4"), wantErr: ErrPathNotAllowed},
+		{name: "output not yet written", resolve: policy.ResolveOutput, path: filepath.Join(outputs, "movie.mp4"), want: filepath.Join(outputs, "movie.mp4")},
+		{name: "output root itself", resolve: policy.ResolveOutput, path: outputs, want: outputs},
+		{name: "output climbing out", resolve: policy.ResolveOutput, path: outputs + "/../outside/movie.mp4", wantErr: ErrPathNotAllowed},
+		{name: "output through a symlinked directory", resolve: policy.ResolveOutput, path: filepath.Join(outputs, "linked", "movie.mp4"), wantErr: ErrPathNotAllowed},
+		{name: "output in a missing directory under a symlinked one", resolve: policy.ResolveOutput, path: filepath.Join(outputs, "linked", "hls", "720p", "index.m3u8"), wantErr: ErrPathNotAllowed},
+		{name: "output in missing directories under a root", resolve: policy.ResolveOutput, path: filepath.Join(outputs, "movie", "hls", "master.m3u8"), want: filepath.Join(outputs, "movie", "hls", "master.m3u8")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.resolve(tt.path)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("resolve(%s) = %s, %v, want %v", tt.path, got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("resolve(%s) = %s, %v, want %s", tt.path, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestPathPolicyRejectsMalformedPaths(t *testing.T) {
+	var policy PathPolicy
+	for _, path := range []string{"", "   ", "movie\x00.mp4"} {
+		if _, err := policy.ResolveInput(path); err == nil {
+			t.Errorf("ResolveInput(%q) = nil, want an error", path)
+		}
+		if _, err := policy.ResolveOutput(path); err == nil {
+			t.Errorf("ResolveOutput(%q) = nil, want an error", path)
+		}
+	}
+
+	resolved, err := policy.ResolveInput("-i.mp4")
+	if err != nil || !filepath.IsAbs(resolved) {
+		t.Errorf("ResolveInput(-i.mp4) = %s, %v, want an absolute path", resolved, err)
+	}
+}
@@ -0,0 +1,242 @@
+package domain
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DASH segment names, relative to each rendition's directory; the muxer numbers video 0 and audio tracks from 1
+const (
+	dashInitSegment  = "init_$RepresentationID$.m4s"
+	dashMediaSegment = "segment_$RepresentationID$_$Number%05d$.m4s"
+)
+
+// NewDASHRenditionCommand builds the encode that splits one rendition into fragmented MP4 segments
+func NewDASHRenditionCommand(policy PathPolicy, inputFile string, rendition Rendition) *FFmpegCommand {
+	cmd := NewFFmpegCommand(policy).Input(inputFile)
+	addDASHOutput(cmd, rendition, "")
+	return cmd
+}
+
+// addDASHOutput adds the splitting of one rendition into fragmented MP4 segments as an output of cmd
+func addDASHOutput(cmd *FFmpegCommand, rendition Rendition, videoLabel string) {
+	queueSegmentedEncode(cmd, DASH, rendition, videoLabel)
+	cmd.Set("-f", "dash").
+		Set("-seg_duration", fmt.Sprint(segmentSeconds)).
+		Set("-use_template", "1").
+		Set("-use_timeline", "0").
+		Set("-init_seg_name", dashInitSegment).
+		Set("-media_seg_name", dashMediaSegment).
+		Output(rendition.OutputFile)
+}
+
+type mpd struct {
+	XMLName                   xml.Name `xml:"MPD"`
+	Xmlns                     string   `xml:"xmlns,attr"`
+	Profiles                  string   `xml:"profiles,attr"`
+	Type                      string   `xml:"type,attr"`
+	MediaPresentationDuration string   `xml:"mediaPresentationDuration,attr"`
+	MinBufferTime             string   `xml:"minBufferTime,attr"`
+	Period                    mpdPeriod
+}
+
+type mpdPeriod struct {
+	XMLName        xml.Name `xml:"Period"`
+	ID             string   `xml:"id,attr"`
+	Start          string   `xml:"start,attr"`
+	AdaptationSets []mpdAdaptationSet
+}
+
+type mpdAdaptationSet struct {
+	XMLName          xml.Name       `xml:"AdaptationSet"`
+	ID               int            `xml:"id,attr"`
+	ContentType      string         `xml:"contentType,attr"`
+	MimeType         string         `xml:"mimeType,attr"`
+	Lang             string         `xml:"lang,attr,omitempty"`
+	SegmentAlignment bool           `xml:"segmentAlignment,attr,omitempty"`
+	StartWithSAP     int            `xml:"startWithSAP,attr,omitempty"`
+	Role             *mpdDescriptor `xml:"Role,omitempty"`
+	Label            string         `xml:"Label,omitempty"`
+	Representations  []mpdRepresentation
+}
+
+type mpdDescriptor struct {
+	SchemeIDURI string `xml:"schemeIdUri,attr"`
+	Value       string `xml:"value,attr"`
+}
+
+type mpdRepresentation struct {
+	XMLName         xml.Name `xml:"Representation"`
+	ID              string   `xml:"id,attr"`
+	Bandwidth       int      `xml:"bandwidth,attr"`
+	Codecs          string   `xml:"codecs,attr,omitempty"`
+	Width           int      `xml:"width,attr,omitempty"`
+	Height          int      `xml:"height,attr,omitempty"`
+	BaseURL         string   `xml:"BaseURL,omitempty"`
+	SegmentTemplate *mpdSegmentTemplate
+}
+
+type mpdSegmentTemplate struct {
+	XMLName        xml.Name `xml:"SegmentTemplate"`
+	Timescale      int      `xml:"timescale,attr"`
+	Duration       int      `xml:"duration,attr"`
+	StartNumber    int      `xml:"startNumber,attr"`
+	Initialization string   `xml:"initialization,attr"`
+	Media          string   `xml:"media,attr"`
+}
+
+// MPD renders a static DASH manifest of the completed renditions with their audio and subtitle tracks
+func MPD(manifestPath string, renditions []Rendition, subtitles []SubtitleTrack, duration time.Duration) (string, error) {
+	if duration <= 0 {
+		return "", fmt.Errorf("source duration is unknown, cannot write %s", manifestPath)
+	}
+
+	video := mpdAdaptationSet{ID: 0, ContentType: "video", MimeType: "video/mp4", SegmentAlignment: true, StartWithSAP: 1}
+	var audio []mpdAdaptationSet
+	for _, rendition := range renditions {
+		if rendition.Status != RenditionCompleted {
+			continue
+		}
+		kbps, err := ParseBitrate(rendition.Bitrate)
+		if err != nil {
+			return "", fmt.Errorf("rendition %s has no usable bitrate: %v", rendition.Resolution, err)
+		}
+		dir, err := filepath.Rel(filepath.Dir(manifestPath), filepath.Dir(rendition.OutputFile))
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.ToSlash(dir)
+
+		var width, height int
+		fmt.Sscanf(rendition.frameSize(), "%dx%d", &width, &height)
+		video.Representations = append(video.Representations, mpdRepresentation{
+			ID:              string(rendition.Resolution),
+			Bandwidth:       kbps * 1000,
+			Codecs:          videoCodecString(rendition.VideoCodec, rendition.Resolution, rendition.Profile.TenBit()),
+			Width:           width,
+			Height:          height,
+			SegmentTemplate: dashSegmentTemplate(dir, 0),
+		})
+
+		if audio == nil {
+			audio = dashAudioSets(rendition, dir)
+		}
+	}
+	if len(video.Representations) == 0 {
+		return "", fmt.Errorf("no completed renditions to list in %s", manifestPath)
+	}
+
+	manifest := mpd{
+		Xmlns:                     "urn:mpeg:dash:schema:mpd:2011",
+		Profiles:                  "urn:mpeg:dash:profile:isoff-live:2011",
+		Type:                      "static",
+		MediaPresentationDuration: fmt.Sprintf("PT%.3fS", duration.Seconds()),
+		MinBufferTime:             fmt.Sprintf("PT%dS", segmentSeconds),
+		Period:                    mpdPeriod{ID: "0", Start: "PT0S", AdaptationSets: []mpdAdaptationSet{video}},
+	}
+	manifest.Period.AdaptationSets = append(manifest.Period.AdaptationSets, audio...)
+	for i, track := range subtitles {
+		uri, err := filepath.Rel(filepath.Dir(manifestPath), track.File)
+		if err != nil {
+			return "", err
+		}
+		manifest.Period.AdaptationSets = append(manifest.Period.AdaptationSets, mpdAdaptationSet{
+			ID:          len(manifest.Period.AdaptationSets),
+			ContentType: "text",
+			MimeType:    "text/vtt",
+			Lang:        track.Language,
+			Role:        &mpdDescriptor{SchemeIDURI: "urn:mpeg:dash:role:2011", Value: "subtitle"},
+			Label:       track.name(),
+			Representations: []mpdRepresentation{{
+				ID:        fmt.Sprintf("subtitle_%d", i+1),
+				Bandwidth: 256,
+				BaseURL:   filepath.ToSlash(uri),
+			}},
+		})
+	}
+
+	out, err := xml.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return xml.Header + string(out) + "\n", nil
+}
+
+// WriteMPD writes the DASH manifest for renditions and subtitles to manifestPath
+func WriteMPD(manifestPath string, renditions []Rendition, subtitles []SubtitleTrack, duration time.Duration) error {
+	manifest, err := MPD(manifestPath, renditions, subtitles, duration)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(manifestPath, []byte(manifest), 0644); err != nil {
+		return fmt.Errorf("failed to write DASH manifest: %v", err)
+	}
+	return nil
+}
+
+// dashSegmentTemplate addresses the segments the dash muxer wrote for one stream of a rendition
+func dashSegmentTemplate(dir string, streamID int) *mpdSegmentTemplate {
+	id := fmt.Sprint(streamID)
+	return &mpdSegmentTemplate{
+		Timescale:      1000,
+		Duration:       segmentSeconds * 1000,
+		StartNumber:    1,
+		Initialization: dir + "/" + replaceRepresentationID(dashInitSegment, id),
+		Media:          dir + "/" + replaceRepresentationID(dashMediaSegment, id),
+	}
+}
+
+// replaceRepresentationID fills in the $RepresentationID$ the dash muxer expands per stream
+func replaceRepresentationID(template, id string) string {
+	return strings.ReplaceAll(template, "$RepresentationID$", id)
+}
+
+// dashAudioSets builds an adaptation set for each audio track the dash muxer wrote for the rendition
+func dashAudioSets(rendition Rendition, dir string) []mpdAdaptationSet {
+	tracks := []AudioTrack{{Language: "und"}}
+	if rendition.Audio != nil {
+		tracks = rendition.Audio.Tracks
+	}
+	var sets []mpdAdaptationSet
+	for n, track := range tracks {
+		streamID := n + 1
+		if !hasDASHAudio(rendition, streamID) {
+			continue
+		}
+		id := "audio"
+		if n > 0 {
+			id = fmt.Sprintf("audio_%d", streamID)
+		}
+		set := mpdAdaptationSet{
+			ID:               len(sets) + 1,
+			ContentType:      "audio",
+			MimeType:         "audio/mp4",
+			SegmentAlignment: true,
+			StartWithSAP:     1,
+			Representations: []mpdRepresentation{{
+				ID:              id,
+				Bandwidth:       rendition.audioKbps() * 1000,
+				Codecs:          audioCodecString(rendition.AudioCodec),
+				SegmentTemplate: dashSegmentTemplate(dir, streamID),
+			}},
+		}
+		if track.Language != "und" {
+			set.Lang = track.Language
+		}
+		if len(tracks) > 1 {
+			set.Label = track.name()
+		}
+		sets = append(sets, set)
+	}
+	return sets
+}
+
+// hasDASHAudio reports whether the dash muxer wrote the audio stream numbered streamID for the rendition
+func hasDASHAudio(rendition Rendition, streamID int) bool {
+	_, err := os.Stat(filepath.Join(filepath.Dir(rendition.OutputFile), replaceRepresentationID(dashInitSegment, fmt.Sprint(streamID))))
+	return err == nil
+}
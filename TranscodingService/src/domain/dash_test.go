@@ -0,0 +1,122 @@
+package domain
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMPD(t *testing.T) {
+	dir := t.TempDir()
+	manifest := filepath.Join(dir, "manifest.mpd")
+	rendition := func(resolution Resolution, bitrate string, status RenditionStatus, audioStreams int) Rendition {
+		out := filepath.Join(dir, string(resolution))
+		if err := os.MkdirAll(out, 0755); err != nil {
+			t.Fatal(err)
+		}
+		for id := 1; id <= audioStreams; id++ {
+			if err := os.WriteFile(filepath.Join(out, replaceRepresentationID(dashInitSegment, strconv.Itoa(id))), nil, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return Rendition{Resolution: resolution, Bitrate: bitrate, VideoCodec: H264, AudioCodec: AAC, OutputFile: filepath.Join(out, "manifest.mpd"), Status: status}
+	}
+	hd := rendition(HD, "2500k", RenditionCompleted, 1)
+	fhd := rendition(FHD, "5000k", RenditionFailed, 1)
+	silent := rendition(SD, "1000k", RenditionCompleted, 0)
+	dubbed := rendition(UHD, "8000k", RenditionCompleted, 2)
+	dubbed.Audio = &AudioPlan{Tracks: []AudioTrack{{Language: "en"}, {Language: "fr", Title: "French"}}}
+
+	tests := []struct {
+		name       string
+		renditions []Rendition
+		subtitles  []SubtitleTrack
+		duration   time.Duration
+		want       []string
+		absent     []string
+		wantErr    string
+	}{
+		{
+			name:       "video and audio",
+			renditions: []Rendition{hd, fhd},
+			duration:   90 * time.Second,
+			want: []string{
+				`mediaPresentationDuration="PT90.000S"`,
+				`<Representation id="720p" bandwidth="2500000" codecs="avc1.64001f" width="1280" height="720">`,
+				`initialization="720p/init_0.m4s" media="720p/segment_0_$Number%05d$.m4s"`,
+				`<AdaptationSet id="1" contentType="audio" mimeType="audio/mp4" segmentAlignment="true" startWithSAP="1">`,
+				`<Representation id="audio" bandwidth="128000" codecs="mp4a.40.2">`,
+				`initialization="720p/init_1.m4s"`,
+			},
+			absent: []string{`id="1080p"`, "<Label>"},
+		},
+		{
+			name:       "audio tracks the muxer did not write are left out",
+			renditions: []Rendition{silent},
+			duration:   time.Minute,
+			want:       []string{`<Representation id="480p"`},
+			absent:     []string{`contentType="audio"`},
+		},
+		{
+			name:       "an adaptation set per audio track",
+			renditions: []Rendition{dubbed},
+			duration:   time.Minute,
+			want: []string{
+				`<AdaptationSet id="1" contentType="audio" mimeType="audio/mp4" lang="en" segmentAlignment="true" startWithSAP="1">`,
+				`<AdaptationSet id="2" contentType="audio" mimeType="audio/mp4" lang="fr" segmentAlignment="true" startWithSAP="1">`,
+				"<Label>French</Label>",
+				`<Representation id="audio_2" bandwidth="128000" codecs="mp4a.40.2">`,
+			},
+		},
+		{
+			name:       "subtitle tracks",
+			renditions: []Rendition{hd},
+			subtitles:  []SubtitleTrack{{Language: "en", File: filepath.Join(dir, "subtitles", "en.vtt")}},
+			duration:   time.Minute,
+			want: []string{
+				`<AdaptationSet id="2" contentType="text" mimeType="text/vtt" lang="en">`,
+				`<Role schemeIdUri="urn:mpeg:dash:role:2011" value="subtitle"></Role>`,
+				"<BaseURL>subtitles/en.vtt</BaseURL>",
+			},
+		},
+		{
+			name:       "unknown duration",
+			renditions: []Rendition{hd},
+			wantErr:    "source duration is unknown",
+		},
+		{
+			name:       "nothing completed",
+			renditions: []Rendition{fhd},
+			duration:   time.Minute,
+			wantErr:    "no completed renditions",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := MPD(manifest, tt.renditions, tt.subtitles, tt.duration)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("MPD() = %v, want an error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("MPD() = %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("MPD() is missing %s:\n%s", want, got)
+				}
+			}
+			for _, absent := range tt.absent {
+				if strings.Contains(got, absent) {
+					t.Errorf("MPD() unexpectedly contains %s:\n%s", absent, got)
+				}
+			}
+		})
+	}
+}
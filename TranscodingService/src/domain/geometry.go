@@ -0,0 +1,129 @@
+package domain
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+)
+
+// CropArea is the part of the source frame kept after removing black bars
+type CropArea struct {
+	Width  int `json:"width"`
+	Height int `json:"height"`
+	X      int `json:"x"`
+	Y      int `json:"y"`
+}
+
+// OutputMetadata records how a job's outputs were derived from its source
+type OutputMetadata struct {
+	SourceWidth  int                 `json:"source_width,omitempty"`
+	SourceHeight int                 `json:"source_height,omitempty"`
+	Crop         *CropArea           `json:"crop,omitempty"`
+	Padded       bool                `json:"padded,omitempty"`
+	Renditions   []RenditionGeometry `json:"renditions,omitempty"`
+	Trickplay    *TrickplayArtifacts `json:"trickplay,omitempty"`
+	Posters      []PosterCandidate   `json:"posters,omitempty"`
+	Subtitles    []SubtitleTrack     `json:"subtitles,omitempty"`
+	Audio        []AudioTrack        `json:"audio,omitempty"`
+	Loudness     *LoudnessTarget     `json:"loudness_target,omitempty"` // set when audio was normalized
+	Encoding     *EncodeStats        `json:"encoding,omitempty"`
+}
+
+// RenditionGeometry is the frame size and filter chain of one rendition
+type RenditionGeometry struct {
+	Resolution Resolution `json:"resolution"`
+	Width      int        `json:"width,omitempty"`
+	Height     int        `json:"height"`
+	Filter     string     `json:"filter"`
+}
+
+// cropPattern matches the crop=w:h:x:y suggestion cropdetect logs for each frame
+var cropPattern = regexp.MustCompile(`crop=(\d+):(\d+):(\d+):(\d+)`)
+
+// PlanGeometry works out the crop, scale and optional pad filter chain that turns the source into a rendition
+func PlanGeometry(sourceWidth, sourceHeight int, crop *CropArea, resolution Resolution, pad bool) RenditionGeometry {
+	frameHeight := resolution.Height()
+	if frameHeight == 0 {
+		frameHeight = HD.Height()
+	}
+	frameWidth := evenDimension(float64(frameHeight) * 16 / 9)
+	geometry := RenditionGeometry{Resolution: resolution, Height: frameHeight}
+
+	filter := ""
+	width, height := sourceWidth, sourceHeight
+	if crop != nil {
+		filter = fmt.Sprintf("crop=%d:%d:%d:%d,", crop.Width, crop.Height, crop.X, crop.Y)
+		width, height = crop.Width, crop.Height
+	}
+
+	switch {
+	case pad && (width <= 0 || height <= 0):
+		filter += fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=decrease:force_divisible_by=2", frameWidth, frameHeight)
+		filter += fmt.Sprintf(",pad=%d:%d:(ow-iw)/2:(oh-ih)/2", frameWidth, frameHeight)
+		geometry.Width = frameWidth
+	case pad:
+		scaledWidth, scaledHeight := frameWidth, evenDimension(float64(height)*float64(frameWidth)/float64(width))
+		if scaledHeight > frameHeight {
+			scaledWidth, scaledHeight = evenDimension(float64(width)*float64(frameHeight)/float64(height)), frameHeight
+		}
+		filter += fmt.Sprintf("scale=%d:%d,pad=%d:%d:(ow-iw)/2:(oh-ih)/2", scaledWidth, scaledHeight, frameWidth, frameHeight)
+		geometry.Width = frameWidth
+	case width <= 0 || height <= 0:
+		filter += fmt.Sprintf("scale=-2:%d", frameHeight)
+	default:
+		geometry.Width = evenDimension(float64(width) * float64(frameHeight) / float64(height))
+		filter += fmt.Sprintf("scale=%d:%d", geometry.Width, frameHeight)
+	}
+	geometry.Filter = filter + ",setsar=1"
+	return geometry
+}
+
+// ParseCropDetect returns the final cropdetect suggestion, or nil when nothing would be cropped
+func ParseCropDetect(r io.Reader, sourceWidth, sourceHeight int) (*CropArea, error) {
+	var crop *CropArea
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		match := cropPattern.FindStringSubmatch(scanner.Text())
+		if match == nil {
+			continue
+		}
+		values := make([]int, 4)
+		for i := range values {
+			values[i], _ = strconv.Atoi(match[i+1])
+		}
+		crop = &CropArea{Width: values[0], Height: values[1], X: values[2], Y: values[3]}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if crop == nil || crop.Width <= 0 || crop.Height <= 0 {
+		return nil, nil
+	}
+	if crop.Width >= sourceWidth && crop.Height >= sourceHeight {
+		return nil, nil
+	}
+	return crop, nil
+}
+
+// NewCropDetectCommand builds a pass that logs the black-bar free area of length seconds of the input from start
+func NewCropDetectCommand(policy PathPolicy, inputFile string, start, length float64) *FFmpegCommand {
+	return NewFFmpegCommand(policy).
+		Set("-ss", strconv.FormatFloat(start, 'f', 3, 64)).
+		Input(inputFile).
+		Set("-t", strconv.FormatFloat(length, 'f', 3, 64)).
+		Set("-vf", "cropdetect=limit=24:round=2:reset=0").
+		Flag("-an").
+		NullOutput()
+}
+
+// evenDimension rounds a frame dimension to the nearest even number, as 4:2:0 video requires
+func evenDimension(value float64) int {
+	n := int(value/2+0.5) * 2
+	if n < 2 {
+		return 2
+	}
+	return n
+}
@@ -0,0 +1,117 @@
+package domain
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPlanGeometry(t *testing.T) {
+	letterbox := &CropArea{Width: 1920, Height: 800, X: 0, Y: 140}
+
+	tests := []struct {
+		name                      string
+		sourceWidth, sourceHeight int
+		crop                      *CropArea
+		resolution                Resolution
+		pad                       bool
+		want                      RenditionGeometry
+	}{
+		{
+			name:        "widescreen source",
+			sourceWidth: 1920, sourceHeight: 1080, resolution: HD,
+			want: RenditionGeometry{Resolution: HD, Width: 1280, Height: 720, Filter: "scale=1280:720,setsar=1"},
+		},
+		{
+			name:        "width rounded to even",
+			sourceWidth: 1920, sourceHeight: 1080, resolution: SD,
+			want: RenditionGeometry{Resolution: SD, Width: 854, Height: 480, Filter: "scale=854:480,setsar=1"},
+		},
+		{
+			name:        "4:3 source keeps its aspect ratio",
+			sourceWidth: 1440, sourceHeight: 1080, resolution: HD,
+			want: RenditionGeometry{Resolution: HD, Width: 960, Height: 720, Filter: "scale=960:720,setsar=1"},
+		},
+		{
+			name:       "unknown source size",
+			resolution: FHD,
+			want:       RenditionGeometry{Resolution: FHD, Height: 1080, Filter: "scale=-2:1080,setsar=1"},
+		},
+		{
+			name:        "cropped before scaling",
+			sourceWidth: 1920, sourceHeight: 1080, crop: letterbox, resolution: FHD,
+			want: RenditionGeometry{Resolution: FHD, Width: 2592, Height: 1080, Filter: "crop=1920:800:0:140,scale=2592:1080,setsar=1"},
+		},
+		{
+			name:        "4:3 source pillarboxed",
+			sourceWidth: 1440, sourceHeight: 1080, resolution: HD, pad: true,
+			want: RenditionGeometry{Resolution: HD, Width: 1280, Height: 720, Filter: "scale=960:720,pad=1280:720:(ow-iw)/2:(oh-ih)/2,setsar=1"},
+		},
+		{
+			name:        "cropped source letterboxed",
+			sourceWidth: 1920, sourceHeight: 1080, crop: letterbox, resolution: HD, pad: true,
+			want: RenditionGeometry{Resolution: HD, Width: 1280, Height: 720, Filter: "crop=1920:800:0:140,scale=1280:534,pad=1280:720:(ow-iw)/2:(oh-ih)/2,setsar=1"},
+		},
+		{
+			name:       "padded without a source size",
+			resolution: HD, pad: true,
+			want: RenditionGeometry{Resolution: HD, Width: 1280, Height: 720, Filter: "scale=1280:720:force_original_aspect_ratio=decrease:force_divisible_by=2,pad=1280:720:(ow-iw)/2:(oh-ih)/2,setsar=1"},
+		},
+		{
+			name:        "unknown resolution falls back to 720p",
+			sourceWidth: 1920, sourceHeight: 1080, resolution: "360p",
+			want: RenditionGeometry{Resolution: "360p", Width: 1280, Height: 720, Filter: "scale=1280:720,setsar=1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := PlanGeometry(tt.sourceWidth, tt.sourceHeight, tt.crop, tt.resolution, tt.pad)
+			if got != tt.want {
+				t.Errorf("PlanGeometry() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCropDetect(t *testing.T) {
+	line := func(crop string) string {
+		return "[Parsed_cropdetect_0 @ 0x5581] x1:0 x2:1919 y1:140 y2:939 w:1920 h:800 x:0 y:140 pts:1001 t:0.041 " + crop + "\n"
+	}
+
+	tests := []struct {
+		name   string
+		output string
+		want   *CropArea
+	}{
+		{
+			name:   "last suggestion wins",
+			output: "frame=1\n" + line("crop=1920:816:0:132") + line("crop=1920:800:0:140"),
+			want:   &CropArea{Width: 1920, Height: 800, X: 0, Y: 140},
+		},
+		{
+			name:   "no black bars",
+			output: line("crop=1920:1080:0:0"),
+		},
+		{
+			name:   "empty suggestion",
+			output: line("crop=0:0:0:0"),
+		},
+		{
+			name:   "no cropdetect output",
+			output: "Stream #0:0: Video: h264, 1920x1080\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseCropDetect(strings.NewReader(tt.output), 1920, 1080)
+			if err != nil {
+				t.Fatalf("ParseCropDetect() = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseCropDetect() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
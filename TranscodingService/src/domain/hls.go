@@ -0,0 +1,140 @@
+package domain
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// NewHLSRenditionCommand builds the encode that segments one rendition into an HLS media playlist
+func NewHLSRenditionCommand(policy PathPolicy, inputFile string, rendition Rendition) *FFmpegCommand {
+	cmd := NewFFmpegCommand(policy).Input(inputFile)
+	addHLSOutput(cmd, rendition, "")
+	return cmd
+}
+
+// addHLSOutput adds the segmenting of one rendition into an HLS media playlist as an output of cmd
+func addHLSOutput(cmd *FFmpegCommand, rendition Rendition, videoLabel string) {
+	queueSegmentedEncode(cmd, HLS, rendition, videoLabel)
+	cmd.Set("-f", "hls").
+		Set("-hls_time", fmt.Sprint(segmentSeconds)).
+		Set("-hls_playlist_type", "vod").
+		SetPath("-hls_segment_filename", filepath.Join(filepath.Dir(rendition.OutputFile), "segment_%05d.ts")).
+		Output(rendition.OutputFile)
+}
+
+// NewHLSAudioCommand builds the encode of the nth audio track of a job into an audio-only media playlist
+func NewHLSAudioCommand(policy PathPolicy, inputFile string, rendition Rendition, n int, outputFile string) *FFmpegCommand {
+	cmd := NewFFmpegCommand(policy).Input(inputFile)
+	if rendition.Audio == nil || n >= len(rendition.Audio.Tracks) {
+		cmd.fail(fmt.Errorf("rendition %s has no audio track %d", rendition.Resolution, n))
+		return cmd
+	}
+	mapAudioTrack(cmd, 0, rendition.Audio, rendition.Audio.Tracks[n], 0)
+	setAudioEncoder(cmd, rendition)
+	return cmd.Flag("-vn").
+		Set("-f", "hls").
+		Set("-hls_time", fmt.Sprint(segmentSeconds)).
+		Set("-hls_playlist_type", "vod").
+		SetPath("-hls_segment_filename", filepath.Join(filepath.Dir(outputFile), "segment_%05d.ts")).
+		Output(outputFile)
+}
+
+// MasterPlaylist renders an HLS master playlist of the completed renditions, alternate audio and subtitle tracks
+func MasterPlaylist(manifestPath string, renditions []Rendition, subtitles []SubtitleTrack) (string, error) {
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-INDEPENDENT-SEGMENTS\n")
+
+	subtitleGroup := ""
+	for _, track := range subtitles {
+		if track.Playlist == "" {
+			continue
+		}
+		uri, err := filepath.Rel(filepath.Dir(manifestPath), track.Playlist)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&b, "#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID=\"subs\",NAME=%q,LANGUAGE=%q,DEFAULT=%s,AUTOSELECT=YES,URI=%q\n",
+			track.name(), track.Language, yesNo(track.Default), filepath.ToSlash(uri))
+		subtitleGroup = `,SUBTITLES="subs"`
+	}
+
+	audioGroup := ""
+	for _, rendition := range renditions {
+		if rendition.Status != RenditionCompleted || rendition.Audio == nil || len(rendition.Audio.Tracks) < 2 {
+			continue
+		}
+		channels := ""
+		if rendition.Audio.Channels > 0 {
+			channels = fmt.Sprintf(",CHANNELS=\"%d\"", rendition.Audio.Channels)
+		}
+		names := make(map[string]bool)
+		for n, track := range rendition.Audio.Tracks {
+			name := track.name()
+			if names[name] {
+				name = fmt.Sprintf("%s %d", name, n+1)
+			}
+			names[name] = true
+			if n == 0 {
+				fmt.Fprintf(&b, "#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID=\"audio\",NAME=%q,LANGUAGE=%q,DEFAULT=YES,AUTOSELECT=YES%s\n",
+					name, track.Language, channels)
+				continue
+			}
+			if track.Playlist == "" {
+				continue
+			}
+			uri, err := filepath.Rel(filepath.Dir(manifestPath), track.Playlist)
+			if err != nil {
+				return "", err
+			}
+			fmt.Fprintf(&b, "#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID=\"audio\",NAME=%q,LANGUAGE=%q,DEFAULT=NO,AUTOSELECT=YES%s,URI=%q\n",
+				name, track.Language, channels, filepath.ToSlash(uri))
+		}
+		audioGroup = `,AUDIO="audio"`
+		break
+	}
+
+	variants := 0
+	for _, rendition := range renditions {
+		if rendition.Status != RenditionCompleted {
+			continue
+		}
+		kbps, err := ParseBitrate(rendition.Bitrate)
+		if err != nil {
+			return "", fmt.Errorf("rendition %s has no usable bitrate: %v", rendition.Resolution, err)
+		}
+		uri, err := filepath.Rel(filepath.Dir(manifestPath), rendition.OutputFile)
+		if err != nil {
+			return "", err
+		}
+
+		fmt.Fprintf(&b, "#EXT-X-STREAM-INF:BANDWIDTH=%d,RESOLUTION=%s,CODECS=\"%s,%s\"%s%s\n%s\n",
+			(kbps+rendition.audioKbps())*1000, rendition.frameSize(), videoCodecString(rendition.VideoCodec, rendition.Resolution, rendition.Profile.TenBit()), audioCodecString(rendition.AudioCodec), audioGroup, subtitleGroup, filepath.ToSlash(uri))
+		variants++
+	}
+	if variants == 0 {
+		return "", fmt.Errorf("no completed renditions to list in %s", manifestPath)
+	}
+	return b.String(), nil
+}
+
+// WriteMasterPlaylist writes the master playlist for renditions and subtitles to manifestPath
+func WriteMasterPlaylist(manifestPath string, renditions []Rendition, subtitles []SubtitleTrack) error {
+	playlist, err := MasterPlaylist(manifestPath, renditions, subtitles)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(manifestPath, []byte(playlist), 0644); err != nil {
+		return fmt.Errorf("failed to write master playlist: %v", err)
+	}
+	return nil
+}
+
+// yesNo renders a boolean playlist attribute
+func yesNo(value bool) string {
+	if value {
+		return "YES"
+	}
+	return "NO"
+}
@@ -0,0 +1,78 @@
+package domain
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMasterPlaylist(t *testing.T) {
+	hd := Rendition{Resolution: HD, Bitrate: "2500k", VideoCodec: H264, AudioCodec: AAC, OutputFile: "/out/720p/index.m3u8", Status: RenditionCompleted, Width: 1280, Height: 720}
+	fhd := Rendition{Resolution: FHD, Bitrate: "5000k", VideoCodec: H264, AudioCodec: AAC, OutputFile: "/out/1080p/index.m3u8", Status: RenditionFailed}
+	withAudio := hd
+	withAudio.Audio = &AudioPlan{Tracks: []AudioTrack{{Language: "en"}, {Language: "fr", Playlist: "/out/audio_2/index.m3u8"}}, Channels: 2}
+	badBitrate := hd
+	badBitrate.Bitrate = ""
+
+	const header = "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-INDEPENDENT-SEGMENTS\n"
+	tests := []struct {
+		name       string
+		renditions []Rendition
+		subtitles  []SubtitleTrack
+		want       string
+		wantErr    string
+	}{
+		{
+			name:       "completed renditions only",
+			renditions: []Rendition{hd, fhd},
+			want: header +
+				"#EXT-X-STREAM-INF:BANDWIDTH=2628000,RESOLUTION=1280x720,CODECS=\"avc1.64001f,mp4a.40.2\"\n" +
+				"720p/index.m3u8\n",
+		},
+		{
+			name:       "subtitle group",
+			renditions: []Rendition{hd},
+			subtitles:  []SubtitleTrack{{Language: "en", Playlist: "/out/subtitles/en.m3u8", Default: true}, {Language: "de"}},
+			want: header +
+				"#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID=\"subs\",NAME=\"en\",LANGUAGE=\"en\",DEFAULT=YES,AUTOSELECT=YES,URI=\"subtitles/en.m3u8\"\n" +
+				"#EXT-X-STREAM-INF:BANDWIDTH=2628000,RESOLUTION=1280x720,CODECS=\"avc1.64001f,mp4a.40.2\",SUBTITLES=\"subs\"\n" +
+				"720p/index.m3u8\n",
+		},
+		{
+			name:       "alternate audio group",
+			renditions: []Rendition{withAudio},
+			want: header +
+				"#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID=\"audio\",NAME=\"en\",LANGUAGE=\"en\",DEFAULT=YES,AUTOSELECT=YES,CHANNELS=\"2\"\n" +
+				"#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID=\"audio\",NAME=\"fr\",LANGUAGE=\"fr\",DEFAULT=NO,AUTOSELECT=YES,CHANNELS=\"2\",URI=\"audio_2/index.m3u8\"\n" +
+				"#EXT-X-STREAM-INF:BANDWIDTH=2628000,RESOLUTION=1280x720,CODECS=\"avc1.64001f,mp4a.40.2\",AUDIO=\"audio\"\n" +
+				"720p/index.m3u8\n",
+		},
+		{
+			name:       "nothing completed",
+			renditions: []Rendition{fhd},
+			wantErr:    "no completed renditions",
+		},
+		{
+			name:       "missing bitrate",
+			renditions: []Rendition{badBitrate},
+			wantErr:    "no usable bitrate",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := MasterPlaylist("/out/master.m3u8", tt.renditions, tt.subtitles)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("MasterPlaylist() = %v, want an error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("MasterPlaylist() = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("MasterPlaylist() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
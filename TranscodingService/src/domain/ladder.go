@@ -0,0 +1,217 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// RenditionStatus is the state of a single output in a multi-rendition job
+type RenditionStatus string
+
+const (
+	RenditionQueued    RenditionStatus = "queued"
+	RenditionRunning   RenditionStatus = "running"
+	RenditionCompleted RenditionStatus = "completed"
+	RenditionFailed    RenditionStatus = "failed"
+	RenditionSkipped   RenditionStatus = "skipped"
+)
+
+// LadderRung requests one rendition of an adaptive bitrate ladder, its bitrate derived from the range when empty
+type LadderRung struct {
+	Resolution Resolution `json:"resolution"`
+	Bitrate    string     `json:"bitrate,omitempty"`
+}
+
+// Rendition is one output of a transcoding job and its progress
+type Rendition struct {
+	Resolution Resolution      `json:"resolution"`
+	Bitrate    string          `json:"bitrate,omitempty"`
+	VideoCodec VideoCodec      `json:"video_codec,omitempty"`
+	AudioCodec AudioCodec      `json:"audio_codec,omitempty"`
+	OutputFile string          `json:"output_file"`
+	Status     RenditionStatus `json:"status"`
+	Error      string          `json:"error,omitempty"`
+	Width      int             `json:"width,omitempty"` // output frame size, once planned from the source
+	Height     int             `json:"height,omitempty"`
+
+	Profile *EncodingProfile `json:"-"` // encoder settings, when the job selected a profile
+	Filter  string           `json:"-"` // video filter chain planned by PlanGeometry
+	Audio   *AudioPlan       `json:"-"` // audio tracks to carry, once planned from the source
+	TwoPass *TwoPassPlan     `json:"-"` // peak constraints and pass logs, when encoded in two passes
+}
+
+// ApplyGeometry records the planned frame size and filter chain on the rendition
+func (r *Rendition) ApplyGeometry(geometry RenditionGeometry) {
+	r.Width = geometry.Width
+	r.Height = geometry.Height
+	r.Filter = geometry.Filter
+}
+
+// videoFilter returns the rendition's filter chain, scaling to its height when none was planned
+func (r Rendition) videoFilter() string {
+	if r.Filter != "" {
+		return r.Filter
+	}
+	return PlanGeometry(0, 0, nil, r.Resolution, false).Filter
+}
+
+// frameSize returns the output frame size advertised in manifests
+func (r Rendition) frameSize() string {
+	if r.Width > 0 && r.Height > 0 {
+		return fmt.Sprintf("%dx%d", r.Width, r.Height)
+	}
+	return resolutionDimensions(r.Resolution)
+}
+
+// audioKbps returns the audio bitrate of the rendition in kbit/s
+func (r Rendition) audioKbps() int {
+	if r.Profile != nil && r.Profile.AudioBitrate != "" {
+		if kbps, err := ParseBitrate(r.Profile.AudioBitrate); err == nil {
+			return kbps
+		}
+	}
+	return audioBitrateKbps
+}
+
+// audioLayout returns the channel count and sample rate of the rendition's audio, zero to keep the source's
+func (r Rendition) audioLayout() (channels, sampleRate int) {
+	if r.Audio != nil {
+		return r.Audio.Channels, r.Audio.SampleRate
+	}
+	if r.Profile != nil {
+		return r.Profile.AudioChannels, r.Profile.AudioSampleRate
+	}
+	return 0, 0
+}
+
+// BitrateRange bounds the video bitrates a ladder may use, in kbit/s
+type BitrateRange struct {
+	MinKbps int
+	MaxKbps int
+}
+
+// standardLadder orders the supported resolutions from smallest to largest
+var standardLadder = []Resolution{SD, HD, FHD, UHD}
+
+// Height returns the frame height of the resolution in pixels
+func (r Resolution) Height() int {
+	switch r {
+	case SD:
+		return 480
+	case HD:
+		return 720
+	case FHD:
+		return 1080
+	case UHD:
+		return 2160
+	default:
+		return 0
+	}
+}
+
+// ParseBitrate converts a bitrate such as "2500k" or "8M" into kbit/s
+func ParseBitrate(bitrate string) (int, error) {
+	value := strings.TrimSpace(bitrate)
+	multiplier := 1.0 / 1000
+	switch {
+	case strings.HasSuffix(value, "k"), strings.HasSuffix(value, "K"):
+		multiplier = 1
+		value = value[:len(value)-1]
+	case strings.HasSuffix(value, "m"), strings.HasSuffix(value, "M"):
+		multiplier = 1000
+		value = value[:len(value)-1]
+	}
+
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil || number <= 0 {
+		return 0, fmt.Errorf("invalid bitrate: %q", bitrate)
+	}
+	return int(math.Round(number * multiplier)), nil
+}
+
+// FormatBitrate renders kbit/s the way ffmpeg options expect
+func FormatBitrate(kbps int) string {
+	return fmt.Sprintf("%dk", kbps)
+}
+
+// Validate checks that the range is usable
+func (b BitrateRange) Validate() error {
+	if b.MinKbps <= 0 || b.MaxKbps <= 0 {
+		return errors.New("bitrate range must be positive")
+	}
+	if b.MinKbps > b.MaxKbps {
+		return fmt.Errorf("bitrate range minimum %dk exceeds maximum %dk", b.MinKbps, b.MaxKbps)
+	}
+	return nil
+}
+
+// bitrateFor spreads the range geometrically from the smallest resolution to the largest
+func (b BitrateRange) bitrateFor(resolution Resolution) int {
+	steps := len(standardLadder) - 1
+	for i, r := range standardLadder {
+		if r == resolution {
+			ratio := float64(b.MaxKbps) / float64(b.MinKbps)
+			return int(math.Round(float64(b.MinKbps) * math.Pow(ratio, float64(i)/float64(steps))))
+		}
+	}
+	return b.MinKbps
+}
+
+// BuildLadder resolves requested rungs into renditions ordered from smallest to largest
+func BuildLadder(rungs []LadderRung, bitrates BitrateRange) ([]Rendition, error) {
+	if len(rungs) == 0 {
+		return nil, errors.New("ladder must have at least one rung")
+	}
+	if err := bitrates.Validate(); err != nil {
+		return nil, err
+	}
+
+	seen := make(map[Resolution]bool)
+	renditions := make([]Rendition, 0, len(rungs))
+	for _, rung := range rungs {
+		if !isSupportedResolution(rung.Resolution) {
+			return nil, errors.New("unsupported video resolution: " + string(rung.Resolution))
+		}
+		if seen[rung.Resolution] {
+			return nil, fmt.Errorf("ladder lists %s more than once", rung.Resolution)
+		}
+		seen[rung.Resolution] = true
+
+		kbps := bitrates.bitrateFor(rung.Resolution)
+		if rung.Bitrate != "" {
+			var err error
+			if kbps, err = ParseBitrate(rung.Bitrate); err != nil {
+				return nil, err
+			}
+			if kbps < bitrates.MinKbps || kbps > bitrates.MaxKbps {
+				return nil, fmt.Errorf("bitrate %s for %s is outside %dk-%dk", rung.Bitrate, rung.Resolution, bitrates.MinKbps, bitrates.MaxKbps)
+			}
+		}
+		renditions = append(renditions, Rendition{
+			Resolution: rung.Resolution,
+			Bitrate:    FormatBitrate(kbps),
+			Status:     RenditionQueued,
+		})
+	}
+
+	sort.Slice(renditions, func(i, j int) bool {
+		return renditions[i].Resolution.Height() < renditions[j].Resolution.Height()
+	})
+	return renditions, nil
+}
+
+// SkipAboveSource marks renditions taller than the source as skipped, always keeping the smallest
+func SkipAboveSource(renditions []Rendition, sourceHeight int) {
+	if sourceHeight <= 0 {
+		return
+	}
+	for i := range renditions {
+		if i > 0 && renditions[i].Resolution.Height() > sourceHeight && renditions[i].Status == RenditionQueued {
+			renditions[i].Status = RenditionSkipped
+		}
+	}
+}
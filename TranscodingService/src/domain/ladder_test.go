@@ -0,0 +1,119 @@
+package domain
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBuildLadder(t *testing.T) {
+	bitrates := BitrateRange{MinKbps: 1000, MaxKbps: 8000}
+
+	tests := []struct {
+		name     string
+		rungs    []LadderRung
+		bitrates BitrateRange
+		want     []Rendition
+		wantErr  string
+	}{
+		{
+			name:     "bitrates spread over the range",
+			rungs:    []LadderRung{{Resolution: UHD}, {Resolution: SD}, {Resolution: FHD}, {Resolution: HD}},
+			bitrates: bitrates,
+			want: []Rendition{
+				{Resolution: SD, Bitrate: "1000k", Status: RenditionQueued},
+				{Resolution: HD, Bitrate: "2000k", Status: RenditionQueued},
+				{Resolution: FHD, Bitrate: "4000k", Status: RenditionQueued},
+				{Resolution: UHD, Bitrate: "8000k", Status: RenditionQueued},
+			},
+		},
+		{
+			name:     "explicit bitrates kept",
+			rungs:    []LadderRung{{Resolution: FHD, Bitrate: "5M"}, {Resolution: HD, Bitrate: "2500k"}},
+			bitrates: bitrates,
+			want: []Rendition{
+				{Resolution: HD, Bitrate: "2500k", Status: RenditionQueued},
+				{Resolution: FHD, Bitrate: "5000k", Status: RenditionQueued},
+			},
+		},
+		{
+			name:     "no rungs",
+			bitrates: bitrates,
+			wantErr:  "at least one rung",
+		},
+		{
+			name:     "duplicate resolution",
+			rungs:    []LadderRung{{Resolution: HD}, {Resolution: HD, Bitrate: "3000k"}},
+			bitrates: bitrates,
+			wantErr:  "more than once",
+		},
+		{
+			name:     "unsupported resolution",
+			rungs:    []LadderRung{{Resolution: "360p"}},
+			bitrates: bitrates,
+			wantErr:  "unsupported video resolution",
+		},
+		{
+			name:     "bitrate above the range",
+			rungs:    []LadderRung{{Resolution: UHD, Bitrate: "20M"}},
+			bitrates: bitrates,
+			wantErr:  "outside 1000k-8000k",
+		},
+		{
+			name:     "malformed bitrate",
+			rungs:    []LadderRung{{Resolution: HD, Bitrate: "fast"}},
+			bitrates: bitrates,
+			wantErr:  "invalid bitrate",
+		},
+		{
+			name:     "inverted range",
+			rungs:    []LadderRung{{Resolution: HD}},
+			bitrates: BitrateRange{MinKbps: 8000, MaxKbps: 1000},
+			wantErr:  "exceeds maximum",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := BuildLadder(tt.rungs, tt.bitrates)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("BuildLadder() = %v, want an error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("BuildLadder() = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("BuildLadder() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseBitrate(t *testing.T) {
+	tests := []struct {
+		bitrate string
+		want    int
+		wantErr bool
+	}{
+		{bitrate: "2500k", want: 2500},
+		{bitrate: "2500K", want: 2500},
+		{bitrate: "1.5M", want: 1500},
+		{bitrate: "128000", want: 128},
+		{bitrate: " 8m ", want: 8000},
+		{bitrate: "0k", wantErr: true},
+		{bitrate: "-1M", wantErr: true},
+		{bitrate: "k", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.bitrate, func(t *testing.T) {
+			got, err := ParseBitrate(tt.bitrate)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("ParseBitrate(%q) = %d, %v, want %d, error %v", tt.bitrate, got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
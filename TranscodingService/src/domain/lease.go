@@ -0,0 +1,25 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// LeaseOptions sets how worker processes hold the jobs they claim from the repository
+type LeaseOptions struct {
+	Lease     time.Duration // a job is re-queued once its worker has not renewed it for this long
+	Heartbeat time.Duration // interval between renewals
+	Poll      time.Duration // interval between looks for a job while a worker is idle
+}
+
+// Validate checks that workers renew their leases well before they expire
+func (o LeaseOptions) Validate() error {
+	if o.Heartbeat <= 0 || o.Poll <= 0 {
+		return errors.New("worker heartbeat and poll intervals must be positive")
+	}
+	if o.Lease < 2*o.Heartbeat {
+		return fmt.Errorf("worker lease %s must last at least two heartbeats of %s", o.Lease, o.Heartbeat)
+	}
+	return nil
+}
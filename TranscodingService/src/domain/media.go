@@ -0,0 +1,187 @@
+package domain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidMedia is returned when an input cannot be read as a transcodable video
+var ErrInvalidMedia = errors.New("invalid media")
+
+// Stream types reported by ffprobe
+const (
+	VideoStream    = "video"
+	AudioStream    = "audio"
+	SubtitleStream = "subtitle"
+)
+
+// MediaInfo describes the container and streams of a media file as reported by ffprobe
+type MediaInfo struct {
+	Container       string        `json:"container"`
+	DurationSeconds float64       `json:"duration_seconds"`
+	Bitrate         int64         `json:"bitrate,omitempty"` // in bits per second
+	Size            int64         `json:"size,omitempty"`
+	Streams         []MediaStream `json:"streams"`
+}
+
+// MediaStream is one elementary stream of a media file
+type MediaStream struct {
+	Index         int     `json:"index"`
+	Type          string  `json:"type"`
+	Codec         string  `json:"codec"`
+	Profile       string  `json:"profile,omitempty"`
+	Width         int     `json:"width,omitempty"`
+	Height        int     `json:"height,omitempty"`
+	FrameRate     float64 `json:"frame_rate,omitempty"`
+	PixelFormat   string  `json:"pixel_format,omitempty"`
+	Bitrate       int64   `json:"bitrate,omitempty"` // in bits per second
+	Channels      int     `json:"channels,omitempty"`
+	ChannelLayout string  `json:"channel_layout,omitempty"`
+	SampleRate    int     `json:"sample_rate,omitempty"`
+	Language      string  `json:"language,omitempty"`
+	Title         string  `json:"title,omitempty"`
+	Default       bool    `json:"default,omitempty"`
+}
+
+// ffprobeOutput mirrors the parts of ffprobe -show_format -show_streams -of json that MediaInfo uses
+type ffprobeOutput struct {
+	Streams []struct {
+		Index         int               `json:"index"`
+		CodecType     string            `json:"codec_type"`
+		CodecName     string            `json:"codec_name"`
+		Profile       string            `json:"profile"`
+		Width         int               `json:"width"`
+		Height        int               `json:"height"`
+		AvgFrameRate  string            `json:"avg_frame_rate"`
+		RFrameRate    string            `json:"r_frame_rate"`
+		PixFmt        string            `json:"pix_fmt"`
+		BitRate       string            `json:"bit_rate"`
+		Channels      int               `json:"channels"`
+		ChannelLayout string            `json:"channel_layout"`
+		SampleRate    string            `json:"sample_rate"`
+		Tags          map[string]string `json:"tags"`
+		Disposition   map[string]int    `json:"disposition"`
+	} `json:"streams"`
+	Format struct {
+		FormatName string `json:"format_name"`
+		Duration   string `json:"duration"`
+		BitRate    string `json:"bit_rate"`
+		Size       string `json:"size"`
+	} `json:"format"`
+}
+
+// ParseProbeOutput builds a MediaInfo from ffprobe's JSON output
+func ParseProbeOutput(output []byte) (*MediaInfo, error) {
+	var probe ffprobeOutput
+	if err := json.Unmarshal(output, &probe); err != nil {
+		return nil, fmt.Errorf("could not parse ffprobe output: %v", err)
+	}
+
+	info := &MediaInfo{
+		Container: probe.Format.FormatName,
+		Bitrate:   parseInt(probe.Format.BitRate),
+		Size:      parseInt(probe.Format.Size),
+		Streams:   make([]MediaStream, 0, len(probe.Streams)),
+	}
+	info.DurationSeconds, _ = strconv.ParseFloat(probe.Format.Duration, 64)
+
+	for _, s := range probe.Streams {
+		frameRate := parseFrameRate(s.AvgFrameRate)
+		if frameRate == 0 {
+			frameRate = parseFrameRate(s.RFrameRate)
+		}
+		stream := MediaStream{
+			Index:         s.Index,
+			Type:          s.CodecType,
+			Codec:         s.CodecName,
+			Profile:       s.Profile,
+			Width:         s.Width,
+			Height:        s.Height,
+			PixelFormat:   s.PixFmt,
+			Bitrate:       parseInt(s.BitRate),
+			Channels:      s.Channels,
+			ChannelLayout: s.ChannelLayout,
+			SampleRate:    int(parseInt(s.SampleRate)),
+			Language:      s.Tags["language"],
+			Title:         s.Tags["title"],
+			Default:       s.Disposition["default"] == 1,
+		}
+		if s.CodecType == VideoStream {
+			stream.FrameRate = frameRate
+		}
+		info.Streams = append(info.Streams, stream)
+	}
+	return info, nil
+}
+
+// Duration returns the container duration
+func (m *MediaInfo) Duration() time.Duration {
+	return time.Duration(m.DurationSeconds * float64(time.Second))
+}
+
+// VideoStream returns the first video stream, ignoring attached pictures such as cover art
+func (m *MediaInfo) VideoStream() *MediaStream {
+	for i := range m.Streams {
+		if m.Streams[i].Type == VideoStream && m.Streams[i].Codec != "mjpeg" && m.Streams[i].Codec != "png" {
+			return &m.Streams[i]
+		}
+	}
+	return nil
+}
+
+// StreamsOfType returns every stream of the given type in file order
+func (m *MediaInfo) StreamsOfType(streamType string) []MediaStream {
+	var streams []MediaStream
+	for _, stream := range m.Streams {
+		if stream.Type == streamType {
+			streams = append(streams, stream)
+		}
+	}
+	return streams
+}
+
+// Validate rejects inputs a transcoding job could not produce video from
+func (m *MediaInfo) Validate() error {
+	video := m.VideoStream()
+	if video == nil {
+		return fmt.Errorf("%w: no video stream", ErrInvalidMedia)
+	}
+	if video.Codec == "" || video.Codec == "none" {
+		return fmt.Errorf("%w: video stream %d has no decodable codec", ErrInvalidMedia, video.Index)
+	}
+	if video.Width <= 0 || video.Height <= 0 {
+		return fmt.Errorf("%w: video stream %d has no frame size", ErrInvalidMedia, video.Index)
+	}
+	if m.DurationSeconds <= 0 {
+		return fmt.Errorf("%w: unknown or zero duration", ErrInvalidMedia)
+	}
+	return nil
+}
+
+// parseFrameRate converts an ffprobe rational such as "30000/1001" into frames per second
+func parseFrameRate(rate string) float64 {
+	num, den, ok := strings.Cut(rate, "/")
+	if !ok {
+		value, _ := strconv.ParseFloat(rate, 64)
+		return value
+	}
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0
+	}
+	d, err := strconv.ParseFloat(den, 64)
+	if err != nil || d == 0 {
+		return 0
+	}
+	return n / d
+}
+
+// parseInt reads an ffprobe numeric string, treating missing values as zero
+func parseInt(value string) int64 {
+	n, _ := strconv.ParseInt(value, 10, 64)
+	return n
+}
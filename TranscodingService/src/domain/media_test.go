@@ -0,0 +1,81 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseProbeOutput(t *testing.T) {
+	output := `{
+		"streams": [
+			{"index": 0, "codec_type": "video", "codec_name": "h264", "profile": "High", "width": 1920, "height": 1080,
+			 "avg_frame_rate": "0/0", "r_frame_rate": "30000/1001", "pix_fmt": "yuv420p", "bit_rate": "4500000"},
+			{"index": 1, "codec_type": "audio", "codec_name": "aac", "channels": 6, "channel_layout": "5.1", "sample_rate": "48000",
+			 "tags": {"language": "eng", "title": "Surround"}, "disposition": {"default": 1}},
+			{"index": 2, "codec_type": "subtitle", "codec_name": "subrip", "tags": {"language": "fre"}}
+		],
+		"format": {"format_name": "matroska,webm", "duration": "5400.250000", "bit_rate": "5000000", "size": "3375156250"}
+	}`
+
+	info, err := ParseProbeOutput([]byte(output))
+	if err != nil {
+		t.Fatalf("ParseProbeOutput() = %v", err)
+	}
+	if info.Container != "matroska,webm" || info.DurationSeconds != 5400.25 || info.Bitrate != 5000000 || info.Size != 3375156250 {
+		t.Errorf("format = %+v", info)
+	}
+
+	video := info.VideoStream()
+	if video == nil || video.Codec != "h264" || video.Width != 1920 || video.Height != 1080 || video.Bitrate != 4500000 {
+		t.Fatalf("VideoStream() = %+v", video)
+	}
+	if video.FrameRate < 29.96 || video.FrameRate > 29.98 {
+		t.Errorf("frame rate = %f, want 29.97 from r_frame_rate", video.FrameRate)
+	}
+
+	audio := info.StreamsOfType(AudioStream)
+	if len(audio) != 1 || audio[0].Channels != 6 || audio[0].SampleRate != 48000 || audio[0].Language != "eng" || audio[0].Title != "Surround" || !audio[0].Default {
+		t.Errorf("audio streams = %+v", audio)
+	}
+	if subtitles := info.StreamsOfType(SubtitleStream); len(subtitles) != 1 || subtitles[0].Language != "fre" || subtitles[0].FrameRate != 0 {
+		t.Errorf("subtitle streams = %+v", subtitles)
+	}
+
+	if _, err := ParseProbeOutput([]byte("not json")); err == nil {
+		t.Error("ParseProbeOutput() of malformed output succeeded")
+	}
+}
+
+func TestMediaInfoValidate(t *testing.T) {
+	video := MediaStream{Type: VideoStream, Codec: "h264", Width: 1280, Height: 720}
+	cover := MediaStream{Type: VideoStream, Codec: "mjpeg", Width: 600, Height: 600}
+
+	tests := []struct {
+		name  string
+		info  MediaInfo
+		valid bool
+	}{
+		{name: "playable video", info: MediaInfo{DurationSeconds: 60, Streams: []MediaStream{video}}, valid: true},
+		{name: "cover art ahead of the video", info: MediaInfo{DurationSeconds: 60, Streams: []MediaStream{cover, video}}, valid: true},
+		{name: "audio only", info: MediaInfo{DurationSeconds: 60, Streams: []MediaStream{{Type: AudioStream, Codec: "aac"}}}},
+		{name: "cover art only", info: MediaInfo{DurationSeconds: 60, Streams: []MediaStream{cover}}},
+		{name: "undecodable video", info: MediaInfo{DurationSeconds: 60, Streams: []MediaStream{{Type: VideoStream, Codec: "none", Width: 1280, Height: 720}}}},
+		{name: "no frame size", info: MediaInfo{DurationSeconds: 60, Streams: []MediaStream{{Type: VideoStream, Codec: "h264"}}}},
+		{name: "no duration", info: MediaInfo{Streams: []MediaStream{video}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.info.Validate()
+			if tt.valid {
+				if err != nil {
+					t.Errorf("Validate() = %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrInvalidMedia) {
+				t.Errorf("Validate() = %v, want %v", err, ErrInvalidMedia)
+			}
+		})
+	}
+}
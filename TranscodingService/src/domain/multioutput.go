@@ -0,0 +1,52 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DecodeSampleLength is how much of the source is decoded to estimate what decoding all of it costs
+const DecodeSampleLength = 30 * time.Second
+
+// EncodeStats records how a job's renditions were encoded and the CPU time that took
+type EncodeStats struct {
+	Invocations int     `json:"ffmpeg_invocations"`
+	SharedWith  int     `json:"renditions_sharing_decode,omitempty"` // renditions encoded from one decode
+	CPUSeconds  float64 `json:"cpu_seconds"`
+	// CPUSecondsSaved estimates the decoding avoided by encoding renditions from a shared decode
+	CPUSecondsSaved float64 `json:"cpu_seconds_saved,omitempty"`
+}
+
+// NewMultiRenditionCommand builds one encode that decodes the source once and writes every rendition as an output
+func NewMultiRenditionCommand(policy PathPolicy, format VideoFormat, inputFile string, renditions []Rendition) *FFmpegCommand {
+	cmd := NewFFmpegCommand(policy)
+	if len(renditions) < 2 {
+		cmd.fail(errors.New("a shared decode needs at least two renditions"))
+		return cmd
+	}
+	var graph strings.Builder
+	fmt.Fprintf(&graph, "[0:v:0]split=%d", len(renditions))
+	for i := range renditions {
+		fmt.Fprintf(&graph, "[split%d]", i)
+	}
+	for i, rendition := range renditions {
+		fmt.Fprintf(&graph, ";[split%d]%s[video%d]", i, rendition.videoFilter(), i)
+	}
+	cmd.Global("-filter_complex", graph.String()).Input(inputFile)
+	for i, rendition := range renditions {
+		addPackagedOutput(cmd, format, rendition, fmt.Sprintf("video%d", i))
+	}
+	return cmd
+}
+
+// NewDecodeSampleCommand builds a pass that only decodes the start of the source's video, to estimate its CPU cost
+func NewDecodeSampleCommand(policy PathPolicy, inputFile string) *FFmpegCommand {
+	return NewFFmpegCommand(policy).
+		Set("-t", strconv.FormatFloat(DecodeSampleLength.Seconds(), 'f', -1, 64)).
+		Input(inputFile).
+		Set("-map", "0:v:0").
+		NullOutput()
+}
@@ -0,0 +1,50 @@
+package domain
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestNewMultiRenditionCommand(t *testing.T) {
+	renditions := []Rendition{
+		{Resolution: FHD, Bitrate: "5000k", VideoCodec: H264, AudioCodec: AAC, OutputFile: "/out/movie_1080p.mp4"},
+		{Resolution: HD, Bitrate: "2500k", VideoCodec: H264, AudioCodec: AAC, OutputFile: "/out/movie_720p.mp4"},
+	}
+
+	args, err := NewMultiRenditionCommand(PathPolicy{}, MP4, "/in/movie.mkv", renditions).Build()
+	if err != nil {
+		t.Fatalf("Build() = %v", err)
+	}
+	joined := strings.Join(args, " ")
+	if inputs := strings.Count(joined, "-i "); inputs != 1 {
+		t.Errorf("command has %d inputs, want the source decoded once: %s", inputs, joined)
+	}
+	graph := "-filter_complex [0:v:0]split=2[split0][split1];[split0]" + renditions[0].videoFilter() + "[video0];[split1]" + renditions[1].videoFilter() + "[video1]"
+	if !strings.Contains(joined, graph) {
+		t.Errorf("command %s does not contain %s", joined, graph)
+	}
+	for i, rendition := range renditions {
+		label := fmt.Sprintf("-map [video%d]", i)
+		output := "file:" + rendition.OutputFile
+		at := strings.Index(joined, output)
+		if at < 0 || !strings.Contains(joined[:at], label) {
+			t.Errorf("output %s is not mapped from %s: %s", output, label, joined)
+		}
+	}
+
+	if _, err := NewMultiRenditionCommand(PathPolicy{}, MP4, "/in/movie.mkv", renditions[:1]).Build(); err == nil {
+		t.Error("Build() of a shared decode with one rendition succeeded")
+	}
+}
+
+func TestNewDecodeSampleCommand(t *testing.T) {
+	args, err := NewDecodeSampleCommand(PathPolicy{}, "/in/movie.mkv").Build()
+	if err != nil {
+		t.Fatalf("Build() = %v", err)
+	}
+	want := "-t 30 -i file:/in/movie.mkv -map 0:v:0 -f null -"
+	if got := strings.Join(args, " "); !strings.HasSuffix(got, want) {
+		t.Errorf("args = %s, want them to end with %s", got, want)
+	}
+}
@@ -0,0 +1,103 @@
+package domain
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+)
+
+// segmentSeconds is the target duration of each media segment of a streaming format
+const segmentSeconds = 6
+
+// audioBitrateKbps is the audio bitrate used when a job's profile does not set one
+const audioBitrateKbps = 128
+
+// IsStreaming reports whether the format is packaged as segments behind a manifest
+func (f VideoFormat) IsStreaming() bool {
+	return f == HLS || f == DASH
+}
+
+// ManifestPath returns where the top-level manifest of a streaming job in outputDir is written
+func (f VideoFormat) ManifestPath(outputDir string) string {
+	if f == DASH {
+		return filepath.Join(outputDir, "manifest.mpd")
+	}
+	return filepath.Join(outputDir, "master.m3u8")
+}
+
+// RenditionPath returns the per-rendition manifest of a streaming job, in the rendition's own directory
+func (f VideoFormat) RenditionPath(outputDir string, resolution Resolution) string {
+	if f == DASH {
+		return filepath.Join(outputDir, string(resolution), "stream.mpd")
+	}
+	return filepath.Join(outputDir, string(resolution), "index.m3u8")
+}
+
+// NewPackagedRenditionCommand builds the encode of one rendition in the given output format
+func NewPackagedRenditionCommand(policy PathPolicy, format VideoFormat, inputFile string, rendition Rendition) *FFmpegCommand {
+	cmd := NewFFmpegCommand(policy).Input(inputFile)
+	addPackagedOutput(cmd, format, rendition, "")
+	return cmd
+}
+
+// addPackagedOutput adds the encode of one rendition in the given format as an output of cmd
+func addPackagedOutput(cmd *FFmpegCommand, format VideoFormat, rendition Rendition, videoLabel string) {
+	switch format {
+	case HLS:
+		addHLSOutput(cmd, rendition, videoLabel)
+	case DASH:
+		addDASHOutput(cmd, rendition, videoLabel)
+	default:
+		addRenditionOutput(cmd, format, rendition, videoLabel)
+	}
+}
+
+// WriteManifest writes the top-level manifest of a streaming job once its renditions are encoded
+func WriteManifest(format VideoFormat, manifestPath string, renditions []Rendition, subtitles []SubtitleTrack, duration time.Duration) error {
+	switch format {
+	case HLS:
+		return WriteMasterPlaylist(manifestPath, renditions, subtitles)
+	case DASH:
+		return WriteMPD(manifestPath, renditions, subtitles, duration)
+	default:
+		return fmt.Errorf("%s output has no manifest", format)
+	}
+}
+
+// queueSegmentedEncode queues the encode options shared by every streaming format, with keyframes on segment boundaries
+func queueSegmentedEncode(cmd *FFmpegCommand, format VideoFormat, rendition Rendition, videoLabel string) {
+	maxTracks := -1
+	if format == HLS {
+		// Further tracks are encoded into their own playlists by NewHLSAudioCommand
+		maxTracks = 1
+	}
+	mapStreams(cmd, rendition, videoLabel, maxTracks)
+	setSegmentedVideo(cmd, format, rendition)
+	setAudioEncoder(cmd, rendition)
+	if channels, _ := rendition.audioLayout(); channels == 0 {
+		cmd.Set("-ac", "2")
+	}
+}
+
+// setSegmentedVideo queues the video encoder of a streaming rendition, constrained to its bitrate or two-pass peaks
+func setSegmentedVideo(cmd *FFmpegCommand, format VideoFormat, rendition Rendition) {
+	kbps, err := ParseBitrate(rendition.Bitrate)
+	if err != nil {
+		cmd.fail(fmt.Errorf("rendition %s needs a target bitrate: %v", rendition.Resolution, err))
+	}
+	setVideoEncoder(cmd, format, rendition)
+	if rendition.VideoCodec == H264 || rendition.VideoCodec == "" {
+		// Pin the profile and level the manifests advertise
+		level := codecLevel(rendition.Resolution)
+		cmd.Set("-profile:v", "high").Set("-level", fmt.Sprintf("%d.%d", level/10, level%10))
+	}
+	maxRate, bufSize := kbps, 2*kbps
+	if plan := rendition.TwoPass; plan != nil {
+		maxRate, bufSize = plan.MaxRateKbps, plan.BufferKbps
+	}
+	cmd.Set("-b:v", rendition.Bitrate).
+		Set("-maxrate", FormatBitrate(maxRate)).
+		Set("-bufsize", FormatBitrate(bufSize)).
+		Set("-force_key_frames", fmt.Sprintf("expr:gte(t,n_forced*%d)", segmentSeconds)).
+		Set("-sc_threshold", "0")
+}
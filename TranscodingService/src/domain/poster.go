@@ -0,0 +1,214 @@
+package domain
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// posterAnalysisWidth is the width frames are scaled to before scoring, which keeps analysis cheap
+	posterAnalysisWidth = 320
+	// posterMaxBlack is the share of near-black pixels, in percent, above which a frame is skipped
+	posterMaxBlack = 40
+	// posterMaxScene is the scene change score above which a frame is taken to be blurred or mid-transition
+	posterMaxScene = 0.3
+	// posterFilePattern names a candidate image by its rank and width
+	posterFilePattern = "poster_%d_%d.jpg"
+)
+
+// PosterOptions controls how poster frame candidates are sampled and rendered, zero fields taking the defaults
+type PosterOptions struct {
+	Candidates      int     `json:"candidates,omitempty"`
+	Widths          []int   `json:"widths,omitempty"` // every candidate is rendered at each width
+	IntervalSeconds float64 `json:"interval_seconds,omitempty"`
+}
+
+// WithDefaults fills the unset fields of o from defaults
+func (o PosterOptions) WithDefaults(defaults PosterOptions) PosterOptions {
+	if o.Candidates == 0 {
+		o.Candidates = defaults.Candidates
+	}
+	if len(o.Widths) == 0 {
+		o.Widths = defaults.Widths
+	}
+	if o.IntervalSeconds == 0 {
+		o.IntervalSeconds = defaults.IntervalSeconds
+	}
+	return o
+}
+
+// Validate checks that the options ask for a sensible number of images
+func (o PosterOptions) Validate() error {
+	if o.Candidates < 1 || o.Candidates > 20 {
+		return fmt.Errorf("poster candidates %d must be between 1 and 20", o.Candidates)
+	}
+	if o.IntervalSeconds <= 0 {
+		return errors.New("poster sampling interval must be positive")
+	}
+	if len(o.Widths) == 0 {
+		return errors.New("poster widths cannot be empty")
+	}
+	for _, width := range o.Widths {
+		if width < 16 || width > 7680 || width%2 != 0 {
+			return fmt.Errorf("poster width %d must be an even number between 16 and 7680", width)
+		}
+	}
+	return nil
+}
+
+// FrameScore is the analysis of one sampled frame
+type FrameScore struct {
+	TimeSeconds float64 `json:"time_seconds"`
+	Black       float64 `json:"black_percent"` // share of near-black pixels
+	Scene       float64 `json:"scene_score"`   // change from the previous frame, 0 to 1
+}
+
+// Usable reports whether the frame is neither mostly black nor caught in a cut or fast motion
+func (f FrameScore) Usable() bool {
+	return f.Black <= posterMaxBlack && f.Scene <= posterMaxScene
+}
+
+// Score ranks usable frames, favouring well lit, steady ones
+func (f FrameScore) Score() float64 {
+	return (1 - f.Black/100) * (1 - f.Scene)
+}
+
+// NewPosterAnalysisCommand builds the pass that logs the scene score and black share of one frame per interval
+func NewPosterAnalysisCommand(policy PathPolicy, inputFile string, interval float64) *FFmpegCommand {
+	filter := fmt.Sprintf("scale=%d:-2,select='gte(scene,0)',fps=1/%s,blackframe=amount=0:threshold=32,metadata=mode=print",
+		posterAnalysisWidth, strconv.FormatFloat(interval, 'f', -1, 64))
+	return NewFFmpegCommand(policy).
+		Input(inputFile).
+		Set("-vf", filter).
+		Flag("-an").
+		Flag("-sn").
+		NullOutput()
+}
+
+var (
+	posterTimePattern  = regexp.MustCompile(`pts_time:(\S+)`)
+	posterScenePattern = regexp.MustCompile(`lavfi\.scene_score=(\S+)`)
+	posterBlackPattern = regexp.MustCompile(`lavfi\.blackframe\.pblack=(\S+)`)
+)
+
+// ParsePosterAnalysis reads the frame metadata the analysis pass logs
+func ParsePosterAnalysis(r io.Reader) ([]FrameScore, error) {
+	var frames []FrameScore
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if m := posterTimePattern.FindStringSubmatch(line); m != nil {
+			t, err := strconv.ParseFloat(m[1], 64)
+			if err != nil {
+				continue
+			}
+			frames = append(frames, FrameScore{TimeSeconds: t})
+			continue
+		}
+		if len(frames) == 0 {
+			continue
+		}
+		current := &frames[len(frames)-1]
+		if m := posterScenePattern.FindStringSubmatch(line); m != nil {
+			current.Scene, _ = strconv.ParseFloat(m[1], 64)
+		} else if m := posterBlackPattern.FindStringSubmatch(line); m != nil {
+			current.Black, _ = strconv.ParseFloat(m[1], 64)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(frames) == 0 {
+		return nil, errors.New("poster analysis reported no frames")
+	}
+	return frames, nil
+}
+
+// SelectPosterFrames picks up to count of the best usable frames at least minGap seconds apart, best first
+func SelectPosterFrames(frames []FrameScore, count int, minGap float64) []FrameScore {
+	usable := make([]FrameScore, 0, len(frames))
+	for _, frame := range frames {
+		if frame.Usable() {
+			usable = append(usable, frame)
+		}
+	}
+	sort.SliceStable(usable, func(i, j int) bool {
+		return usable[i].Score() > usable[j].Score()
+	})
+
+	var picked []FrameScore
+	for _, frame := range usable {
+		if len(picked) == count {
+			break
+		}
+		near := false
+		for _, p := range picked {
+			if gap := frame.TimeSeconds - p.TimeSeconds; gap < minGap && gap > -minGap {
+				near = true
+				break
+			}
+		}
+		if !near {
+			picked = append(picked, frame)
+		}
+	}
+	return picked
+}
+
+// PosterImage is one rendering of a candidate frame
+type PosterImage struct {
+	Width int    `json:"width"`
+	File  string `json:"file"`
+}
+
+// PosterCandidate is a frame offered as a poster, with its renderings at each size
+type PosterCandidate struct {
+	Rank int `json:"rank"`
+	FrameScore
+	Images []PosterImage `json:"images"`
+}
+
+// PosterImages lists the files a candidate of the given rank is rendered to, never wider than the source
+func PosterImages(outputDir string, rank int, widths []int, sourceWidth int) []PosterImage {
+	var images []PosterImage
+	seen := make(map[int]bool)
+	for _, width := range widths {
+		if sourceWidth > 0 && width > sourceWidth {
+			width = sourceWidth - sourceWidth%2
+		}
+		if seen[width] {
+			continue
+		}
+		seen[width] = true
+		images = append(images, PosterImage{Width: width, File: filepath.Join(outputDir, fmt.Sprintf(posterFilePattern, rank, width))})
+	}
+	return images
+}
+
+// NewPosterExtractCommand builds the pass that decodes the frame at timeSeconds once and writes it at every size
+func NewPosterExtractCommand(policy PathPolicy, inputFile string, timeSeconds float64, images []PosterImage) *FFmpegCommand {
+	cmd := NewFFmpegCommand(policy).
+		Set("-ss", strconv.FormatFloat(timeSeconds, 'f', 3, 64)).
+		Input(inputFile)
+	for _, image := range images {
+		cmd.Set("-frames:v", "1").
+			Set("-vf", fmt.Sprintf("scale=%d:-2", image.Width)).
+			Set("-q:v", "2").
+			Set("-update", "1").
+			Flag("-an").
+			Output(image.File)
+	}
+	return cmd
+}
+
+// PosterFiles lists the candidate images in outputDir
+func PosterFiles(outputDir string) ([]string, error) {
+	return filepath.Glob(filepath.Join(outputDir, strings.NewReplacer("%d", "*").Replace(posterFilePattern)))
+}
@@ -0,0 +1,105 @@
+package domain
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParsePosterAnalysis(t *testing.T) {
+	output := strings.Join([]string{
+		"lavfi.scene_score=0.900000",
+		"[Parsed_metadata_4 @ 0x55d0] frame:0    pts:0       pts_time:0",
+		"[Parsed_metadata_4 @ 0x55d0] lavfi.scene_score=0.000000",
+		"[Parsed_metadata_4 @ 0x55d0] lavfi.blackframe.pblack=100",
+		"[Parsed_metadata_4 @ 0x55d0] frame:1    pts:10240   pts_time:10",
+		"[Parsed_metadata_4 @ 0x55d0] lavfi.scene_score=0.052000",
+		"[Parsed_metadata_4 @ 0x55d0] lavfi.blackframe.pblack=3",
+		"[Parsed_metadata_4 @ 0x55d0] frame:2    pts:20480   pts_time:20.5",
+		"[Parsed_metadata_4 @ 0x55d0] lavfi.scene_score=0.410000",
+	}, "\n")
+
+	got, err := ParsePosterAnalysis(strings.NewReader(output))
+	if err != nil {
+		t.Fatalf("ParsePosterAnalysis() = %v", err)
+	}
+	want := []FrameScore{{TimeSeconds: 0, Black: 100}, {TimeSeconds: 10, Black: 3, Scene: 0.052}, {TimeSeconds: 20.5, Scene: 0.41}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParsePosterAnalysis() = %+v, want %+v", got, want)
+	}
+
+	if _, err := ParsePosterAnalysis(strings.NewReader("Stream #0:0: Video: h264\n")); err == nil {
+		t.Error("ParsePosterAnalysis() of output without frames succeeded")
+	}
+}
+
+func TestSelectPosterFrames(t *testing.T) {
+	frames := []FrameScore{
+		{TimeSeconds: 0, Black: 100}, // fade in
+		{TimeSeconds: 10, Black: 5, Scene: 0.1},
+		{TimeSeconds: 20, Black: 2, Scene: 0.6}, // cut
+		{TimeSeconds: 30, Black: 1, Scene: 0.02},
+		{TimeSeconds: 35, Black: 0, Scene: 0.01}, // too close to 30
+		{TimeSeconds: 60, Black: 45, Scene: 0},   // mostly black
+		{TimeSeconds: 70, Black: 20, Scene: 0.2},
+	}
+
+	tests := []struct {
+		name  string
+		count int
+		gap   float64
+		want  []float64
+	}{
+		{name: "best first", count: 3, gap: 0, want: []float64{35, 30, 10}},
+		{name: "spaced apart", count: 3, gap: 15, want: []float64{35, 10, 70}},
+		{name: "fewer usable than asked for", count: 10, gap: 15, want: []float64{35, 10, 70}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []float64
+			for _, frame := range SelectPosterFrames(frames, tt.count, tt.gap) {
+				got = append(got, frame.TimeSeconds)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SelectPosterFrames() picked %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPosterImages(t *testing.T) {
+	got := PosterImages("/out/posters", 2, []int{640, 1920, 3840}, 1279)
+	want := []PosterImage{
+		{Width: 640, File: filepath.Join("/out/posters", "poster_2_640.jpg")},
+		{Width: 1278, File: filepath.Join("/out/posters", "poster_2_1278.jpg")},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("PosterImages() = %+v, want %+v", got, want)
+	}
+}
+
+func TestPosterOptionsValidate(t *testing.T) {
+	valid := PosterOptions{Candidates: 5, Widths: []int{640, 1280}, IntervalSeconds: 2}
+	tests := []struct {
+		name    string
+		options PosterOptions
+		wantErr bool
+	}{
+		{name: "valid", options: valid},
+		{name: "no candidates", options: PosterOptions{Widths: valid.Widths, IntervalSeconds: 2}, wantErr: true},
+		{name: "too many candidates", options: PosterOptions{Candidates: 21, Widths: valid.Widths, IntervalSeconds: 2}, wantErr: true},
+		{name: "no widths", options: PosterOptions{Candidates: 5, IntervalSeconds: 2}, wantErr: true},
+		{name: "odd width", options: PosterOptions{Candidates: 5, Widths: []int{641}, IntervalSeconds: 2}, wantErr: true},
+		{name: "no interval", options: PosterOptions{Candidates: 5, Widths: valid.Widths}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.options.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
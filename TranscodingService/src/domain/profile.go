@@ -0,0 +1,134 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrUnknownProfile is returned when a job names a profile that is not configured
+var ErrUnknownProfile = errors.New("unknown encoding profile")
+
+// EncodingProfile is a named set of encoder settings a job can select instead of the defaults
+type EncodingProfile struct {
+	Name            string     `json:"name"`
+	VideoCodec      VideoCodec `json:"video_codec"`
+	CRF             int        `json:"crf,omitempty"`
+	Bitrate         string     `json:"bitrate,omitempty"` // used instead of CRF when set
+	Preset          string     `json:"preset,omitempty"`
+	GOPSize         int        `json:"gop_size,omitempty"` // frames between keyframes
+	PixelFormat     string     `json:"pixel_format,omitempty"`
+	AudioCodec      AudioCodec `json:"audio_codec"`
+	AudioBitrate    string     `json:"audio_bitrate,omitempty"`
+	AudioChannels   int        `json:"audio_channels,omitempty"`
+	AudioSampleRate int        `json:"audio_sample_rate,omitempty"`
+}
+
+// x26Presets are the presets shared by libx264 and libx265
+var x26Presets = []string{"ultrafast", "superfast", "veryfast", "faster", "fast", "medium", "slow", "slower", "veryslow", "placebo"}
+
+// crfRanges bounds the CRF each video codec accepts
+var crfRanges = map[VideoCodec][2]int{
+	H264: {0, 51},
+	H265: {0, 51},
+	VP9:  {0, 63},
+	AV1:  {0, 63},
+}
+
+// Validate checks that every setting of the profile can be passed to ffmpeg
+func (p EncodingProfile) Validate() error {
+	if p.Name == "" {
+		return errors.New("profile name cannot be empty")
+	}
+	if _, ok := crfRanges[p.VideoCodec]; !ok {
+		return fmt.Errorf("profile %s: unknown video codec %q", p.Name, p.VideoCodec)
+	}
+	if p.AudioCodec != AAC && p.AudioCodec != Opus {
+		return fmt.Errorf("profile %s: unknown audio codec %q", p.Name, p.AudioCodec)
+	}
+
+	if p.CRF != 0 && p.Bitrate != "" {
+		return fmt.Errorf("profile %s: set either crf or bitrate, not both", p.Name)
+	}
+	if limits := crfRanges[p.VideoCodec]; p.CRF < limits[0] || p.CRF > limits[1] {
+		return fmt.Errorf("profile %s: crf %d is outside %d-%d for %s", p.Name, p.CRF, limits[0], limits[1], p.VideoCodec)
+	}
+	if p.Bitrate != "" {
+		if _, err := ParseBitrate(p.Bitrate); err != nil {
+			return fmt.Errorf("profile %s: %v", p.Name, err)
+		}
+	}
+
+	if p.Preset != "" {
+		if p.VideoCodec != H264 && p.VideoCodec != H265 {
+			return fmt.Errorf("profile %s: presets only apply to h264 and h265", p.Name)
+		}
+		if !containsString(x26Presets, p.Preset) {
+			return fmt.Errorf("profile %s: unknown preset %q", p.Name, p.Preset)
+		}
+	}
+	if p.GOPSize < 0 {
+		return fmt.Errorf("profile %s: gop_size cannot be negative", p.Name)
+	}
+
+	switch p.PixelFormat {
+	case "", "yuv420p":
+	case "yuv420p10le":
+		if p.VideoCodec == H264 {
+			return fmt.Errorf("profile %s: h264 output is limited to 8-bit yuv420p", p.Name)
+		}
+	default:
+		return fmt.Errorf("profile %s: unsupported pixel format %q", p.Name, p.PixelFormat)
+	}
+
+	if p.AudioBitrate != "" {
+		if _, err := ParseBitrate(p.AudioBitrate); err != nil {
+			return fmt.Errorf("profile %s: audio %v", p.Name, err)
+		}
+	}
+	if p.AudioChannels < 0 || p.AudioChannels > 8 {
+		return fmt.Errorf("profile %s: audio_channels must be between 1 and 8", p.Name)
+	}
+	if p.AudioSampleRate < 0 {
+		return fmt.Errorf("profile %s: audio_sample_rate cannot be negative", p.Name)
+	}
+	return nil
+}
+
+// TenBit reports whether the profile encodes 10-bit video
+func (p *EncodingProfile) TenBit() bool {
+	return p != nil && strings.Contains(p.PixelFormat, "10")
+}
+
+// SortedProfiles returns the profiles ordered by name
+func SortedProfiles(profiles map[string]EncodingProfile) []EncodingProfile {
+	sorted := make([]EncodingProfile, 0, len(profiles))
+	for _, profile := range profiles {
+		sorted = append(sorted, profile)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+	return sorted
+}
+
+// ApplyProfile takes the request's codecs from the profile, rejecting codecs that contradict it
+func (r *TranscodingRequest) ApplyProfile(profile EncodingProfile) error {
+	if r.VideoCodec != "" && r.VideoCodec != profile.VideoCodec {
+		return fmt.Errorf("%w: video codec %s conflicts with profile %s, which uses %s", ErrUnsupportedCodec, r.VideoCodec, profile.Name, profile.VideoCodec)
+	}
+	if r.AudioCodec != "" && r.AudioCodec != profile.AudioCodec {
+		return fmt.Errorf("%w: audio codec %s conflicts with profile %s, which uses %s", ErrUnsupportedCodec, r.AudioCodec, profile.Name, profile.AudioCodec)
+	}
+	r.VideoCodec = profile.VideoCodec
+	r.AudioCodec = profile.AudioCodec
+	return nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,55 @@
+package domain
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEncodingProfileValidate(t *testing.T) {
+	valid := EncodingProfile{Name: "web", VideoCodec: H264, CRF: 23, Preset: "medium", GOPSize: 48, AudioCodec: AAC, AudioBitrate: "128k", AudioChannels: 2, AudioSampleRate: 48000}
+	with := func(change func(*EncodingProfile)) EncodingProfile {
+		p := valid
+		change(&p)
+		return p
+	}
+
+	tests := []struct {
+		name    string
+		profile EncodingProfile
+		wantErr string
+	}{
+		{name: "valid", profile: valid},
+		{name: "bitrate instead of crf", profile: with(func(p *EncodingProfile) { p.CRF = 0; p.Bitrate = "4M" })},
+		{name: "10-bit h265", profile: with(func(p *EncodingProfile) { p.VideoCodec = H265; p.PixelFormat = "yuv420p10le" })},
+		{name: "vp9 crf above h264 range", profile: with(func(p *EncodingProfile) { p.VideoCodec = VP9; p.CRF = 60; p.Preset = "" })},
+		{name: "missing name", profile: with(func(p *EncodingProfile) { p.Name = "" }), wantErr: "name cannot be empty"},
+		{name: "unknown video codec", profile: with(func(p *EncodingProfile) { p.VideoCodec = "mpeg2" }), wantErr: "unknown video codec"},
+		{name: "unknown audio codec", profile: with(func(p *EncodingProfile) { p.AudioCodec = "mp3" }), wantErr: "unknown audio codec"},
+		{name: "crf and bitrate", profile: with(func(p *EncodingProfile) { p.Bitrate = "4M" }), wantErr: "either crf or bitrate"},
+		{name: "crf out of range", profile: with(func(p *EncodingProfile) { p.CRF = 52 }), wantErr: "outside 0-51"},
+		{name: "malformed bitrate", profile: with(func(p *EncodingProfile) { p.CRF = 0; p.Bitrate = "fast" }), wantErr: "invalid bitrate"},
+		{name: "preset on vp9", profile: with(func(p *EncodingProfile) { p.VideoCodec = VP9 }), wantErr: "presets only apply"},
+		{name: "unknown preset", profile: with(func(p *EncodingProfile) { p.Preset = "turbo" }), wantErr: "unknown preset"},
+		{name: "negative gop", profile: with(func(p *EncodingProfile) { p.GOPSize = -1 }), wantErr: "gop_size"},
+		{name: "10-bit h264", profile: with(func(p *EncodingProfile) { p.PixelFormat = "yuv420p10le" }), wantErr: "8-bit"},
+		{name: "unsupported pixel format", profile: with(func(p *EncodingProfile) { p.PixelFormat = "yuv444p" }), wantErr: "unsupported pixel format"},
+		{name: "malformed audio bitrate", profile: with(func(p *EncodingProfile) { p.AudioBitrate = "loud" }), wantErr: "audio invalid bitrate"},
+		{name: "too many channels", profile: with(func(p *EncodingProfile) { p.AudioChannels = 9 }), wantErr: "audio_channels"},
+		{name: "negative sample rate", profile: with(func(p *EncodingProfile) { p.AudioSampleRate = -1 }), wantErr: "audio_sample_rate"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.profile.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
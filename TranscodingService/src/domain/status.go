@@ -0,0 +1,129 @@
+package domain
+
+import (
+	"database/sql/driver"
+	"fmt"
+)
+
+// TranscodingStatus represents the current state of the transcoding process
+type TranscodingStatus string
+
+const (
+	Queued    TranscodingStatus = "queued"
+	Running   TranscodingStatus = "running"
+	Paused    TranscodingStatus = "paused"
+	Retrying  TranscodingStatus = "retrying"
+	Completed TranscodingStatus = "completed"
+	Failed    TranscodingStatus = "failed"
+	Cancelled TranscodingStatus = "cancelled"
+)
+
+// allowedTransitions lists, for every status, the statuses a job may move to next
+var allowedTransitions = map[TranscodingStatus][]TranscodingStatus{
+	Queued:    {Running, Paused, Cancelled, Failed},
+	Retrying:  {Running, Paused, Cancelled, Failed},
+	Running:   {Completed, Failed, Cancelled, Paused, Retrying},
+	Paused:    {Queued, Running, Cancelled, Failed},
+	Failed:    {Retrying},
+	Completed: {},
+	Cancelled: {},
+}
+
+// TransitionError reports a status change the job state machine does not allow
+type TransitionError struct {
+	From TranscodingStatus
+	To   TranscodingStatus
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("illegal job status transition from %s to %s", e.From, e.To)
+}
+
+// ParseTranscodingStatus converts a serialized status back into a TranscodingStatus
+func ParseTranscodingStatus(value string) (TranscodingStatus, error) {
+	status := TranscodingStatus(value)
+	if !status.IsValid() {
+		return "", fmt.Errorf("unknown job status: %s", value)
+	}
+	return status, nil
+}
+
+// IsValid reports whether s is one of the known statuses
+func (s TranscodingStatus) IsValid() bool {
+	_, ok := allowedTransitions[s]
+	return ok
+}
+
+// IsTerminal reports whether a job in status s has finished for good or until resubmitted
+func (s TranscodingStatus) IsTerminal() bool {
+	return s == Completed || s == Failed || s == Cancelled
+}
+
+// CanTransitionTo reports whether a job may move from s to next
+func (s TranscodingStatus) CanTransitionTo(next TranscodingStatus) bool {
+	for _, allowed := range allowedTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateTransition returns a *TransitionError when moving from s to next is not allowed
+func (s TranscodingStatus) ValidateTransition(next TranscodingStatus) error {
+	if !s.CanTransitionTo(next) {
+		return &TransitionError{From: s, To: next}
+	}
+	return nil
+}
+
+// Predecessors returns every status from which a job may move to s
+func (s TranscodingStatus) Predecessors() []TranscodingStatus {
+	var from []TranscodingStatus
+	for status := range allowedTransitions {
+		if status.CanTransitionTo(s) {
+			from = append(from, status)
+		}
+	}
+	return from
+}
+
+// String returns the serialized form of the status
+func (s TranscodingStatus) String() string {
+	return string(s)
+}
+
+// UnmarshalText rejects unknown statuses when decoding JSON or config
+func (s *TranscodingStatus) UnmarshalText(text []byte) error {
+	status, err := ParseTranscodingStatus(string(text))
+	if err != nil {
+		return err
+	}
+	*s = status
+	return nil
+}
+
+// Value stores the status in SQL as its string form
+func (s TranscodingStatus) Value() (driver.Value, error) {
+	return string(s), nil
+}
+
+// Scan reads a status stored by Value
+func (s *TranscodingStatus) Scan(src interface{}) error {
+	var value string
+	switch v := src.(type) {
+	case string:
+		value = v
+	case []byte:
+		value = string(v)
+	default:
+		return fmt.Errorf("cannot scan %T into TranscodingStatus", src)
+	}
+
+	status, err := ParseTranscodingStatus(value)
+	if err != nil {
+		return err
+	}
+	*s = status
+	return nil
+}
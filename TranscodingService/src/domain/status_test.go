@@ -0,0 +1,100 @@
+package domain
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestValidateTransition(t *testing.T) {
+	tests := []struct {
+		from, to TranscodingStatus
+		allowed  bool
+	}{
+		{Queued, Running, true},
+		{Queued, Paused, true},
+		{Queued, Cancelled, true},
+		{Queued, Completed, false},
+		{Running, Completed, true},
+		{Running, Retrying, true},
+		{Running, Running, false},
+		{Running, Queued, false},
+		{Paused, Queued, true},
+		{Paused, Running, true},
+		{Paused, Completed, false},
+		{Retrying, Running, true},
+		{Retrying, Completed, false},
+		{Failed, Retrying, true},
+		{Failed, Running, false},
+		{Completed, Retrying, false},
+		{Cancelled, Queued, false},
+		{TranscodingStatus("pending"), Running, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.from)+" to "+string(tt.to), func(t *testing.T) {
+			if got := tt.from.CanTransitionTo(tt.to); got != tt.allowed {
+				t.Errorf("CanTransitionTo() = %v, want %v", got, tt.allowed)
+			}
+			err := tt.from.ValidateTransition(tt.to)
+			if tt.allowed {
+				if err != nil {
+					t.Errorf("ValidateTransition() = %v, want nil", err)
+				}
+				return
+			}
+			var transitionErr *TransitionError
+			if !errors.As(err, &transitionErr) || transitionErr.From != tt.from || transitionErr.To != tt.to {
+				t.Errorf("ValidateTransition() = %v, want a TransitionError from %s to %s", err, tt.from, tt.to)
+			}
+		})
+	}
+}
+
+func TestPredecessors(t *testing.T) {
+	tests := []struct {
+		status TranscodingStatus
+		want   []TranscodingStatus
+	}{
+		{Queued, []TranscodingStatus{Paused}},
+		{Running, []TranscodingStatus{Paused, Queued, Retrying}},
+		{Paused, []TranscodingStatus{Queued, Retrying, Running}},
+		{Retrying, []TranscodingStatus{Failed, Running}},
+		{Completed, []TranscodingStatus{Running}},
+		{Failed, []TranscodingStatus{Paused, Queued, Retrying, Running}},
+		{Cancelled, []TranscodingStatus{Paused, Queued, Retrying, Running}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.status), func(t *testing.T) {
+			got := tt.status.Predecessors()
+			sort.Slice(got, func(i, j int) bool { return got[i] < got[j] })
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Predecessors() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTranscodingStatus(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    TranscodingStatus
+		wantErr bool
+	}{
+		{value: "queued", want: Queued},
+		{value: "cancelled", want: Cancelled},
+		{value: "pending", wantErr: true},
+		{value: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseTranscodingStatus(tt.value)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("ParseTranscodingStatus() = %q, %v, want %q, error %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
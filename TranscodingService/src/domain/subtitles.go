@@ -0,0 +1,142 @@
+package domain
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// hlsTimestampMap aligns WebVTT cues with HLS segments, which ffmpeg's mpegts muxer starts 126000 ticks (1.4s) in
+const hlsTimestampMap = "X-TIMESTAMP-MAP=MPEGTS:126000,LOCAL:00:00:00.000"
+
+// SubtitleSource is a sidecar subtitle file supplied with a job
+type SubtitleSource struct {
+	File     string `json:"file"`
+	Language string `json:"language,omitempty"` // guessed from names such as film.en.srt when empty
+	Title    string `json:"title,omitempty"`
+}
+
+// SubtitleTrack is a subtitle track of a job converted to WebVTT
+type SubtitleTrack struct {
+	Language string `json:"language"`
+	Title    string `json:"title,omitempty"`
+	Codec    string `json:"codec"`  // codec of the source track
+	Source   string `json:"source"` // sidecar file, or "stream N" of the input
+	File     string `json:"file"`
+	Playlist string `json:"playlist,omitempty"` // HLS media playlist wrapping File
+	Default  bool   `json:"default,omitempty"`
+}
+
+// textSubtitleCodecs are the subtitle codecs ffmpeg can convert to WebVTT without OCR
+var textSubtitleCodecs = map[string]bool{
+	"subrip":   true,
+	"srt":      true,
+	"ass":      true,
+	"ssa":      true,
+	"mov_text": true,
+	"webvtt":   true,
+	"text":     true,
+}
+
+// sidecarSubtitleExtensions are the sidecar formats a job accepts
+var sidecarSubtitleExtensions = []string{".srt", ".ass", ".ssa", ".vtt"}
+
+// IsTextSubtitle reports whether a subtitle codec can be converted to WebVTT
+func IsTextSubtitle(codec string) bool {
+	return textSubtitleCodecs[codec]
+}
+
+// Validate checks that the sidecar is in a format that can be converted
+func (s SubtitleSource) Validate() error {
+	if s.File == "" {
+		return fmt.Errorf("subtitle file cannot be empty")
+	}
+	ext := strings.ToLower(filepath.Ext(s.File))
+	for _, supported := range sidecarSubtitleExtensions {
+		if ext == supported {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported subtitle file %s, expected one of %s", s.File, strings.Join(sidecarSubtitleExtensions, ", "))
+}
+
+// LanguageOrGuess returns the sidecar's language, or the code before its extension, or "und"
+func (s SubtitleSource) LanguageOrGuess() string {
+	if s.Language != "" {
+		return s.Language
+	}
+	name := strings.TrimSuffix(filepath.Base(s.File), filepath.Ext(s.File))
+	if code := strings.ToLower(strings.TrimPrefix(filepath.Ext(name), ".")); len(code) == 2 || len(code) == 3 {
+		return code
+	}
+	return "und"
+}
+
+// SubtitleCharset returns the charset ffmpeg should decode a sidecar with, or "" for UTF-8 and marked UTF-16
+func SubtitleCharset(data []byte, fallback string) string {
+	if bytes.HasPrefix(data, []byte{0xFF, 0xFE}) || bytes.HasPrefix(data, []byte{0xFE, 0xFF}) || utf8.Valid(data) {
+		return ""
+	}
+	return fallback
+}
+
+// SubtitlePath returns where the track at position is written in dir
+func SubtitlePath(dir string, position int, language string) string {
+	return filepath.Join(dir, fmt.Sprintf("%d_%s.vtt", position, language))
+}
+
+// NewSubtitleCommand builds the conversion of one subtitle stream of inputFile to WebVTT
+func NewSubtitleCommand(policy PathPolicy, inputFile string, streamIndex int, charset, outputFile string) *FFmpegCommand {
+	cmd := NewFFmpegCommand(policy)
+	if charset != "" {
+		cmd.Set("-sub_charenc", charset)
+	}
+	return cmd.Input(inputFile).
+		Set("-map", fmt.Sprintf("0:%d", streamIndex)).
+		Set("-c:s", "webvtt").
+		Set("-f", "webvtt").
+		Output(outputFile)
+}
+
+// WriteHLSSubtitle maps a converted track's timestamps for HLS and returns the media playlist wrapping it
+func WriteHLSSubtitle(track SubtitleTrack, duration time.Duration) (string, error) {
+	data, err := os.ReadFile(track.File)
+	if err != nil {
+		return "", err
+	}
+	if !bytes.Contains(data, []byte("X-TIMESTAMP-MAP")) {
+		header, rest, _ := bytes.Cut(data, []byte("\n"))
+		var mapped bytes.Buffer
+		mapped.Write(header)
+		mapped.WriteString("\n" + hlsTimestampMap + "\n")
+		mapped.Write(rest)
+		if err := os.WriteFile(track.File, mapped.Bytes(), 0644); err != nil {
+			return "", fmt.Errorf("failed to write subtitle track: %v", err)
+		}
+	}
+
+	seconds := duration.Seconds()
+	if seconds <= 0 {
+		return "", fmt.Errorf("source duration is unknown, cannot write a playlist for %s", track.File)
+	}
+	playlist := fmt.Sprintf("#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:%d\n#EXT-X-PLAYLIST-TYPE:VOD\n#EXTINF:%.3f,\n%s\n#EXT-X-ENDLIST\n",
+		int(math.Ceil(seconds)), seconds, filepath.Base(track.File))
+	path := strings.TrimSuffix(track.File, filepath.Ext(track.File)) + ".m3u8"
+	if err := os.WriteFile(path, []byte(playlist), 0644); err != nil {
+		return "", fmt.Errorf("failed to write subtitle playlist: %v", err)
+	}
+	return path, nil
+}
+
+// name is how a track is labelled in a manifest
+func (t SubtitleTrack) name() string {
+	if t.Title != "" {
+		return t.Title
+	}
+	return t.Language
+}
@@ -0,0 +1,102 @@
+package domain
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSubtitleSourceValidate(t *testing.T) {
+	tests := []struct {
+		file    string
+		wantErr bool
+	}{
+		{file: "/in/movie.en.srt"},
+		{file: "/in/movie.ASS"},
+		{file: "/in/movie.vtt"},
+		{file: "/in/movie.sub", wantErr: true},
+		{file: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		if err := (SubtitleSource{File: tt.file}).Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("Validate(%q) = %v, want error %v", tt.file, err, tt.wantErr)
+		}
+	}
+}
+
+func TestLanguageOrGuess(t *testing.T) {
+	tests := []struct {
+		source SubtitleSource
+		want   string
+	}{
+		{source: SubtitleSource{File: "/in/movie.srt", Language: "pt-BR"}, want: "pt-BR"},
+		{source: SubtitleSource{File: "/in/movie.EN.srt"}, want: "en"},
+		{source: SubtitleSource{File: "/in/movie.fre.ass"}, want: "fre"},
+		{source: SubtitleSource{File: "/in/movie.srt"}, want: "und"},
+		{source: SubtitleSource{File: "/in/movie.final.srt"}, want: "und"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.source.LanguageOrGuess(); got != tt.want {
+			t.Errorf("LanguageOrGuess(%s) = %s, want %s", tt.source.File, got, tt.want)
+		}
+	}
+}
+
+func TestSubtitleCharset(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{name: "utf-8", data: []byte("1\n00:00:01,000 --> 00:00:02,000\nGrüße\n"), want: ""},
+		{name: "utf-16 with a byte order mark", data: []byte{0xFF, 0xFE, '1', 0}, want: ""},
+		{name: "latin-1", data: []byte("Gr\xfc\xdfe\n"), want: "CP1252"},
+	}
+
+	for _, tt := range tests {
+		if got := SubtitleCharset(tt.data, "CP1252"); got != tt.want {
+			t.Errorf("SubtitleCharset(%s) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWriteHLSSubtitle(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "1_en.vtt")
+	if err := os.WriteFile(file, []byte("WEBVTT\n\n00:00:01.000 --> 00:00:02.000\nHello\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	track := SubtitleTrack{Language: "en", File: file}
+
+	for i := 0; i < 2; i++ {
+		playlist, err := WriteHLSSubtitle(track, 90500*time.Millisecond)
+		if err != nil {
+			t.Fatalf("WriteHLSSubtitle() = %v", err)
+		}
+		if want := strings.TrimSuffix(file, ".vtt") + ".m3u8"; playlist != want {
+			t.Errorf("WriteHLSSubtitle() = %s, want %s", playlist, want)
+		}
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "WEBVTT\n" + hlsTimestampMap + "\n\n00:00:01.000 --> 00:00:02.000\nHello\n"; string(data) != want {
+		t.Errorf("mapped track =\n%s\nwant the timestamp map added once:\n%s", data, want)
+	}
+	playlist, err := os.ReadFile(strings.TrimSuffix(file, ".vtt") + ".m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:91\n#EXT-X-PLAYLIST-TYPE:VOD\n#EXTINF:90.500,\n1_en.vtt\n#EXT-X-ENDLIST\n"; string(playlist) != want {
+		t.Errorf("playlist =\n%s\nwant\n%s", playlist, want)
+	}
+
+	if _, err := WriteHLSSubtitle(track, 0); err == nil {
+		t.Error("WriteHLSSubtitle() without a duration succeeded")
+	}
+}
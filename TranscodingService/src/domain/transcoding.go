@@ -1,31 +1,24 @@
 package domain
 
 import (
+	"TranscodingService/src/storage"
 	"errors"
 	"fmt"
 	"os"
 	"os/exec"
-	"strings"
-)
-
-// TranscodingStatus represents the current state of the transcoding process
-type TranscodingStatus int
-
-const (
-	Queued TranscodingStatus = iota
-	InProgress
-	Completed
-	Failed
 )
 
 // VideoFormat represents different video formats supported for transcoding
 type VideoFormat string
 
 const (
-	MP4 VideoFormat = "mp4"
-	MKV VideoFormat = "mkv"
-	AVI VideoFormat = "avi"
-	MOV VideoFormat = "mov"
+	MP4  VideoFormat = "mp4"
+	MKV  VideoFormat = "mkv"
+	AVI  VideoFormat = "avi"
+	MOV  VideoFormat = "mov"
+	WebM VideoFormat = "webm"
+	HLS  VideoFormat = "hls"  // segmented renditions with a master playlist
+	DASH VideoFormat = "dash" // fragmented MP4 renditions with an MPD manifest
 )
 
 // Resolution defines different video resolutions
@@ -38,19 +31,73 @@ const (
 	UHD Resolution = "2160p"
 )
 
+// JobType selects what a job produces from its input
+type JobType string
+
+const (
+	TranscodeJob JobType = "transcode"
+	TrickplayJob JobType = "trickplay" // thumbnail sprite sheets and a WebVTT track for scrub-bar previews
+	PosterJob    JobType = "poster"    // scored poster frame candidates at several sizes
+)
+
+// JobOptions holds the settings specific to a job type, stored with the job
+type JobOptions struct {
+	Trickplay *TrickplayOptions `json:"trickplay,omitempty"`
+	Poster    *PosterOptions    `json:"poster,omitempty"`
+	Subtitles []SubtitleSource  `json:"subtitles,omitempty"`
+	Audio     *AudioOptions     `json:"audio,omitempty"`
+	TwoPass   bool              `json:"two_pass,omitempty"`
+	Remote    *RemoteFiles      `json:"remote,omitempty"`
+}
+
+// RemoteFiles are the storage URIs a job downloads its input from and uploads its outputs to
+type RemoteFiles struct {
+	Input     string            `json:"input,omitempty"`
+	Output    string            `json:"output,omitempty"`
+	Subtitles map[string]string `json:"subtitles,omitempty"` // sidecar URIs by the path they are staged at
+}
+
+// AudioOptions is a job's choice of audio tracks and normalization
+type AudioOptions struct {
+	Languages []string `json:"languages,omitempty"`
+	Normalize *bool    `json:"normalize,omitempty"`
+}
+
 // TranscodingRequest represents a transcoding job request
 type TranscodingRequest struct {
-	InputFile        string
-	OutputFile       string
-	TargetFormat     VideoFormat
-	TargetResolution Resolution
-	Status           TranscodingStatus
-	Progress         int // in percentage
-	ErrorMessage     string
+	Type             JobType           `json:"type,omitempty"` // defaults to transcode
+	VideoID          string            `json:"video_id"`
+	InputFile        string            `json:"input_file"`
+	OutputFile       string            `json:"output_file"`
+	TargetFormat     VideoFormat       `json:"target_format"`
+	VideoCodec       VideoCodec        `json:"video_codec,omitempty"` // defaults per target format
+	AudioCodec       AudioCodec        `json:"audio_codec,omitempty"`
+	Profile          string            `json:"profile,omitempty"` // named encoding profile from the config
+	TargetResolution Resolution        `json:"target_resolution,omitempty"`
+	Ladder           []LadderRung      `json:"ladder,omitempty"`    // replaces TargetResolution when set
+	Pad              bool              `json:"pad,omitempty"`       // letterbox into a 16:9 frame instead of keeping the source aspect ratio
+	AutoCrop         bool              `json:"auto_crop,omitempty"` // remove black bars before scaling
+	Trickplay        *TrickplayOptions `json:"trickplay,omitempty"` // sprite settings for trickplay jobs
+	Poster           *PosterOptions    `json:"poster,omitempty"`    // candidate settings for poster jobs
+	Subtitles        []SubtitleSource  `json:"subtitles,omitempty"` // sidecars converted to WebVTT along with embedded text tracks
+	AudioLanguages   []string          `json:"audio_languages,omitempty"`
+	NormalizeAudio   *bool             `json:"normalize_audio,omitempty"`
+	TwoPass          bool              `json:"two_pass,omitempty"`
+	Priority         int               `json:"priority"` // higher runs first
+	Status           TranscodingStatus `json:"status"`
+	Progress         int               `json:"progress"` // in percentage
+	ErrorMessage     string            `json:"error_message,omitempty"`
+}
+
+// TranscodingNotification is the payload an external encoder posts to report on a job
+type TranscodingNotification struct {
+	JobID   string            `json:"job_id"`
+	Status  TranscodingStatus `json:"status"`
+	Message string            `json:"message,omitempty"`
 }
 
 // Validate checks if the request has valid parameters
-func (r *TranscodingRequest) Validate() error {
+func (r *TranscodingRequest) Validate(policy PathPolicy) error {
 	if r.InputFile == "" {
 		return errors.New("input file cannot be empty")
 	}
@@ -59,35 +106,165 @@ func (r *TranscodingRequest) Validate() error {
 		return errors.New("output file cannot be empty")
 	}
 
+	switch r.JobType() {
+	case TranscodeJob:
+		if err := r.validateTranscode(policy); err != nil {
+			return err
+		}
+	case TrickplayJob:
+		if r.Trickplay != nil {
+			if err := r.Trickplay.Validate(); err != nil {
+				return err
+			}
+		}
+	case PosterJob:
+		if r.Poster != nil {
+			if err := r.Poster.Validate(); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported job type: %s", r.Type)
+	}
+
+	return checkLocalInput(policy, "input", r.InputFile)
+}
+
+// checkLocalInput checks that a local input lies under the input roots before looking for it, so that files outside them
+// are refused whether or not they exist. Inputs in storage are checked when they are staged.
+func checkLocalInput(policy PathPolicy, kind, path string) error {
+	if storage.IsURI(path) {
+		return nil
+	}
+	resolved, err := policy.ResolveInput(path)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(resolved); os.IsNotExist(err) {
+		return fmt.Errorf("%w: %s file does not exist: %s", ErrInvalidMedia, kind, path)
+	}
+	return nil
+}
+
+// JobType returns the type of job requested, defaulting to a transcode
+func (r *TranscodingRequest) JobType() JobType {
+	if r.Type == "" {
+		return TranscodeJob
+	}
+	return r.Type
+}
+
+// validateTranscode checks the output format, codecs and resolutions of a transcode
+func (r *TranscodingRequest) validateTranscode(policy PathPolicy) error {
 	if !isSupportedFormat(r.TargetFormat) {
 		return errors.New("unsupported video format: " + string(r.TargetFormat))
 	}
 
-	if !isSupportedResolution(r.TargetResolution) {
+	if err := CheckCodecs(r.TargetFormat, r.VideoCodecOrDefault(), r.AudioCodecOrDefault()); err != nil {
+		return err
+	}
+
+	if len(r.Ladder) == 0 && !isSupportedResolution(r.TargetResolution) {
 		return errors.New("unsupported video resolution: " + string(r.TargetResolution))
 	}
+	for _, rung := range r.Ladder {
+		if !isSupportedResolution(rung.Resolution) {
+			return errors.New("unsupported video resolution: " + string(rung.Resolution))
+		}
+	}
+	for _, subtitle := range r.Subtitles {
+		if err := subtitle.Validate(); err != nil {
+			return err
+		}
+		if err := checkLocalInput(policy, "subtitle", subtitle.File); err != nil {
+			return err
+		}
+	}
+	for _, language := range r.AudioLanguages {
+		if language == "" {
+			return errors.New("audio languages cannot be empty")
+		}
+	}
+	return nil
+}
+
+// OutputPath returns the output file name with the target format's extension
+func (r *TranscodingRequest) OutputPath() string {
+	if r.TargetFormat.IsStreaming() {
+		return r.TargetFormat.ManifestPath(r.OutputFile)
+	}
+	return fmt.Sprintf("%s.%s", r.OutputFile, r.TargetFormat)
+}
 
-	if _, err := os.Stat(r.InputFile); os.IsNotExist(err) {
-		return fmt.Errorf("input file does not exist: %s", r.InputFile)
+// VideoCodecOrDefault returns the requested video codec, or the target format's default
+func (r *TranscodingRequest) VideoCodecOrDefault() VideoCodec {
+	if r.VideoCodec != "" {
+		return r.VideoCodec
 	}
+	video, _ := DefaultCodecs(r.TargetFormat)
+	return video
+}
 
-	return nil
+// AudioCodecOrDefault returns the requested audio codec, or the target format's default
+func (r *TranscodingRequest) AudioCodecOrDefault() AudioCodec {
+	if r.AudioCodec != "" {
+		return r.AudioCodec
+	}
+	_, audio := DefaultCodecs(r.TargetFormat)
+	return audio
+}
+
+// Renditions expands the request into the outputs it should produce, one per ladder rung
+func (r *TranscodingRequest) Renditions(bitrates BitrateRange) ([]Rendition, error) {
+	rungs := r.Ladder
+	if len(rungs) == 0 {
+		if !r.TargetFormat.IsStreaming() {
+			return []Rendition{{
+				Resolution: r.TargetResolution,
+				VideoCodec: r.VideoCodecOrDefault(),
+				AudioCodec: r.AudioCodecOrDefault(),
+				OutputFile: r.OutputPath(),
+				Status:     RenditionQueued,
+			}}, nil
+		}
+		rungs = []LadderRung{{Resolution: r.TargetResolution}}
+	}
+
+	renditions, err := BuildLadder(rungs, bitrates)
+	if err != nil {
+		return nil, err
+	}
+	for i := range renditions {
+		renditions[i].VideoCodec = r.VideoCodecOrDefault()
+		renditions[i].AudioCodec = r.AudioCodecOrDefault()
+		if r.TargetFormat.IsStreaming() {
+			renditions[i].OutputFile = r.TargetFormat.RenditionPath(r.OutputFile, renditions[i].Resolution)
+		} else {
+			renditions[i].OutputFile = fmt.Sprintf("%s_%s.%s", r.OutputFile, renditions[i].Resolution, r.TargetFormat)
+		}
+	}
+	return renditions, nil
 }
 
 // StartTranscoding initializes and starts the transcoding process
-func (r *TranscodingRequest) StartTranscoding() error {
-	r.Status = InProgress
+func (r *TranscodingRequest) StartTranscoding(policy PathPolicy) error {
+	r.Status = Running
 
-	err := r.Validate()
+	err := r.Validate(policy)
 	if err != nil {
 		r.Status = Failed
 		r.ErrorMessage = err.Error()
 		return err
 	}
 
-	command := buildTranscodingCommand(r.InputFile, r.OutputFile, r.TargetFormat, r.TargetResolution)
+	args, err := NewTranscodingCommand(policy, r.InputFile, r.OutputPath(), r.TargetResolution).Build()
+	if err != nil {
+		r.Status = Failed
+		r.ErrorMessage = err.Error()
+		return err
+	}
 
-	if err := runCommand(command); err != nil {
+	if err := runCommand(args); err != nil {
 		r.Status = Failed
 		r.ErrorMessage = fmt.Sprintf("failed to transcode video: %v", err)
 		return err
@@ -98,30 +275,9 @@ func (r *TranscodingRequest) StartTranscoding() error {
 	return nil
 }
 
-// buildTranscodingCommand constructs the ffmpeg command to execute transcoding
-func buildTranscodingCommand(inputFile, outputFile string, format VideoFormat, resolution Resolution) string {
-	var resolutionOption string
-
-	switch resolution {
-	case SD:
-		resolutionOption = "640x480"
-	case HD:
-		resolutionOption = "1280x720"
-	case FHD:
-		resolutionOption = "1920x1080"
-	case UHD:
-		resolutionOption = "3840x2160"
-	default:
-		resolutionOption = "1280x720" // Default to HD
-	}
-
-	return fmt.Sprintf("ffmpeg -i %s -s %s -c:v libx264 -preset fast -crf 22 %s.%s", inputFile, resolutionOption, outputFile, format)
-}
-
-// runCommand executes the ffmpeg command
-func runCommand(command string) error {
-	cmdParts := strings.Split(command, " ")
-	cmd := exec.Command(cmdParts[0], cmdParts[1:]...)
+// runCommand executes ffmpeg with the given argument vector
+func runCommand(args []string) error {
+	cmd := exec.Command("ffmpeg", args...)
 
 	output, err := cmd.CombinedOutput()
 	if err != nil {
@@ -131,10 +287,15 @@ func runCommand(command string) error {
 	return nil
 }
 
+// SupportedFormats lists the container formats a job can target
+func SupportedFormats() []VideoFormat {
+	return []VideoFormat{MP4, MKV, AVI, MOV, WebM, HLS, DASH}
+}
+
 // isSupportedFormat checks if the provided format is supported
 func isSupportedFormat(format VideoFormat) bool {
 	switch format {
-	case MP4, MKV, AVI, MOV:
+	case MP4, MKV, AVI, MOV, WebM, HLS, DASH:
 		return true
 	default:
 		return false
@@ -154,6 +315,7 @@ func isSupportedResolution(resolution Resolution) bool {
 // TranscodingService handles multiple transcoding requests
 type TranscodingService struct {
 	Queue []*TranscodingRequest
+	Paths PathPolicy
 }
 
 // NewTranscodingService creates a new transcoding service
@@ -174,7 +336,7 @@ func (s *TranscodingService) AddRequest(inputFile, outputFile string, format Vid
 		Progress:         0,
 	}
 
-	err := request.Validate()
+	err := request.Validate(s.Paths)
 	if err != nil {
 		return nil, err
 	}
@@ -188,7 +350,7 @@ func (s *TranscodingService) ProcessQueue() {
 	for _, request := range s.Queue {
 		if request.Status == Queued {
 			fmt.Printf("Starting transcoding for file: %s\n", request.InputFile)
-			err := request.StartTranscoding()
+			err := request.StartTranscoding(s.Paths)
 			if err != nil {
 				fmt.Printf("Error: %s\n", request.ErrorMessage)
 			} else {
@@ -0,0 +1,121 @@
+package domain
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTranscodingRequestValidate(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "movie.mp4")
+	if err := os.WriteFile(input, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	sidecar := filepath.Join(dir, "movie.en.srt")
+	if err := os.WriteFile(sidecar, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	outside := t.TempDir()
+	secret := filepath.Join(outside, "secret.mp4")
+	if err := os.WriteFile(secret, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	policy := PathPolicy{InputRoots: []string{dir}}
+
+	tests := []struct {
+		name    string
+		request TranscodingRequest
+		wantErr string
+		wantIs  error
+	}{
+		{
+			name:    "local input",
+			request: TranscodingRequest{InputFile: input, OutputFile: "/out/movie", TargetFormat: MP4, TargetResolution: "720p"},
+		},
+		{
+			name:    "s3 input",
+			request: TranscodingRequest{InputFile: "s3://video-uploads/in/movie.mp4", OutputFile: "s3://video-uploads/out/movie", TargetFormat: HLS, TargetResolution: "720p"},
+		},
+		{
+			name:    "file URI input",
+			request: TranscodingRequest{InputFile: "file:///data/in/movie.mp4", OutputFile: "/out/movie", TargetFormat: MP4, TargetResolution: "720p"},
+		},
+		{
+			name: "sidecars in storage and on disk",
+			request: TranscodingRequest{
+				InputFile: "s3://video-uploads/in/movie.mp4", OutputFile: "/out/movie", TargetFormat: MP4, TargetResolution: "720p",
+				Subtitles: []SubtitleSource{{File: sidecar}, {File: "s3://video-uploads/in/movie.fr.srt"}},
+			},
+		},
+		{
+			name:    "trickplay from storage",
+			request: TranscodingRequest{Type: TrickplayJob, InputFile: "s3://video-uploads/in/movie.mp4", OutputFile: "s3://video-uploads/out/trickplay"},
+		},
+		{
+			name:    "missing local input",
+			request: TranscodingRequest{InputFile: filepath.Join(dir, "missing.mp4"), OutputFile: "/out/movie", TargetFormat: MP4, TargetResolution: "720p"},
+			wantErr: "input file does not exist",
+			wantIs:  ErrInvalidMedia,
+		},
+		{
+			name:    "existing input outside the roots",
+			request: TranscodingRequest{InputFile: secret, OutputFile: "/out/movie", TargetFormat: MP4, TargetResolution: "720p"},
+			wantErr: "outside the allowed roots",
+			wantIs:  ErrPathNotAllowed,
+		},
+		{
+			name:    "missing input outside the roots",
+			request: TranscodingRequest{InputFile: filepath.Join(outside, "missing.mp4"), OutputFile: "/out/movie", TargetFormat: MP4, TargetResolution: "720p"},
+			wantErr: "outside the allowed roots",
+			wantIs:  ErrPathNotAllowed,
+		},
+		{
+			name: "missing sidecar outside the roots",
+			request: TranscodingRequest{
+				InputFile: input, OutputFile: "/out/movie", TargetFormat: MP4, TargetResolution: "720p",
+				Subtitles: []SubtitleSource{{File: filepath.Join(outside, "missing.srt")}},
+			},
+			wantErr: "outside the allowed roots",
+			wantIs:  ErrPathNotAllowed,
+		},
+		{
+			name: "missing local sidecar",
+			request: TranscodingRequest{
+				InputFile: input, OutputFile: "/out/movie", TargetFormat: MP4, TargetResolution: "720p",
+				Subtitles: []SubtitleSource{{File: filepath.Join(dir, "missing.srt")}},
+			},
+			wantErr: "subtitle file does not exist",
+			wantIs:  ErrInvalidMedia,
+		},
+		{
+			name:    "no output",
+			request: TranscodingRequest{InputFile: input, TargetFormat: MP4, TargetResolution: "720p"},
+			wantErr: "output file cannot be empty",
+		},
+		{
+			name:    "unsupported resolution",
+			request: TranscodingRequest{InputFile: input, OutputFile: "/out/movie", TargetFormat: MP4, TargetResolution: "123p"},
+			wantErr: "unsupported video resolution",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.request.Validate(policy)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Validate() = %v, want an error containing %q", err, tt.wantErr)
+			}
+			if tt.wantIs != nil && !errors.Is(err, tt.wantIs) {
+				t.Errorf("Validate() = %v, want %v", err, tt.wantIs)
+			}
+		})
+	}
+}
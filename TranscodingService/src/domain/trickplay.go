@@ -0,0 +1,198 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// TrickplayTrackName is the WebVTT file a trickplay job writes into its output directory
+	TrickplayTrackName = "thumbnails.vtt"
+	// trickplaySpritePattern numbers the sprite sheets from 1, as the image2 muxer does
+	trickplaySpritePattern = "sprite_%03d.jpg"
+	maxTrickplayGrid       = 20
+)
+
+// TrickplayOptions controls how scrub-bar thumbnails are sampled and tiled, zero fields taking the defaults
+type TrickplayOptions struct {
+	IntervalSeconds float64 `json:"interval_seconds,omitempty"`
+	Columns         int     `json:"columns,omitempty"`
+	Rows            int     `json:"rows,omitempty"`
+	Width           int     `json:"width,omitempty"` // thumbnail width; the height follows the source aspect ratio
+}
+
+// WithDefaults fills the unset fields of o from defaults
+func (o TrickplayOptions) WithDefaults(defaults TrickplayOptions) TrickplayOptions {
+	if o.IntervalSeconds == 0 {
+		o.IntervalSeconds = defaults.IntervalSeconds
+	}
+	if o.Columns == 0 {
+		o.Columns = defaults.Columns
+	}
+	if o.Rows == 0 {
+		o.Rows = defaults.Rows
+	}
+	if o.Width == 0 {
+		o.Width = defaults.Width
+	}
+	return o
+}
+
+// Validate checks that the options describe a usable sprite grid
+func (o TrickplayOptions) Validate() error {
+	if o.IntervalSeconds <= 0 {
+		return errors.New("trickplay interval must be positive")
+	}
+	if o.Columns < 1 || o.Columns > maxTrickplayGrid || o.Rows < 1 || o.Rows > maxTrickplayGrid {
+		return fmt.Errorf("trickplay grid %dx%d must be between 1x1 and %dx%d", o.Columns, o.Rows, maxTrickplayGrid, maxTrickplayGrid)
+	}
+	if o.Width < 16 || o.Width > 1920 || o.Width%2 != 0 {
+		return fmt.Errorf("trickplay thumbnail width %d must be an even number between 16 and 1920", o.Width)
+	}
+	return nil
+}
+
+// TrickplayPlan is the thumbnail size and count worked out for one source
+type TrickplayPlan struct {
+	TrickplayOptions
+	Height     int
+	Thumbnails int
+	Duration   time.Duration
+}
+
+// PlanTrickplay sizes the thumbnails of a source and counts how many its duration yields
+func PlanTrickplay(options TrickplayOptions, sourceWidth, sourceHeight int, duration time.Duration) (TrickplayPlan, error) {
+	if err := options.Validate(); err != nil {
+		return TrickplayPlan{}, err
+	}
+	if sourceWidth <= 0 || sourceHeight <= 0 {
+		return TrickplayPlan{}, errors.New("trickplay thumbnails need the source frame size")
+	}
+	if duration <= 0 {
+		return TrickplayPlan{}, errors.New("trickplay thumbnails need the source duration")
+	}
+	return TrickplayPlan{
+		TrickplayOptions: options,
+		Height:           evenDimension(float64(options.Width) * float64(sourceHeight) / float64(sourceWidth)),
+		Thumbnails:       int(math.Ceil(duration.Seconds() / options.IntervalSeconds)),
+		Duration:         duration,
+	}, nil
+}
+
+// PerSheet is the number of thumbnails tiled into one sprite sheet
+func (p TrickplayPlan) PerSheet() int {
+	return p.Columns * p.Rows
+}
+
+// Held is how many of the planned thumbnails the given number of sprite sheets hold
+func (p TrickplayPlan) Held(sheets int) int {
+	if held := sheets * p.PerSheet(); held < p.Thumbnails {
+		return held
+	}
+	return p.Thumbnails
+}
+
+// NewTrickplayCommand builds the pass that tiles one thumbnail per interval into numbered JPEG sprite sheets
+func NewTrickplayCommand(policy PathPolicy, inputFile, outputDir string, plan TrickplayPlan) *FFmpegCommand {
+	filter := fmt.Sprintf("fps=1/%s,scale=%d:%d,tile=%dx%d",
+		strconv.FormatFloat(plan.IntervalSeconds, 'f', -1, 64), plan.Width, plan.Height, plan.Columns, plan.Rows)
+	return NewFFmpegCommand(policy).
+		Input(inputFile).
+		Set("-vf", filter).
+		Flag("-an").
+		Flag("-sn").
+		Set("-q:v", "4").
+		Set("-f", "image2").
+		Output(filepath.Join(outputDir, trickplaySpritePattern))
+}
+
+// TrickplaySprites lists the sprite sheets in outputDir in playback order
+func TrickplaySprites(outputDir string) ([]string, error) {
+	sprites, err := filepath.Glob(filepath.Join(outputDir, strings.Replace(trickplaySpritePattern, "%03d", "[0-9][0-9][0-9]*", 1)))
+	if err != nil {
+		return nil, err
+	}
+	// Numbers past 999 widen the name, so shorter names sort first
+	sort.Slice(sprites, func(i, j int) bool {
+		if len(sprites[i]) != len(sprites[j]) {
+			return len(sprites[i]) < len(sprites[j])
+		}
+		return sprites[i] < sprites[j]
+	})
+	return sprites, nil
+}
+
+// TrickplayTrack renders the WebVTT track mapping each interval of playback to its region of a sprite sheet
+func TrickplayTrack(plan TrickplayPlan, sprites []string) (string, error) {
+	count := plan.Held(len(sprites))
+	if count == 0 {
+		return "", errors.New("no trickplay sprites to reference")
+	}
+
+	var b strings.Builder
+	b.WriteString("WEBVTT\n")
+	interval := time.Duration(plan.IntervalSeconds * float64(time.Second))
+	for i := 0; i < count; i++ {
+		start := time.Duration(i) * interval
+		end := start + interval
+		if end > plan.Duration || i == count-1 {
+			end = plan.Duration
+		}
+		tile := i % plan.PerSheet()
+		fmt.Fprintf(&b, "\n%s --> %s\n%s#xywh=%d,%d,%d,%d\n",
+			vttTimestamp(start), vttTimestamp(end), filepath.Base(sprites[i/plan.PerSheet()]),
+			tile%plan.Columns*plan.Width, tile/plan.Columns*plan.Height, plan.Width, plan.Height)
+	}
+	return b.String(), nil
+}
+
+// WriteTrickplayTrack writes the WebVTT track for the sprites in outputDir and returns its path
+func WriteTrickplayTrack(outputDir string, plan TrickplayPlan, sprites []string) (string, error) {
+	track, err := TrickplayTrack(plan, sprites)
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(outputDir, TrickplayTrackName)
+	if err := os.WriteFile(path, []byte(track), 0644); err != nil {
+		return "", fmt.Errorf("failed to write trickplay track: %v", err)
+	}
+	return path, nil
+}
+
+// TrickplayArtifacts records where a trickplay job stored its track and sprites
+type TrickplayArtifacts struct {
+	TrackFile       string   `json:"track_file"`
+	Sprites         []string `json:"sprites"`
+	IntervalSeconds float64  `json:"interval_seconds"`
+	Columns         int      `json:"columns"`
+	Rows            int      `json:"rows"`
+	Width           int      `json:"width"`
+	Height          int      `json:"height"`
+	Thumbnails      int      `json:"thumbnails"`
+}
+
+// ArtifactDir is where artifacts named name are stored for a transcoded output
+func ArtifactDir(format VideoFormat, outputFile, name string) string {
+	if format.IsStreaming() {
+		return filepath.Join(filepath.Dir(outputFile), name)
+	}
+	return strings.TrimSuffix(outputFile, filepath.Ext(outputFile)) + "_" + name
+}
+
+// JobWorkspace is the scratch directory a job keeps intermediate files in, next to its output
+func JobWorkspace(format VideoFormat, outputFile, jobID string) string {
+	return filepath.Join(ArtifactDir(format, outputFile, "work"), jobID)
+}
+
+// vttTimestamp formats a duration as a WebVTT HH:MM:SS.mmm timestamp
+func vttTimestamp(d time.Duration) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
@@ -0,0 +1,117 @@
+package domain
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPlanTrickplay(t *testing.T) {
+	options := TrickplayOptions{IntervalSeconds: 10, Columns: 5, Rows: 5, Width: 160}
+
+	tests := []struct {
+		name                      string
+		options                   TrickplayOptions
+		sourceWidth, sourceHeight int
+		duration                  time.Duration
+		wantHeight, wantCount     int
+		wantErr                   bool
+	}{
+		{name: "widescreen source", options: options, sourceWidth: 1920, sourceHeight: 1080, duration: 95 * time.Second, wantHeight: 90, wantCount: 10},
+		{name: "height rounded to even", options: options, sourceWidth: 1920, sourceHeight: 800, duration: 100 * time.Second, wantHeight: 66, wantCount: 10},
+		{name: "fractional interval", options: TrickplayOptions{IntervalSeconds: 2.5, Columns: 4, Rows: 4, Width: 320}, sourceWidth: 1440, sourceHeight: 1080, duration: 11 * time.Second, wantHeight: 240, wantCount: 5},
+		{name: "unknown frame size", options: options, duration: time.Minute, wantErr: true},
+		{name: "unknown duration", options: options, sourceWidth: 1920, sourceHeight: 1080, wantErr: true},
+		{name: "grid too large", options: TrickplayOptions{IntervalSeconds: 10, Columns: 21, Rows: 5, Width: 160}, sourceWidth: 1920, sourceHeight: 1080, duration: time.Minute, wantErr: true},
+		{name: "odd width", options: TrickplayOptions{IntervalSeconds: 10, Columns: 5, Rows: 5, Width: 161}, sourceWidth: 1920, sourceHeight: 1080, duration: time.Minute, wantErr: true},
+		{name: "no interval", options: TrickplayOptions{Columns: 5, Rows: 5, Width: 160}, sourceWidth: 1920, sourceHeight: 1080, duration: time.Minute, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan, err := PlanTrickplay(tt.options, tt.sourceWidth, tt.sourceHeight, tt.duration)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("PlanTrickplay() = %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && (plan.Height != tt.wantHeight || plan.Thumbnails != tt.wantCount) {
+				t.Errorf("PlanTrickplay() = %d thumbnails of height %d, want %d of height %d", plan.Thumbnails, plan.Height, tt.wantCount, tt.wantHeight)
+			}
+		})
+	}
+}
+
+func TestTrickplayTrack(t *testing.T) {
+	plan, err := PlanTrickplay(TrickplayOptions{IntervalSeconds: 10, Columns: 2, Rows: 2, Width: 160}, 1920, 1080, 55*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	track, err := TrickplayTrack(plan, []string{"/out/sprite_001.jpg", "/out/sprite_002.jpg"})
+	if err != nil {
+		t.Fatalf("TrickplayTrack() = %v", err)
+	}
+	want := "WEBVTT\n" +
+		"\n00:00:00.000 --> 00:00:10.000\nsprite_001.jpg#xywh=0,0,160,90\n" +
+		"\n00:00:10.000 --> 00:00:20.000\nsprite_001.jpg#xywh=160,0,160,90\n" +
+		"\n00:00:20.000 --> 00:00:30.000\nsprite_001.jpg#xywh=0,90,160,90\n" +
+		"\n00:00:30.000 --> 00:00:40.000\nsprite_001.jpg#xywh=160,90,160,90\n" +
+		"\n00:00:40.000 --> 00:00:50.000\nsprite_002.jpg#xywh=0,0,160,90\n" +
+		"\n00:00:50.000 --> 00:00:55.000\nsprite_002.jpg#xywh=160,0,160,90\n"
+	if track != want {
+		t.Errorf("TrickplayTrack() =\n%s\nwant\n%s", track, want)
+	}
+
+	short, err := TrickplayTrack(plan, []string{"/out/sprite_001.jpg"})
+	if err != nil {
+		t.Fatalf("TrickplayTrack() = %v", err)
+	}
+	if cues := strings.Count(short, " --> "); cues != 4 || !strings.Contains(short, "00:00:30.000 --> 00:00:55.000") {
+		t.Errorf("TrickplayTrack() with one sheet =\n%s\nwant 4 cues, the last running to the end", short)
+	}
+
+	if _, err := TrickplayTrack(plan, nil); err == nil {
+		t.Error("TrickplayTrack() without sprites succeeded")
+	}
+}
+
+func TestTrickplaySprites(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"sprite_1000.jpg", "sprite_002.jpg", "sprite_999.jpg", "sprite_001.jpg", "poster.jpg", TrickplayTrackName} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := TrickplaySprites(dir)
+	if err != nil {
+		t.Fatalf("TrickplaySprites() = %v", err)
+	}
+	var names []string
+	for _, sprite := range got {
+		names = append(names, filepath.Base(sprite))
+	}
+	if want := []string{"sprite_001.jpg", "sprite_002.jpg", "sprite_999.jpg", "sprite_1000.jpg"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("TrickplaySprites() = %v, want %v", names, want)
+	}
+}
+
+func TestArtifactDir(t *testing.T) {
+	tests := []struct {
+		format     VideoFormat
+		outputFile string
+		want       string
+	}{
+		{MP4, "/out/movie.mp4", "/out/movie_trickplay"},
+		{HLS, "/out/movie/master.m3u8", "/out/movie/trickplay"},
+		{DASH, "/out/movie/manifest.mpd", "/out/movie/trickplay"},
+	}
+
+	for _, tt := range tests {
+		if got := ArtifactDir(tt.format, tt.outputFile, "trickplay"); got != filepath.FromSlash(tt.want) {
+			t.Errorf("ArtifactDir(%s, %s) = %s, want %s", tt.format, tt.outputFile, got, tt.want)
+		}
+	}
+}
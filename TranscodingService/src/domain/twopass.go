@@ -0,0 +1,105 @@
+package domain
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+)
+
+// TwoPassOptions sets the peak bitrate and decoder buffer of two-pass encodes relative to their average bitrate
+type TwoPassOptions struct {
+	MaxRateFactor float64 // peak bitrate as a multiple of the average
+	BufferFactor  float64 // decoder buffer size as a multiple of the average
+}
+
+// Validate checks that the options constrain encodes sensibly
+func (o TwoPassOptions) Validate() error {
+	if o.MaxRateFactor < 1 {
+		return fmt.Errorf("two-pass max rate factor %g must be at least 1", o.MaxRateFactor)
+	}
+	if o.BufferFactor <= 0 {
+		return fmt.Errorf("two-pass buffer factor %g must be positive", o.BufferFactor)
+	}
+	return nil
+}
+
+// TwoPassPlan is how a rendition is encoded in two passes, sharing statistics through LogFile
+type TwoPassPlan struct {
+	MaxRateKbps int
+	BufferKbps  int
+	LogFile     string // prefix of the pass log files, inside the job workspace
+	Pass        int    // 1 or 2, selected with Rendition.Pass
+}
+
+// Plan constrains a rendition's peaks relative to its average bitrate, keeping its pass logs in workspace
+func (o TwoPassOptions) Plan(rendition Rendition, workspace string) (*TwoPassPlan, error) {
+	kbps, err := ParseBitrate(rendition.Bitrate)
+	if err != nil {
+		return nil, fmt.Errorf("two-pass %s rendition needs a target bitrate: %v", rendition.Resolution, err)
+	}
+	return &TwoPassPlan{
+		MaxRateKbps: int(math.Round(float64(kbps) * o.MaxRateFactor)),
+		BufferKbps:  int(math.Round(float64(kbps) * o.BufferFactor)),
+		LogFile:     filepath.Join(workspace, "passlog_"+string(rendition.Resolution)),
+	}, nil
+}
+
+// TwoPassBitrate returns the average bitrate a two-pass rendition targets, which must lie within the range
+func (b BitrateRange) TwoPassBitrate(rendition Rendition) (string, error) {
+	if rendition.Bitrate == "" {
+		return FormatBitrate(b.bitrateFor(rendition.Resolution)), nil
+	}
+	kbps, err := ParseBitrate(rendition.Bitrate)
+	if err != nil {
+		return "", err
+	}
+	if kbps < b.MinKbps || kbps > b.MaxKbps {
+		return "", fmt.Errorf("two-pass bitrate %s for %s is outside %dk-%dk", rendition.Bitrate, rendition.Resolution, b.MinKbps, b.MaxKbps)
+	}
+	return rendition.Bitrate, nil
+}
+
+// Pass returns the rendition set up for pass n of its two-pass encode
+func (r Rendition) Pass(n int) Rendition {
+	if r.TwoPass != nil {
+		plan := *r.TwoPass
+		plan.Pass = n
+		r.TwoPass = &plan
+	}
+	return r
+}
+
+// NewFirstPassCommand builds the analysis pass of a rendition's two-pass encode, keeping only the pass log
+func NewFirstPassCommand(policy PathPolicy, format VideoFormat, inputFile string, rendition Rendition) *FFmpegCommand {
+	cmd := NewFFmpegCommand(policy).Input(inputFile)
+	if rendition.TwoPass == nil || rendition.TwoPass.Pass != 1 {
+		cmd.fail(fmt.Errorf("%s rendition is not set up for a first pass", rendition.Resolution))
+		return cmd
+	}
+	cmd.Set("-map", "0:v:0").Set("-vf", rendition.videoFilter())
+	if format.IsStreaming() {
+		setSegmentedVideo(cmd, format, rendition)
+	} else {
+		setProgressiveVideo(cmd, format, rendition)
+	}
+	return cmd.Flag("-an").Flag("-sn").NullOutput()
+}
+
+// setPass queues the options selecting the pass of a two-pass encode and where its log is kept
+func setPass(cmd *FFmpegCommand, codec VideoCodec, plan *TwoPassPlan) {
+	if plan.Pass != 1 && plan.Pass != 2 {
+		cmd.fail(fmt.Errorf("two-pass encode has no pass %d", plan.Pass))
+		return
+	}
+	logFile, err := cmd.policy.ResolveOutput(plan.LogFile)
+	if err != nil {
+		cmd.fail(err)
+		return
+	}
+	if codec == H265 {
+		// libx265 ignores -pass and takes its pass settings through its own parameters
+		cmd.Set("-x265-params", fmt.Sprintf("pass=%d:stats=%s.log", plan.Pass, logFile))
+		return
+	}
+	cmd.Set("-pass", fmt.Sprint(plan.Pass)).Set("-passlogfile", logFile)
+}
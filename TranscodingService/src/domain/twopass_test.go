@@ -0,0 +1,76 @@
+package domain
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTwoPassBitrate(t *testing.T) {
+	bitrates := BitrateRange{MinKbps: 1000, MaxKbps: 8000}
+
+	tests := []struct {
+		name      string
+		rendition Rendition
+		want      string
+		wantErr   string
+	}{
+		{name: "range bitrate for the resolution", rendition: Rendition{Resolution: FHD}, want: "4000k"},
+		{name: "smallest resolution gets the minimum", rendition: Rendition{Resolution: SD}, want: "1000k"},
+		{name: "own bitrate kept as written", rendition: Rendition{Resolution: HD, Bitrate: "3M"}, want: "3M"},
+		{name: "own bitrate at the maximum", rendition: Rendition{Resolution: UHD, Bitrate: "8000k"}, want: "8000k"},
+		{name: "own bitrate below the range", rendition: Rendition{Resolution: SD, Bitrate: "500k"}, wantErr: "outside 1000k-8000k"},
+		{name: "own bitrate above the range", rendition: Rendition{Resolution: UHD, Bitrate: "9M"}, wantErr: "outside 1000k-8000k"},
+		{name: "malformed bitrate", rendition: Rendition{Resolution: HD, Bitrate: "high"}, wantErr: "invalid bitrate"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := bitrates.TwoPassBitrate(tt.rendition)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("TwoPassBitrate() = %s, %v, want an error containing %q", got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("TwoPassBitrate() = %s, %v, want %s", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestTwoPassPlan(t *testing.T) {
+	options := TwoPassOptions{MaxRateFactor: 1.5, BufferFactor: 2}
+
+	tests := []struct {
+		name      string
+		rendition Rendition
+		want      *TwoPassPlan
+		wantErr   bool
+	}{
+		{
+			name:      "peaks relative to the average",
+			rendition: Rendition{Resolution: HD, Bitrate: "2500k"},
+			want:      &TwoPassPlan{MaxRateKbps: 3750, BufferKbps: 5000, LogFile: filepath.Join("/work", "passlog_720p")},
+		},
+		{
+			name:      "no target bitrate",
+			rendition: Rendition{Resolution: HD},
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := options.Plan(tt.rendition, "/work")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Plan() = %v, want error %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Plan() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"TranscodingService/src/config"
+	"TranscodingService/src/controllers"
+	"TranscodingService/src/repositories"
+	"TranscodingService/src/services"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/gorilla/mux"
+)
+
+func main() {
+	configPath := os.Getenv("TRANSCODING_CONFIG_PATH")
+	if configPath == "" {
+		configPath = "config.yaml"
+	}
+
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	db, err := repositories.InitDB(cfg.Database.DataSourceName())
+	if err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+
+	repo := repositories.NewTranscodingRepository(db)
+	service := services.NewTranscodingService(repo, cfg)
+	service.StartQueue()
+
+	// Worker processes only claim jobs from the repository and leave the API to other instances
+	if os.Getenv("TRANSCODING_ROLE") == "worker" {
+		if !cfg.Transcoding.Workers.Distributed() {
+			log.Fatalf("Worker role requires transcoding.workers.mode to be distributed")
+		}
+		log.Printf("Transcoding worker started")
+		select {}
+	}
+
+	router := mux.NewRouter()
+	controllers.NewTranscodingController(service).TranscodingControllerRoutes(router)
+
+	addr := fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port)
+	log.Printf("Transcoding service listening on %s", addr)
+	log.Fatal(http.ListenAndServe(addr, router))
+}
@@ -1,9 +1,12 @@
 package repositories
 
 import (
+	"TranscodingService/src/domain"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	_ "github.com/go-sql-driver/mysql"
@@ -11,29 +14,106 @@ import (
 	"github.com/jmoiron/sqlx"
 )
 
+// ErrJobNotFound is returned when no job has the requested ID
+var ErrJobNotFound = errors.New("no job found with id")
+
 type TranscodingRepository interface {
 	CreateJob(input TranscodingJobInput) (string, error)
 	GetJobStatus(jobID string) (TranscodingJob, error)
-	UpdateJobStatus(jobID string, status string) error
-	GetJobsByStatus(status string) ([]TranscodingJob, error)
+	UpdateJobStatus(jobID string, status domain.TranscodingStatus) error
+	RetryJob(jobID string) error
+	UpdateJobPriority(jobID string, priority int) error
+	GetJobsByStatus(status domain.TranscodingStatus) ([]TranscodingJob, error)
+	GetAllJobs() ([]TranscodingJob, error)
+	GetJobsByVideoID(videoID string) ([]TranscodingJob, error)
+	MarkJobStarted(jobID string, workerID string, lease time.Duration) error
+	UpdateJobProgress(jobID string, progress float64) error
+	MarkJobFinished(jobID string, status domain.TranscodingStatus, errorMessage string) error
+	AppendJobLog(jobID string, message string) error
+	GetJobLogs(jobID string) ([]string, error)
+	UpdateJobMetadata(jobID string, metadata string) error
+	GetRenditions(jobID string) ([]TranscodingRendition, error)
+	UpdateRendition(jobID string, position int, status domain.RenditionStatus, errorMessage string) error
+	RegisterWorker(hostname string, slots int) (string, error)
+	GetWorkers() ([]TranscodingWorker, error)
+	ClaimJob(workerID string, lease, agingInterval, retryDelay time.Duration) (*TranscodingJob, error)
+	RenewLeases(workerID string, jobIDs []string, lease time.Duration) ([]string, error)
+	ExpireLeases(maxRetries int) ([]TranscodingJob, error)
 }
 
 type TranscodingJob struct {
-	JobID        string    `db:"job_id"`
-	VideoID      string    `db:"video_id"`
-	InputFormat  string    `db:"input_format"`
-	OutputFormat string    `db:"output_format"`
-	Status       string    `db:"status"`
-	CreatedAt    time.Time `db:"created_at"`
-	UpdatedAt    time.Time `db:"updated_at"`
+	JobID          string                   `db:"job_id"`
+	JobType        domain.JobType           `db:"job_type"`
+	VideoID        string                   `db:"video_id"`
+	InputFormat    string                   `db:"input_format"`
+	OutputFormat   string                   `db:"output_format"`
+	VideoCodec     string                   `db:"video_codec"`
+	AudioCodec     string                   `db:"audio_codec"`
+	Profile        string                   `db:"profile"`
+	Pad            bool                     `db:"pad"`
+	AutoCrop       bool                     `db:"auto_crop"`
+	InputFile      string                   `db:"input_file"`
+	OutputFile     string                   `db:"output_file"`
+	Resolution     string                   `db:"resolution"`
+	Priority       int                      `db:"priority"`
+	Status         domain.TranscodingStatus `db:"status"`
+	Progress       float64                  `db:"progress"`
+	ErrorMessage   string                   `db:"error_message"`
+	Attempts       int                      `db:"attempts"`
+	WorkerID       string                   `db:"worker_id"`
+	LeaseExpiresAt *time.Time               `db:"lease_expires_at"`
+	StartedAt      *time.Time               `db:"started_at"`
+	FinishedAt     *time.Time               `db:"finished_at"`
+	EnqueuedAt     time.Time                `db:"enqueued_at"` // when the job last started waiting to run
+	CreatedAt      time.Time                `db:"created_at"`
+	UpdatedAt      time.Time                `db:"updated_at"`
+	OutputMetadata sql.NullString           `db:"output_metadata"` // JSON describing how outputs were derived
+	Options        sql.NullString           `db:"options"`         // JSON holding the settings of the job type
 }
 
 type TranscodingJobInput struct {
+	JobID        string // generated when empty
+	JobType      domain.JobType
+	Options      string // JSON, empty when the job type has no settings
 	VideoID      string
 	InputFormat  string
 	OutputFormat string
+	VideoCodec   string
+	AudioCodec   string
+	Profile      string
+	Pad          bool
+	AutoCrop     bool
+	InputFile    string
+	OutputFile   string
+	Resolution   string
+	Priority     int
+	Renditions   []domain.Rendition
+}
+
+// TranscodingRendition is one output of a job, ordered by position
+type TranscodingRendition struct {
+	JobID        string                 `db:"job_id"`
+	Position     int                    `db:"position"`
+	Resolution   string                 `db:"resolution"`
+	Bitrate      string                 `db:"bitrate"`
+	OutputFile   string                 `db:"output_file"`
+	Status       domain.RenditionStatus `db:"status"`
+	ErrorMessage string                 `db:"error_message"`
+	UpdatedAt    time.Time              `db:"updated_at"`
 }
 
+// TranscodingWorker is a worker process registered to claim jobs, with the number it is running
+type TranscodingWorker struct {
+	WorkerID     string    `db:"worker_id"`
+	Hostname     string    `db:"hostname"`
+	Slots        int       `db:"slots"`
+	ActiveJobs   int       `db:"active_jobs"`
+	RegisteredAt time.Time `db:"registered_at"`
+	HeartbeatAt  time.Time `db:"heartbeat_at"`
+}
+
+const jobColumns = `job_id, job_type, video_id, input_format, output_format, video_codec, audio_codec, profile, pad, auto_crop, input_file, output_file, resolution, priority, status, progress, error_message, attempts, worker_id, lease_expires_at, started_at, finished_at, enqueued_at, created_at, updated_at, output_metadata, options`
+
 type TranscodingRepo struct {
 	db *sqlx.DB
 }
@@ -43,12 +123,34 @@ func NewTranscodingRepository(db *sqlx.DB) TranscodingRepository {
 }
 
 func (r *TranscodingRepo) CreateJob(input TranscodingJobInput) (string, error) {
-	jobID := uuid.New().String()
+	jobID := input.JobID
+	if jobID == "" {
+		jobID = uuid.New().String()
+	}
 	query := `
-        INSERT INTO transcoding_jobs (job_id, video_id, input_format, output_format, status, created_at, updated_at)
-        VALUES (?, ?, ?, ?, ?, ?, ?)
+        INSERT INTO transcoding_jobs (job_id, job_type, video_id, input_format, output_format, video_codec, audio_codec, profile, pad, auto_crop, input_file, output_file, resolution, priority, status, error_message, enqueued_at, created_at, updated_at, options)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, '', ?, ?, ?, ?)
     `
-	_, err := r.db.Exec(query, jobID, input.VideoID, input.InputFormat, input.OutputFormat, "pending", time.Now(), time.Now())
+	jobType := input.JobType
+	if jobType == "" {
+		jobType = domain.TranscodeJob
+	}
+	options := sql.NullString{String: input.Options, Valid: input.Options != ""}
+	now := time.Now()
+	err := r.withTransaction(func(tx *sqlx.Tx) error {
+		_, err := tx.Exec(query, jobID, jobType, input.VideoID, input.InputFormat, input.OutputFormat, input.VideoCodec, input.AudioCodec, input.Profile, input.Pad, input.AutoCrop, input.InputFile, input.OutputFile, input.Resolution, input.Priority, domain.Queued, now, now, now, options)
+		if err != nil {
+			return err
+		}
+		for i, rendition := range input.Renditions {
+			_, err := tx.Exec(`INSERT INTO transcoding_renditions (job_id, position, resolution, bitrate, output_file, status, error_message, updated_at) VALUES (?, ?, ?, ?, ?, ?, '', ?)`,
+				jobID, i, rendition.Resolution, rendition.Bitrate, rendition.OutputFile, domain.RenditionQueued, time.Now())
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 	if err != nil {
 		log.Printf("Error creating transcoding job: %v", err)
 		return "", err
@@ -58,11 +160,11 @@ func (r *TranscodingRepo) CreateJob(input TranscodingJobInput) (string, error) {
 
 func (r *TranscodingRepo) GetJobStatus(jobID string) (TranscodingJob, error) {
 	var job TranscodingJob
-	query := `SELECT job_id, video_id, input_format, output_format, status, created_at, updated_at FROM transcoding_jobs WHERE job_id = ?`
+	query := `SELECT ` + jobColumns + ` FROM transcoding_jobs WHERE job_id = ?`
 	err := r.db.Get(&job, query, jobID)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return TranscodingJob{}, fmt.Errorf("no job found with id: %s", jobID)
+			return TranscodingJob{}, fmt.Errorf("%w: %s", ErrJobNotFound, jobID)
 		}
 		log.Printf("Error getting job status: %v", err)
 		return TranscodingJob{}, err
@@ -70,9 +172,9 @@ func (r *TranscodingRepo) GetJobStatus(jobID string) (TranscodingJob, error) {
 	return job, nil
 }
 
-func (r *TranscodingRepo) UpdateJobStatus(jobID string, status string) error {
-	query := `UPDATE transcoding_jobs SET status = ?, updated_at = ? WHERE job_id = ?`
-	_, err := r.db.Exec(query, status, time.Now(), jobID)
+// UpdateJobStatus moves a job to status, returning a *domain.TransitionError if its current status does not allow it
+func (r *TranscodingRepo) UpdateJobStatus(jobID string, status domain.TranscodingStatus) error {
+	err := r.transitionJob(jobID, status, "")
 	if err != nil {
 		log.Printf("Error updating job status: %v", err)
 		return err
@@ -80,9 +182,29 @@ func (r *TranscodingRepo) UpdateJobStatus(jobID string, status string) error {
 	return nil
 }
 
-func (r *TranscodingRepo) GetJobsByStatus(status string) ([]TranscodingJob, error) {
+// RetryJob moves a failed job to retrying, returning a *domain.TransitionError if it is no longer failed
+func (r *TranscodingRepo) RetryJob(jobID string) error {
+	err := r.transitionJobFrom(jobID, []domain.TranscodingStatus{domain.Failed}, domain.Retrying, "")
+	if err != nil {
+		log.Printf("Error retrying job: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (r *TranscodingRepo) UpdateJobPriority(jobID string, priority int) error {
+	query := `UPDATE transcoding_jobs SET priority = ?, updated_at = ? WHERE job_id = ?`
+	_, err := r.db.Exec(query, priority, time.Now(), jobID)
+	if err != nil {
+		log.Printf("Error updating job priority: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (r *TranscodingRepo) GetJobsByStatus(status domain.TranscodingStatus) ([]TranscodingJob, error) {
 	var jobs []TranscodingJob
-	query := `SELECT job_id, video_id, input_format, output_format, status, created_at, updated_at FROM transcoding_jobs WHERE status = ?`
+	query := `SELECT ` + jobColumns + ` FROM transcoding_jobs WHERE status = ?`
 	err := r.db.Select(&jobs, query, status)
 	if err != nil {
 		log.Printf("Error fetching jobs by status: %v", err)
@@ -91,6 +213,291 @@ func (r *TranscodingRepo) GetJobsByStatus(status string) ([]TranscodingJob, erro
 	return jobs, nil
 }
 
+func (r *TranscodingRepo) GetAllJobs() ([]TranscodingJob, error) {
+	var jobs []TranscodingJob
+	query := `SELECT ` + jobColumns + ` FROM transcoding_jobs ORDER BY created_at DESC`
+	err := r.db.Select(&jobs, query)
+	if err != nil {
+		log.Printf("Error fetching all jobs: %v", err)
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// GetJobsByVideoID lists the jobs recorded for a video, newest first
+func (r *TranscodingRepo) GetJobsByVideoID(videoID string) ([]TranscodingJob, error) {
+	var jobs []TranscodingJob
+	query := `SELECT ` + jobColumns + ` FROM transcoding_jobs WHERE video_id = ? ORDER BY created_at DESC`
+	err := r.db.Select(&jobs, query, videoID)
+	if err != nil {
+		log.Printf("Error fetching jobs by video: %v", err)
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// MarkJobStarted counts an attempt and, when workerID is set, leases the job to that worker for lease
+func (r *TranscodingRepo) MarkJobStarted(jobID string, workerID string, lease time.Duration) error {
+	now := time.Now()
+	var expires *time.Time
+	if workerID != "" {
+		t := now.Add(lease)
+		expires = &t
+	}
+	err := r.transitionJob(jobID, domain.Running, "worker_id = ?, lease_expires_at = ?, progress = 0, error_message = '', attempts = attempts + 1, started_at = ?, finished_at = NULL, ", workerID, expires, now)
+	if err != nil {
+		log.Printf("Error marking job started: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (r *TranscodingRepo) UpdateJobProgress(jobID string, progress float64) error {
+	query := `UPDATE transcoding_jobs SET progress = ?, updated_at = ? WHERE job_id = ?`
+	_, err := r.db.Exec(query, progress, time.Now(), jobID)
+	if err != nil {
+		log.Printf("Error updating job progress: %v", err)
+		return err
+	}
+	return nil
+}
+
+// MarkJobFinished records a terminal status along with the reason a job did not complete
+func (r *TranscodingRepo) MarkJobFinished(jobID string, status domain.TranscodingStatus, errorMessage string) error {
+	if !status.IsTerminal() {
+		return fmt.Errorf("%s is not a terminal job status", status)
+	}
+	err := r.transitionJob(jobID, status, "error_message = ?, progress = IF(? = ?, 100, progress), finished_at = ?, lease_expires_at = NULL, ", errorMessage, status, domain.Completed, time.Now())
+	if err != nil {
+		log.Printf("Error marking job finished: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (r *TranscodingRepo) AppendJobLog(jobID string, message string) error {
+	query := `INSERT INTO transcoding_job_logs (job_id, message, created_at) VALUES (?, ?, ?)`
+	_, err := r.db.Exec(query, jobID, message, time.Now())
+	if err != nil {
+		log.Printf("Error appending job log: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (r *TranscodingRepo) GetJobLogs(jobID string) ([]string, error) {
+	logs := []string{}
+	query := `SELECT CONCAT(DATE_FORMAT(created_at, '%Y-%m-%dT%H:%i:%s'), ' ', message) FROM transcoding_job_logs WHERE job_id = ? ORDER BY id`
+	err := r.db.Select(&logs, query, jobID)
+	if err != nil {
+		log.Printf("Error fetching job logs: %v", err)
+		return nil, err
+	}
+	return logs, nil
+}
+
+func (r *TranscodingRepo) UpdateJobMetadata(jobID string, metadata string) error {
+	query := `UPDATE transcoding_jobs SET output_metadata = ?, updated_at = ? WHERE job_id = ?`
+	_, err := r.db.Exec(query, metadata, time.Now(), jobID)
+	if err != nil {
+		log.Printf("Error updating job output metadata: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (r *TranscodingRepo) GetRenditions(jobID string) ([]TranscodingRendition, error) {
+	var renditions []TranscodingRendition
+	query := `SELECT job_id, position, resolution, bitrate, output_file, status, error_message, updated_at FROM transcoding_renditions WHERE job_id = ? ORDER BY position`
+	err := r.db.Select(&renditions, query, jobID)
+	if err != nil {
+		log.Printf("Error fetching job renditions: %v", err)
+		return nil, err
+	}
+	return renditions, nil
+}
+
+func (r *TranscodingRepo) UpdateRendition(jobID string, position int, status domain.RenditionStatus, errorMessage string) error {
+	query := `UPDATE transcoding_renditions SET status = ?, error_message = ?, updated_at = ? WHERE job_id = ? AND position = ?`
+	_, err := r.db.Exec(query, status, errorMessage, time.Now(), jobID, position)
+	if err != nil {
+		log.Printf("Error updating job rendition: %v", err)
+		return err
+	}
+	return nil
+}
+
+// RegisterWorker records a worker process able to run slots jobs at once and returns its ID
+func (r *TranscodingRepo) RegisterWorker(hostname string, slots int) (string, error) {
+	workerID := uuid.New().String()
+	query := `INSERT INTO transcoding_workers (worker_id, hostname, slots, registered_at, heartbeat_at) VALUES (?, ?, ?, ?, ?)`
+	_, err := r.db.Exec(query, workerID, hostname, slots, time.Now(), time.Now())
+	if err != nil {
+		log.Printf("Error registering worker: %v", err)
+		return "", err
+	}
+	return workerID, nil
+}
+
+// GetWorkers lists the registered workers with the jobs each is running, most recently seen first
+func (r *TranscodingRepo) GetWorkers() ([]TranscodingWorker, error) {
+	var workers []TranscodingWorker
+	query := `
+        SELECT w.worker_id, w.hostname, w.slots, w.registered_at, w.heartbeat_at,
+            (SELECT COUNT(*) FROM transcoding_jobs j WHERE j.worker_id = w.worker_id AND j.status = ?) AS active_jobs
+        FROM transcoding_workers w ORDER BY w.heartbeat_at DESC
+    `
+	err := r.db.Select(&workers, query, domain.Running)
+	if err != nil {
+		log.Printf("Error fetching workers: %v", err)
+		return nil, err
+	}
+	return workers, nil
+}
+
+// ClaimJob leases the longest-waiting job by aged priority to a worker, or returns nil when none is waiting
+func (r *TranscodingRepo) ClaimJob(workerID string, lease, agingInterval, retryDelay time.Duration) (*TranscodingJob, error) {
+	now := time.Now()
+	order := `priority DESC`
+	args := []interface{}{domain.Queued, domain.Retrying, now.Add(-retryDelay)}
+	if agingInterval > 0 {
+		order = `priority + TIMESTAMPDIFF(SECOND, enqueued_at, ?) / ? DESC`
+		args = append(args, now, agingInterval.Seconds())
+	}
+	query := `SELECT ` + jobColumns + ` FROM transcoding_jobs WHERE (status = ? OR (status = ? AND enqueued_at <= ?)) ORDER BY ` + order + `, created_at LIMIT 1 FOR UPDATE SKIP LOCKED`
+
+	var claimed *TranscodingJob
+	err := r.withTransaction(func(tx *sqlx.Tx) error {
+		var job TranscodingJob
+		if err := tx.Get(&job, query, args...); err != nil {
+			if err == sql.ErrNoRows {
+				return nil
+			}
+			return err
+		}
+		expires := now.Add(lease)
+		_, err := tx.Exec(`UPDATE transcoding_jobs SET status = ?, worker_id = ?, lease_expires_at = ?, progress = 0, error_message = '', attempts = attempts + 1, started_at = ?, finished_at = NULL, updated_at = ? WHERE job_id = ?`,
+			domain.Running, workerID, expires, now, now, job.JobID)
+		if err != nil {
+			return err
+		}
+		job.Status, job.WorkerID, job.LeaseExpiresAt = domain.Running, workerID, &expires
+		job.Progress, job.ErrorMessage, job.StartedAt, job.FinishedAt = 0, "", &now, nil
+		job.Attempts++
+		claimed = &job
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error claiming job: %v", err)
+		return nil, err
+	}
+	return claimed, nil
+}
+
+// RenewLeases records a worker's heartbeat and returns the listed jobs it still holds, extending their leases
+func (r *TranscodingRepo) RenewLeases(workerID string, jobIDs []string, lease time.Duration) ([]string, error) {
+	now := time.Now()
+	if _, err := r.db.Exec(`UPDATE transcoding_workers SET heartbeat_at = ? WHERE worker_id = ?`, now, workerID); err != nil {
+		log.Printf("Error recording worker heartbeat: %v", err)
+		return nil, err
+	}
+	if len(jobIDs) == 0 {
+		return nil, nil
+	}
+
+	held := []domain.TranscodingStatus{domain.Running, domain.Paused}
+	query, args, err := sqlx.In(`UPDATE transcoding_jobs SET lease_expires_at = ? WHERE worker_id = ? AND status IN (?) AND job_id IN (?)`, now.Add(lease), workerID, held, jobIDs)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := r.db.Exec(r.db.Rebind(query), args...); err != nil {
+		log.Printf("Error renewing job leases: %v", err)
+		return nil, err
+	}
+	query, args, err = sqlx.In(`SELECT job_id FROM transcoding_jobs WHERE worker_id = ? AND status IN (?) AND job_id IN (?)`, workerID, held, jobIDs)
+	if err != nil {
+		return nil, err
+	}
+	jobs := []string{}
+	if err := r.db.Select(&jobs, r.db.Rebind(query), args...); err != nil {
+		log.Printf("Error fetching held job leases: %v", err)
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// ExpireLeases re-queues or fails the running jobs whose worker stopped renewing their lease
+func (r *TranscodingRepo) ExpireLeases(maxRetries int) ([]TranscodingJob, error) {
+	var expired []TranscodingJob
+	err := r.withTransaction(func(tx *sqlx.Tx) error {
+		now := time.Now()
+		query := `SELECT ` + jobColumns + ` FROM transcoding_jobs WHERE status = ? AND (lease_expires_at IS NULL OR lease_expires_at < ?) FOR UPDATE SKIP LOCKED`
+		if err := tx.Select(&expired, query, domain.Running, now); err != nil {
+			return err
+		}
+		for i := range expired {
+			job := &expired[i]
+			if job.Attempts > maxRetries {
+				job.Status = domain.Failed
+				job.ErrorMessage = fmt.Sprintf("worker lease expired after %d attempts", job.Attempts)
+				job.FinishedAt = &now
+			} else {
+				job.Status = domain.Retrying
+				job.EnqueuedAt = now
+			}
+			_, err := tx.Exec(`UPDATE transcoding_jobs SET status = ?, error_message = ?, finished_at = ?, lease_expires_at = NULL, enqueued_at = ?, updated_at = ? WHERE job_id = ?`,
+				job.Status, job.ErrorMessage, job.FinishedAt, job.EnqueuedAt, now, job.JobID)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error expiring job leases: %v", err)
+		return nil, err
+	}
+	return expired, nil
+}
+
+// transitionJob sets a job's status and the extra "column = ?, " assignments in set if the move is allowed
+func (r *TranscodingRepo) transitionJob(jobID string, status domain.TranscodingStatus, set string, args ...interface{}) error {
+	return r.transitionJobFrom(jobID, status.Predecessors(), status, set, args...)
+}
+
+// transitionJobFrom is transitionJob for a job that must currently be in one of the statuses in from
+func (r *TranscodingRepo) transitionJobFrom(jobID string, from []domain.TranscodingStatus, status domain.TranscodingStatus, set string, args ...interface{}) error {
+	now := time.Now()
+	if status == domain.Queued || status == domain.Retrying {
+		// Aging and the retry delay count from when the job started waiting, not its last update
+		set += "enqueued_at = ?, "
+		args = append(args, now)
+	}
+	queryArgs := append([]interface{}{status}, args...)
+	queryArgs = append(queryArgs, now, jobID, from)
+	query, queryArgs, err := sqlx.In(`UPDATE transcoding_jobs SET status = ?, `+set+`updated_at = ? WHERE job_id = ? AND status IN (?)`, queryArgs...)
+	if err != nil {
+		return err
+	}
+
+	result, err := r.db.Exec(r.db.Rebind(query), queryArgs...)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		job, err := r.GetJobStatus(jobID)
+		if err != nil {
+			return err
+		}
+		return &domain.TransitionError{From: job.Status, To: status}
+	}
+	return nil
+}
+
 // Database initialization and migrations
 
 func InitDB(dataSourceName string) (*sqlx.DB, error) {
@@ -114,13 +521,62 @@ func runMigrations(db *sqlx.DB) error {
 	migrations := []string{
 		`CREATE TABLE IF NOT EXISTS transcoding_jobs (
             job_id VARCHAR(36) NOT NULL,
+            job_type VARCHAR(20) NOT NULL DEFAULT 'transcode',
             video_id VARCHAR(36) NOT NULL,
             input_format VARCHAR(50) NOT NULL,
             output_format VARCHAR(50) NOT NULL,
+            video_codec VARCHAR(20) NOT NULL DEFAULT '',
+            audio_codec VARCHAR(20) NOT NULL DEFAULT '',
+            profile VARCHAR(64) NOT NULL DEFAULT '',
+            pad TINYINT(1) NOT NULL DEFAULT 0,
+            auto_crop TINYINT(1) NOT NULL DEFAULT 0,
+            input_file VARCHAR(1024) NOT NULL,
+            output_file VARCHAR(1024) NOT NULL,
+            resolution VARCHAR(255) NOT NULL,
+            priority INT NOT NULL DEFAULT 0,
             status VARCHAR(50) NOT NULL,
+            progress DOUBLE NOT NULL DEFAULT 0,
+            error_message TEXT NOT NULL,
+            attempts INT NOT NULL DEFAULT 0,
+            worker_id VARCHAR(36) NOT NULL DEFAULT '',
+            lease_expires_at DATETIME NULL,
+            started_at DATETIME NULL,
+            finished_at DATETIME NULL,
+            enqueued_at DATETIME NULL,
             created_at DATETIME NOT NULL,
             updated_at DATETIME NOT NULL,
-            PRIMARY KEY (job_id)
+            output_metadata TEXT NULL,
+            options TEXT NULL,
+            PRIMARY KEY (job_id),
+            INDEX idx_transcoding_jobs_status (status),
+            INDEX idx_transcoding_jobs_video_id (video_id)
+        )`,
+		`CREATE TABLE IF NOT EXISTS transcoding_job_logs (
+            id BIGINT NOT NULL AUTO_INCREMENT,
+            job_id VARCHAR(36) NOT NULL,
+            message TEXT NOT NULL,
+            created_at DATETIME NOT NULL,
+            PRIMARY KEY (id),
+            INDEX idx_transcoding_job_logs_job_id (job_id)
+        )`,
+		`CREATE TABLE IF NOT EXISTS transcoding_renditions (
+            job_id VARCHAR(36) NOT NULL,
+            position INT NOT NULL,
+            resolution VARCHAR(20) NOT NULL,
+            bitrate VARCHAR(20) NOT NULL,
+            output_file VARCHAR(1024) NOT NULL,
+            status VARCHAR(50) NOT NULL,
+            error_message TEXT NOT NULL,
+            updated_at DATETIME NOT NULL,
+            PRIMARY KEY (job_id, position)
+        )`,
+		`CREATE TABLE IF NOT EXISTS transcoding_workers (
+            worker_id VARCHAR(36) NOT NULL,
+            hostname VARCHAR(255) NOT NULL,
+            slots INT NOT NULL,
+            registered_at DATETIME NOT NULL,
+            heartbeat_at DATETIME NOT NULL,
+            PRIMARY KEY (worker_id)
         )`,
 	}
 
@@ -130,9 +586,121 @@ func runMigrations(db *sqlx.DB) error {
 			return fmt.Errorf("migration failed: %v", err)
 		}
 	}
+
+	// Tables created by earlier versions lack the columns and indexes added since
+	for _, c := range addedColumns {
+		if err := addColumn(db, c.table, c.column, c.definition); err != nil {
+			return fmt.Errorf("migration failed: %v", err)
+		}
+	}
+	for _, i := range addedIndexes {
+		if err := addIndex(db, i.table, i.index, i.columns); err != nil {
+			return fmt.Errorf("migration failed: %v", err)
+		}
+	}
+
+	// Ladder jobs record every rendition resolution on the job
+	if err := modifyColumn(db, "transcoding_jobs", "resolution", "varchar(255)", "NOT NULL DEFAULT ''"); err != nil {
+		return fmt.Errorf("migration failed: %v", err)
+	}
+
+	updates := []string{
+		// Statuses from before the shared state machine; unfinished jobs without an input file cannot be recovered
+		`UPDATE transcoding_jobs SET status = 'failed', error_message = 'created before input files were recorded'
+            WHERE input_file = '' AND status IN ('pending', 'in_progress')`,
+		`UPDATE transcoding_jobs SET status = 'queued' WHERE status = 'pending'`,
+		`UPDATE transcoding_jobs SET status = 'running' WHERE status = 'in_progress'`,
+		// Jobs from before enqueued_at was recorded age from their last update, as they used to
+		`UPDATE transcoding_jobs SET enqueued_at = updated_at WHERE enqueued_at IS NULL`,
+	}
+	for _, m := range updates {
+		_, err := db.Exec(m)
+		if err != nil {
+			return fmt.Errorf("migration failed: %v", err)
+		}
+	}
 	return nil
 }
 
+// addedColumns are the columns added to tables after they were first created, oldest first
+var addedColumns = []struct {
+	table, column, definition string
+}{
+	{"transcoding_jobs", "input_file", "VARCHAR(1024) NOT NULL DEFAULT ''"},
+	{"transcoding_jobs", "output_file", "VARCHAR(1024) NOT NULL DEFAULT ''"},
+	{"transcoding_jobs", "resolution", "VARCHAR(255) NOT NULL DEFAULT ''"},
+	{"transcoding_jobs", "priority", "INT NOT NULL DEFAULT 0"},
+	{"transcoding_jobs", "progress", "DOUBLE NOT NULL DEFAULT 0"},
+	{"transcoding_jobs", "error_message", "TEXT NOT NULL"},
+	{"transcoding_jobs", "attempts", "INT NOT NULL DEFAULT 0"},
+	{"transcoding_jobs", "started_at", "DATETIME NULL"},
+	{"transcoding_jobs", "finished_at", "DATETIME NULL"},
+	{"transcoding_jobs", "video_codec", "VARCHAR(20) NOT NULL DEFAULT ''"},
+	{"transcoding_jobs", "audio_codec", "VARCHAR(20) NOT NULL DEFAULT ''"},
+	{"transcoding_jobs", "profile", "VARCHAR(64) NOT NULL DEFAULT ''"},
+	{"transcoding_jobs", "pad", "TINYINT(1) NOT NULL DEFAULT 0"},
+	{"transcoding_jobs", "auto_crop", "TINYINT(1) NOT NULL DEFAULT 0"},
+	{"transcoding_jobs", "output_metadata", "TEXT NULL"},
+	{"transcoding_jobs", "job_type", "VARCHAR(20) NOT NULL DEFAULT 'transcode'"},
+	{"transcoding_jobs", "options", "TEXT NULL"},
+	{"transcoding_jobs", "worker_id", "VARCHAR(36) NOT NULL DEFAULT ''"},
+	{"transcoding_jobs", "lease_expires_at", "DATETIME NULL"},
+	{"transcoding_jobs", "enqueued_at", "DATETIME NULL"},
+}
+
+// addedIndexes are the indexes added to tables after they were first created
+var addedIndexes = []struct {
+	table, index, columns string
+}{
+	{"transcoding_jobs", "idx_transcoding_jobs_status", "status"},
+	{"transcoding_jobs", "idx_transcoding_jobs_video_id", "video_id"},
+}
+
+// columnExists reports whether a table in the current database has a column
+func columnExists(db *sqlx.DB, table, column string) (bool, error) {
+	var count int
+	query := `SELECT COUNT(*) FROM information_schema.columns WHERE table_schema = DATABASE() AND table_name = ? AND column_name = ?`
+	if err := db.Get(&count, query, table, column); err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// addColumn adds a column to a table unless it is already there
+func addColumn(db *sqlx.DB, table, column, definition string) error {
+	exists, err := columnExists(db, table, column)
+	if err != nil || exists {
+		return err
+	}
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
+// modifyColumn changes the type of a column the table has, unless it already has that type
+func modifyColumn(db *sqlx.DB, table, column, columnType, attributes string) error {
+	var current []string
+	query := `SELECT column_type FROM information_schema.columns WHERE table_schema = DATABASE() AND table_name = ? AND column_name = ?`
+	if err := db.Select(&current, query, table, column); err != nil {
+		return err
+	}
+	if len(current) == 0 || strings.EqualFold(current[0], columnType) {
+		return nil
+	}
+	_, err := db.Exec(fmt.Sprintf("ALTER TABLE %s MODIFY %s %s %s", table, column, columnType, attributes))
+	return err
+}
+
+// addIndex indexes columns of a table unless an index of that name is already there
+func addIndex(db *sqlx.DB, table, index, columns string) error {
+	var count int
+	query := `SELECT COUNT(*) FROM information_schema.statistics WHERE table_schema = DATABASE() AND table_name = ? AND index_name = ?`
+	if err := db.Get(&count, query, table, index); err != nil || count > 0 {
+		return err
+	}
+	_, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD INDEX %s (%s)", table, index, columns))
+	return err
+}
+
 // Helper function for transactional queries
 
 func (r *TranscodingRepo) withTransaction(fn func(tx *sqlx.Tx) error) error {
@@ -153,20 +721,18 @@ func (r *TranscodingRepo) withTransaction(fn func(tx *sqlx.Tx) error) error {
 // Job retry functionality for failed jobs
 
 func (r *TranscodingRepo) RetryFailedJobs() error {
-	jobs, err := r.GetJobsByStatus("failed")
+	jobs, err := r.GetJobsByStatus(domain.Failed)
 	if err != nil {
 		return err
 	}
 
 	for _, job := range jobs {
-		err := r.withTransaction(func(tx *sqlx.Tx) error {
-			query := `UPDATE transcoding_jobs SET status = ? WHERE job_id = ?`
-			_, err := tx.Exec(query, "pending", job.JobID)
-			if err != nil {
-				return err
-			}
-			return nil
-		})
+		err := r.RetryJob(job.JobID)
+		var transitionErr *domain.TransitionError
+		if errors.As(err, &transitionErr) {
+			// The job was resubmitted or otherwise moved on since it was listed
+			continue
+		}
 		if err != nil {
 			log.Printf("Failed to retry job %s: %v", job.JobID, err)
 			return err
@@ -180,8 +746,8 @@ func (r *TranscodingRepo) RetryFailedJobs() error {
 
 func (r *TranscodingRepo) CleanupOldJobs(daysOld int) error {
 	cutoff := time.Now().AddDate(0, 0, -daysOld)
-	query := `DELETE FROM transcoding_jobs WHERE status = 'completed' AND updated_at < ?`
-	_, err := r.db.Exec(query, cutoff)
+	query := `DELETE FROM transcoding_jobs WHERE status = ? AND updated_at < ?`
+	_, err := r.db.Exec(query, domain.Completed, cutoff)
 	if err != nil {
 		log.Printf("Error cleaning up old jobs: %v", err)
 		return err
@@ -0,0 +1,306 @@
+package repositories
+
+import (
+	"TranscodingService/src/domain"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// fakeDB records the statements run against it and answers them from a fixed script
+type fakeDB struct {
+	rowsAffected int64
+	columns      []string
+	rows         [][]driver.Value
+	queries      []string
+	args         [][]driver.Value
+}
+
+func (db *fakeDB) Connect(context.Context) (driver.Conn, error) { return fakeConn{db}, nil }
+func (db *fakeDB) Driver() driver.Driver                        { return fakeDriver{} }
+
+func (db *fakeDB) record(query string, args []driver.NamedValue) {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	db.queries = append(db.queries, query)
+	db.args = append(db.args, values)
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("open through the connector")
+}
+
+type fakeConn struct{ db *fakeDB }
+
+func (fakeConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("prepare not supported") }
+func (fakeConn) Close() error                        { return nil }
+func (fakeConn) Begin() (driver.Tx, error)           { return fakeTx{}, nil }
+
+func (c fakeConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.db.record(query, args)
+	return driver.RowsAffected(c.db.rowsAffected), nil
+}
+
+func (c fakeConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.db.record(query, args)
+	return &fakeRows{columns: c.db.columns, rows: c.db.rows}, nil
+}
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+func newTestRepo(db *fakeDB) *TranscodingRepo {
+	return &TranscodingRepo{db: sqlx.NewDb(sql.OpenDB(db), "mysql")}
+}
+
+func statusArgs(values []driver.Value) []string {
+	var statuses []string
+	for _, value := range values {
+		statuses = append(statuses, value.(string))
+	}
+	sort.Strings(statuses)
+	return statuses
+}
+
+func TestUpdateJobStatusRequiresPredecessor(t *testing.T) {
+	for _, status := range []domain.TranscodingStatus{domain.Running, domain.Paused, domain.Retrying, domain.Cancelled} {
+		t.Run(string(status), func(t *testing.T) {
+			db := &fakeDB{rowsAffected: 1}
+			if err := newTestRepo(db).UpdateJobStatus("job-1", status); err != nil {
+				t.Fatalf("UpdateJobStatus() = %v", err)
+			}
+			if len(db.queries) != 1 {
+				t.Fatalf("ran %d statements, want 1", len(db.queries))
+			}
+
+			predecessors := status.Predecessors()
+			placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(predecessors)), ", ")
+			set, skip := "", 0
+			if status == domain.Retrying {
+				set, skip = "enqueued_at = ?, ", 1
+			}
+			want := "UPDATE transcoding_jobs SET status = ?, " + set + "updated_at = ? WHERE job_id = ? AND status IN (" + placeholders + ")"
+			if db.queries[0] != want {
+				t.Errorf("query = %s, want %s", db.queries[0], want)
+			}
+
+			args := db.args[0]
+			if args[0] != string(status) || args[skip+2] != "job-1" {
+				t.Errorf("args = %v, want status %s and job job-1", args, status)
+			}
+			var wantFrom []string
+			for _, from := range predecessors {
+				wantFrom = append(wantFrom, string(from))
+			}
+			sort.Strings(wantFrom)
+			if got := statusArgs(args[skip+3:]); strings.Join(got, ",") != strings.Join(wantFrom, ",") {
+				t.Errorf("required statuses = %v, want %v", got, wantFrom)
+			}
+		})
+	}
+}
+
+func TestUpdateJobStatusRejectedTransition(t *testing.T) {
+	db := &fakeDB{columns: []string{"job_id", "status"}, rows: [][]driver.Value{{"job-1", "completed"}}}
+
+	err := newTestRepo(db).UpdateJobStatus("job-1", domain.Paused)
+	var transition *domain.TransitionError
+	if !errors.As(err, &transition) {
+		t.Fatalf("UpdateJobStatus() = %v, want a *domain.TransitionError", err)
+	}
+	if transition.From != domain.Completed || transition.To != domain.Paused {
+		t.Errorf("TransitionError = %s -> %s, want completed -> paused", transition.From, transition.To)
+	}
+}
+
+func TestMarkJobStartedCountsAttempt(t *testing.T) {
+	db := &fakeDB{rowsAffected: 1}
+	if err := newTestRepo(db).MarkJobStarted("job-1", "", time.Minute); err != nil {
+		t.Fatalf("MarkJobStarted() = %v", err)
+	}
+	if len(db.queries) != 1 || !strings.Contains(db.queries[0], "attempts = attempts + 1") {
+		t.Errorf("queries = %v, want one counting the attempt", db.queries)
+	}
+	if args := db.args[0]; args[1] != "" || args[2] != nil {
+		t.Errorf("args = %v, want the job left unleased", args)
+	}
+}
+
+func TestMarkJobStartedLeasesToWorker(t *testing.T) {
+	db := &fakeDB{rowsAffected: 1}
+	before := time.Now()
+	if err := newTestRepo(db).MarkJobStarted("job-1", "worker-1", time.Minute); err != nil {
+		t.Fatalf("MarkJobStarted() = %v", err)
+	}
+	args := db.args[0]
+	expires, ok := args[2].(time.Time)
+	if args[1] != "worker-1" || !ok || expires.Before(before.Add(time.Minute)) {
+		t.Errorf("args = %v, want the job leased to worker-1 for a minute", args)
+	}
+}
+
+func TestMarkJobFinishedRequiresTerminalStatus(t *testing.T) {
+	db := &fakeDB{rowsAffected: 1}
+	if err := newTestRepo(db).MarkJobFinished("job-1", domain.Paused, ""); err == nil {
+		t.Error("MarkJobFinished() with a non-terminal status succeeded")
+	}
+	if len(db.queries) != 0 {
+		t.Errorf("ran %v for a non-terminal status, want nothing", db.queries)
+	}
+
+	if err := newTestRepo(db).MarkJobFinished("job-1", domain.Failed, "exit status 1"); err != nil {
+		t.Fatalf("MarkJobFinished() = %v", err)
+	}
+	if len(db.queries) != 1 || db.args[0][0] != "failed" || db.args[0][1] != "exit status 1" {
+		t.Errorf("ran %v with %v, want the failure recorded", db.queries, db.args)
+	}
+}
+
+func TestMarkJobFinishedKeepsRecordedOutcome(t *testing.T) {
+	db := &fakeDB{columns: []string{"job_id", "status"}, rows: [][]driver.Value{{"job-1", "cancelled"}}}
+
+	err := newTestRepo(db).MarkJobFinished("job-1", domain.Completed, "")
+	var transition *domain.TransitionError
+	if !errors.As(err, &transition) || transition.From != domain.Cancelled {
+		t.Fatalf("MarkJobFinished() of a cancelled job = %v, want a *domain.TransitionError from cancelled", err)
+	}
+	if !strings.Contains(db.queries[0], "AND status IN (") {
+		t.Errorf("update = %s, want it conditional on the recorded status", db.queries[0])
+	}
+}
+
+func TestRetryFailedJobsRequiresFailed(t *testing.T) {
+	db := &fakeDB{rowsAffected: 1, columns: []string{"job_id", "status"}, rows: [][]driver.Value{{"job-1", "failed"}}}
+	if err := newTestRepo(db).RetryFailedJobs(); err != nil {
+		t.Fatalf("RetryFailedJobs() = %v", err)
+	}
+	if len(db.queries) != 2 {
+		t.Fatalf("ran %v, want a select and an update", db.queries)
+	}
+	if !strings.HasSuffix(db.queries[1], "WHERE job_id = ? AND status IN (?)") {
+		t.Errorf("update = %s, want it conditional on one status", db.queries[1])
+	}
+	args := db.args[1]
+	if args[0] != "retrying" || args[len(args)-2] != "job-1" || args[len(args)-1] != "failed" {
+		t.Errorf("update args = %v, want job-1 moved from failed to retrying", args)
+	}
+}
+
+func TestClaimJob(t *testing.T) {
+	db := &fakeDB{rowsAffected: 1, columns: []string{"job_id", "status", "attempts"}, rows: [][]driver.Value{{"job-1", "retrying", int64(1)}}}
+
+	before := time.Now()
+	job, err := newTestRepo(db).ClaimJob("worker-1", time.Minute, 10*time.Minute, 30*time.Second)
+	if err != nil {
+		t.Fatalf("ClaimJob() = %v", err)
+	}
+	if job == nil || job.JobID != "job-1" || job.Status != domain.Running || job.WorkerID != "worker-1" || job.Attempts != 2 {
+		t.Fatalf("ClaimJob() = %+v, want job-1 running on worker-1 in its second attempt", job)
+	}
+	if job.LeaseExpiresAt == nil || job.LeaseExpiresAt.Before(before.Add(time.Minute)) {
+		t.Errorf("lease expires at %v, want a minute from now", job.LeaseExpiresAt)
+	}
+
+	if len(db.queries) != 2 {
+		t.Fatalf("ran %v, want a select and an update", db.queries)
+	}
+	if !strings.Contains(db.queries[0], "ORDER BY priority + TIMESTAMPDIFF(SECOND, enqueued_at, ?) / ? DESC") || !strings.HasSuffix(db.queries[0], "FOR UPDATE SKIP LOCKED") {
+		t.Errorf("select = %s, want an aged priority order skipping locked rows", db.queries[0])
+	}
+	if !strings.Contains(db.queries[0], "WHERE (status = ? OR (status = ? AND enqueued_at <= ?))") {
+		t.Errorf("select = %s, want retries held back", db.queries[0])
+	}
+	args := db.args[0]
+	if retryAfter, ok := args[2].(time.Time); args[0] != "queued" || args[1] != "retrying" || !ok || retryAfter.Before(before.Add(-30*time.Second)) || args[4] != 600.0 {
+		t.Errorf("select args = %v, want waiting statuses, the retry cutoff and the aging interval in seconds", args)
+	}
+	update := db.args[1]
+	if update[0] != "running" || update[1] != "worker-1" || update[len(update)-1] != "job-1" {
+		t.Errorf("update args = %v, want job-1 running on worker-1", update)
+	}
+}
+
+func TestClaimJobNoneWaiting(t *testing.T) {
+	db := &fakeDB{columns: []string{"job_id"}}
+	job, err := newTestRepo(db).ClaimJob("worker-1", time.Minute, 0, 0)
+	if err != nil || job != nil {
+		t.Fatalf("ClaimJob() = %+v, %v, want nothing claimed", job, err)
+	}
+	if !strings.Contains(db.queries[0], "ORDER BY priority DESC") {
+		t.Errorf("select = %s, want plain priority order without aging", db.queries[0])
+	}
+	if len(db.queries) != 1 {
+		t.Errorf("ran %v, want no update", db.queries)
+	}
+}
+
+func TestExpireLeases(t *testing.T) {
+	db := &fakeDB{
+		rowsAffected: 1,
+		columns:      []string{"job_id", "status", "attempts", "worker_id"},
+		rows: [][]driver.Value{
+			{"job-1", "running", int64(2), "worker-1"},
+			{"job-2", "running", int64(3), "worker-1"},
+		},
+	}
+
+	expired, err := newTestRepo(db).ExpireLeases(2)
+	if err != nil {
+		t.Fatalf("ExpireLeases() = %v", err)
+	}
+	if len(expired) != 2 {
+		t.Fatalf("ExpireLeases() = %+v, want both jobs", expired)
+	}
+	if expired[0].Status != domain.Retrying || expired[0].FinishedAt != nil {
+		t.Errorf("job with attempts left = %+v, want it re-queued", expired[0])
+	}
+	if expired[1].Status != domain.Failed || expired[1].FinishedAt == nil || !strings.Contains(expired[1].ErrorMessage, "after 3 attempts") {
+		t.Errorf("job out of attempts = %+v, want it failed", expired[1])
+	}
+
+	if len(db.queries) != 3 {
+		t.Fatalf("ran %v, want a select and an update per job", db.queries)
+	}
+	if !strings.Contains(db.queries[0], "lease_expires_at < ?") {
+		t.Errorf("select = %s, want it to find expired leases", db.queries[0])
+	}
+	for i, want := range []string{"retrying", "failed"} {
+		if args := db.args[i+1]; args[0] != want || args[len(args)-1] != expired[i].JobID {
+			t.Errorf("update %d args = %v, want %s for %s", i+1, args, want, expired[i].JobID)
+		}
+	}
+	if expired[0].EnqueuedAt.IsZero() || !expired[1].EnqueuedAt.IsZero() {
+		t.Errorf("enqueued at %v and %v, want only the re-queued job to start waiting again", expired[0].EnqueuedAt, expired[1].EnqueuedAt)
+	}
+}
@@ -0,0 +1,139 @@
+package services
+
+import (
+	"TranscodingService/src/domain"
+	"TranscodingService/src/repositories"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// submitArtifactJob records and queues a trickplay or poster job, defaulting to the video's latest transcode
+func (s *transcodingServiceImpl) submitArtifactJob(request domain.TranscodingRequest) (*TranscodingResult, error) {
+	var options domain.JobOptions
+	if request.JobType() == domain.TrickplayJob {
+		trickplay := s.trickplay
+		if request.Trickplay != nil {
+			trickplay = request.Trickplay.WithDefaults(s.trickplay)
+		}
+		request.Trickplay = &trickplay
+		options.Trickplay = &trickplay
+	}
+	if request.JobType() == domain.PosterJob {
+		poster := s.posters
+		if request.Poster != nil {
+			poster = request.Poster.WithDefaults(s.posters)
+		}
+		request.Poster = &poster
+		options.Poster = &poster
+	}
+
+	if (request.InputFile == "" || request.OutputFile == "") && request.VideoID != "" {
+		source, err := s.latestTranscode(request.VideoID)
+		if err != nil {
+			return nil, err
+		}
+		if source != nil {
+			if request.InputFile == "" {
+				request.InputFile = s.publicLocation(*source, source.InputFile)
+			}
+			if request.OutputFile == "" {
+				outputDir := domain.ArtifactDir(domain.VideoFormat(source.OutputFormat), source.OutputFile, string(request.JobType()))
+				request.OutputFile = s.publicLocation(*source, outputDir)
+			}
+		}
+	}
+	if err := request.Validate(s.paths); err != nil {
+		return nil, err
+	}
+
+	jobID := uuid.New().String()
+	remote, err := s.stageRequest(jobID, &request)
+	if err != nil {
+		return nil, err
+	}
+	options.Remote = remote
+	inputFile, err := s.paths.ResolveInput(request.InputFile)
+	if err != nil {
+		return nil, err
+	}
+	if remote == nil || remote.Input == "" {
+		if _, err := s.inspectInput(inputFile); err != nil {
+			return nil, err
+		}
+	}
+	outputDir, err := s.paths.ResolveOutput(request.OutputFile)
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := json.Marshal(options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode job options: %v", err)
+	}
+
+	jobID, err = s.repo.CreateJob(repositories.TranscodingJobInput{
+		JobID:       jobID,
+		JobType:     request.JobType(),
+		Options:     string(encoded),
+		VideoID:     request.VideoID,
+		InputFormat: strings.TrimPrefix(filepath.Ext(inputFile), "."),
+		InputFile:   inputFile,
+		OutputFile:  outputDir,
+		Priority:    request.Priority,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s job: %v", request.JobType(), err)
+	}
+
+	task := &TranscodingTask{
+		ID:         jobID,
+		Type:       request.JobType(),
+		VideoID:    request.VideoID,
+		InputFile:  inputFile,
+		OutputFile: outputDir,
+		Trickplay:  options.Trickplay,
+		Poster:     options.Poster,
+		Remote:     remote,
+		Priority:   request.Priority,
+		Status:     domain.Queued,
+	}
+	if err := s.AddTask(task); err != nil {
+		s.finishJob(jobID, domain.Failed, err.Error())
+		return nil, err
+	}
+
+	s.appendLog(jobID, "Job queued: %s artifacts from %s into %s (priority %d)", task.Type, task.InputFile, task.OutputFile, task.Priority)
+	return &TranscodingResult{JobID: jobID, Status: task.Status}, nil
+}
+
+// latestTranscode returns the most recent completed transcode of a video, or nil when there is none
+func (s *transcodingServiceImpl) latestTranscode(videoID string) (*repositories.TranscodingJob, error) {
+	jobs, err := s.repo.GetJobsByVideoID(videoID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range jobs {
+		if jobs[i].JobType == domain.TranscodeJob && jobs[i].Status == domain.Completed {
+			return &jobs[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// removeArtifacts deletes only the files a job of the given type writes into its output directory
+func removeArtifacts(jobType domain.JobType, outputDir string) {
+	var files []string
+	switch jobType {
+	case domain.TrickplayJob:
+		files, _ = domain.TrickplaySprites(outputDir)
+		files = append(files, filepath.Join(outputDir, domain.TrickplayTrackName))
+	case domain.PosterJob:
+		files, _ = domain.PosterFiles(outputDir)
+	}
+	for _, file := range files {
+		removePartialOutput(file)
+	}
+}
@@ -0,0 +1,49 @@
+package services
+
+import (
+	"TranscodingService/src/domain"
+	"TranscodingService/src/repositories"
+	"encoding/json"
+	"testing"
+)
+
+func TestSubmitTrickplayDefaultsToLatestTranscode(t *testing.T) {
+	input := newTestInput(t)
+	repo := newFakeRepo(
+		repositories.TranscodingJob{JobID: "failed", JobType: domain.TranscodeJob, VideoID: "v1", InputFile: "/elsewhere.mov", OutputFormat: "mp4", OutputFile: "/out/retry.mp4", Status: domain.Failed},
+		repositories.TranscodingJob{JobID: "done", JobType: domain.TranscodeJob, VideoID: "v1", InputFile: input, OutputFormat: "hls", OutputFile: "/out/movie/master.m3u8", Status: domain.Completed},
+	)
+	s := newTestService(repo, 1)
+
+	result, err := s.Transcode(domain.TranscodingRequest{Type: domain.TrickplayJob, VideoID: "v1", Trickplay: &domain.TrickplayOptions{Columns: 4}})
+	if err != nil {
+		t.Fatalf("Transcode() = %v", err)
+	}
+	if result.Status != domain.Queued || len(repo.created) != 1 {
+		t.Fatalf("Transcode() = %+v with %d jobs created, want one queued job", result, len(repo.created))
+	}
+
+	created := repo.created[0]
+	if created.JobType != domain.TrickplayJob || created.InputFile != input || created.OutputFile != "/out/movie/trickplay" {
+		t.Errorf("created %s job from %s into %s, want a trickplay job from %s into /out/movie/trickplay", created.JobType, created.InputFile, created.OutputFile, input)
+	}
+	var options domain.JobOptions
+	if err := json.Unmarshal([]byte(created.Options), &options); err != nil {
+		t.Fatalf("stored options %q: %v", created.Options, err)
+	}
+	if want := (domain.TrickplayOptions{IntervalSeconds: 10, Columns: 4, Rows: 5, Width: 160}); options.Trickplay == nil || *options.Trickplay != want {
+		t.Errorf("stored trickplay options = %+v, want %+v", options.Trickplay, want)
+	}
+}
+
+func TestSubmitTrickplayWithoutSource(t *testing.T) {
+	repo := newFakeRepo(repositories.TranscodingJob{JobID: "running", JobType: domain.TranscodeJob, VideoID: "v1", InputFile: "/in/movie.mov", OutputFile: "/out/movie.mp4", Status: domain.Running})
+	s := newTestService(repo, 1)
+
+	if _, err := s.Transcode(domain.TranscodingRequest{Type: domain.TrickplayJob, VideoID: "v1"}); err == nil {
+		t.Fatal("Transcode() of a trickplay job with no completed transcode to read succeeded")
+	}
+	if len(repo.created) != 0 {
+		t.Errorf("created %d jobs, want none", len(repo.created))
+	}
+}
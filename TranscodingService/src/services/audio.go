@@ -0,0 +1,131 @@
+package services
+
+import (
+	"TranscodingService/src/config"
+	"TranscodingService/src/domain"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// audioDefaults is how audio is encoded when a job does not choose otherwise
+type audioDefaults struct {
+	channels   int
+	sampleRate int
+	normalize  bool
+	loudness   domain.LoudnessTarget
+}
+
+func newAudioDefaults(cfg config.AudioConfig) audioDefaults {
+	return audioDefaults{
+		channels:   cfg.Channels,
+		sampleRate: cfg.SampleRate,
+		normalize:  cfg.Loudness.Enabled,
+		loudness:   cfg.Loudness.Target(),
+	}
+}
+
+// planAudio picks the audio tracks of a task and measures their loudness when normalization is on
+func (s *transcodingServiceImpl) planAudio(ctx context.Context, task *TranscodingTask, media *domain.MediaInfo, profile *domain.EncodingProfile) (*domain.AudioPlan, error) {
+	if media == nil {
+		return nil, nil
+	}
+	options := task.Audio
+	if options == nil {
+		options = &domain.AudioOptions{}
+	}
+	tracks, err := domain.SelectAudioTracks(media, options.Languages)
+	if err != nil {
+		return nil, err
+	}
+	plan := &domain.AudioPlan{Tracks: tracks, Channels: s.audio.channels, SampleRate: s.audio.sampleRate}
+	if profile != nil && profile.AudioChannels > 0 {
+		plan.Channels = profile.AudioChannels
+	}
+	if profile != nil && profile.AudioSampleRate > 0 {
+		plan.SampleRate = profile.AudioSampleRate
+	}
+
+	normalize := s.audio.normalize
+	if options.Normalize != nil {
+		normalize = *options.Normalize
+	}
+	if !normalize || len(tracks) == 0 {
+		return plan, nil
+	}
+	target := s.audio.loudness
+	plan.Loudness = &target
+	onStart, _ := s.progressReporter(task)
+	for i := range plan.Tracks {
+		track := &plan.Tracks[i]
+		measurement, err := s.measureLoudness(ctx, task, *track, plan.Channels, onStart)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err != nil {
+			s.appendLog(task.ID, "Not normalizing %s audio stream %d: %v", track.Language, track.Stream, err)
+			continue
+		}
+		track.Loudness = measurement
+		s.appendLog(task.ID, "Measured %s audio stream %d at %.1f LUFS, %.1f dBTP, %.1f LU",
+			track.Language, track.Stream, measurement.Integrated, measurement.TruePeak, measurement.Range)
+	}
+	return plan, nil
+}
+
+// measureLoudness runs the loudnorm first pass over one audio track
+func (s *transcodingServiceImpl) measureLoudness(ctx context.Context, task *TranscodingTask, track domain.AudioTrack, channels int, onStart func(*os.Process)) (*domain.LoudnessMeasurement, error) {
+	args, err := domain.NewLoudnessMeasureCommand(s.paths, task.InputFile, track, channels, s.audio.loudness).
+		Global("-nostats").
+		Build()
+	if err != nil {
+		return nil, err
+	}
+	output, err := runCommand(ctx, exec.Command("ffmpeg", args...), onStart, nil)
+	if err != nil {
+		if ctx.Err() == nil {
+			s.appendLog(task.ID, "Loudness measurement error for audio stream %d: %v\nOutput: %s", track.Stream, err, string(output))
+		}
+		return nil, fmt.Errorf("loudness measurement failed: %v", err)
+	}
+	return domain.ParseLoudnessMeasurement(output)
+}
+
+// encodeAlternateAudio encodes every audio track after the first of an HLS task into its own playlist
+func (s *transcodingServiceImpl) encodeAlternateAudio(ctx context.Context, task *TranscodingTask, renditions []domain.Rendition, plan *domain.AudioPlan) error {
+	var source *domain.Rendition
+	for i := range renditions {
+		if renditions[i].Status == domain.RenditionCompleted {
+			source = &renditions[i]
+			break
+		}
+	}
+	if source == nil {
+		return nil
+	}
+	onStart, _ := s.progressReporter(task)
+	for n := 1; n < len(plan.Tracks); n++ {
+		track := &plan.Tracks[n]
+		playlist := domain.HLSAudioPath(filepath.Dir(task.OutputFile), n, track.Language)
+		args, err := domain.NewHLSAudioCommand(s.paths, task.InputFile, *source, n, playlist).Build()
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(playlist), 0755); err != nil {
+			return fmt.Errorf("failed to create audio directory: %v", err)
+		}
+		output, err := runCommand(ctx, exec.Command("ffmpeg", args...), onStart, nil)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			s.appendLog(task.ID, "Audio encode error for %s track: %v\nOutput: %s", track.Language, err, string(output))
+			return fmt.Errorf("encoding %s audio track failed: %v", track.Language, err)
+		}
+		track.Playlist = playlist
+		s.appendLog(task.ID, "Encoded %s audio track to %s", track.Language, playlist)
+	}
+	return nil
+}
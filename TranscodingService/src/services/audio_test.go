@@ -0,0 +1,103 @@
+package services
+
+import (
+	"TranscodingService/src/config"
+	"TranscodingService/src/domain"
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// loudnormOutput is what the loudnorm first pass logs once it has measured a track
+const loudnormOutput = `[Parsed_loudnorm_1 @ 0x55d0c4]
+{
+	"input_i" : "-27.61",
+	"input_tp" : "-4.47",
+	"input_lra" : "18.06",
+	"input_thresh" : "-39.20",
+	"target_offset" : "0.58"
+}`
+
+// fakeLoudnorm puts an ffmpeg on PATH that logs loudnormOutput, failing for the stream mapped as failMap
+func fakeLoudnorm(t *testing.T, failMap string) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake ffmpeg is a shell script")
+	}
+	script := "#!/bin/sh\n" +
+		"case \"$*\" in *'-map " + failMap + " '*) echo 'Error while decoding stream' >&2; exit 1;; esac\n" +
+		"cat >&2 <<'EOF'\n" + loudnormOutput + "\nEOF\n"
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "ffmpeg"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestPlanAudio(t *testing.T) {
+	fakeLoudnorm(t, "0:2")
+	media := &domain.MediaInfo{Streams: []domain.MediaStream{
+		{Index: 0, Type: domain.VideoStream, Codec: "h264"},
+		{Index: 1, Type: domain.AudioStream, Codec: "ac3", Language: "eng", Channels: 6},
+		{Index: 2, Type: domain.AudioStream, Codec: "aac", Language: "fre", Channels: 2},
+		{Index: 3, Type: domain.AudioStream, Codec: "aac", Language: "ger", Channels: 2},
+	}}
+	off := false
+
+	tests := []struct {
+		name         string
+		options      *domain.AudioOptions
+		profile      *domain.EncodingProfile
+		wantStreams  []int
+		wantMeasured []bool
+		wantChannels int
+	}{
+		{name: "every track normalized", wantStreams: []int{1, 2, 3}, wantMeasured: []bool{true, false, true}, wantChannels: 2},
+		{name: "selected languages", options: &domain.AudioOptions{Languages: []string{"ger", "eng"}}, wantStreams: []int{3, 1}, wantMeasured: []bool{true, true}, wantChannels: 2},
+		{name: "normalization turned off", options: &domain.AudioOptions{Normalize: &off}, wantStreams: []int{1, 2, 3}, wantMeasured: []bool{false, false, false}, wantChannels: 2},
+		{name: "profile channels", options: &domain.AudioOptions{Normalize: &off}, profile: &domain.EncodingProfile{AudioChannels: 6}, wantStreams: []int{1, 2, 3}, wantMeasured: []bool{false, false, false}, wantChannels: 6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newFakeRepo()
+			s := newTestService(repo, 1)
+			s.audio = newAudioDefaults(config.AudioConfig{Channels: 2, Loudness: config.LoudnessConfig{Enabled: true}})
+			task := &TranscodingTask{ID: "job-1", InputFile: filepath.Join(t.TempDir(), "movie.mkv"), Audio: tt.options}
+
+			plan, err := s.planAudio(context.Background(), task, media, tt.profile)
+			if err != nil {
+				t.Fatalf("planAudio() = %v", err)
+			}
+			if plan.Channels != tt.wantChannels {
+				t.Errorf("channels = %d, want %d", plan.Channels, tt.wantChannels)
+			}
+			if len(plan.Tracks) != len(tt.wantStreams) {
+				t.Fatalf("planAudio() tracks = %+v, want streams %v", plan.Tracks, tt.wantStreams)
+			}
+			for i, track := range plan.Tracks {
+				if track.Stream != tt.wantStreams[i] || (track.Loudness != nil) != tt.wantMeasured[i] {
+					t.Errorf("track %d = stream %d measured %v, want stream %d measured %v", i, track.Stream, track.Loudness != nil, tt.wantStreams[i], tt.wantMeasured[i])
+				}
+			}
+			if track := plan.Tracks[0]; track.Loudness != nil && track.Loudness.Integrated != -27.61 {
+				t.Errorf("measured %+v, want -27.61 LUFS", track.Loudness)
+			}
+			if measured := tt.wantMeasured[0]; measured != (plan.Loudness != nil) {
+				t.Errorf("plan target = %+v, want one only when normalizing", plan.Loudness)
+			}
+		})
+	}
+
+	repo := newFakeRepo()
+	s := newTestService(repo, 1)
+	s.audio = newAudioDefaults(config.AudioConfig{Loudness: config.LoudnessConfig{Enabled: true}})
+	if _, err := s.planAudio(context.Background(), &TranscodingTask{ID: "job-1"}, media, nil); err != nil {
+		t.Fatal(err)
+	}
+	if logs := strings.Join(repo.logs["job-1"], "\n"); !strings.Contains(logs, "Not normalizing fre audio stream 2") {
+		t.Errorf("failed measurement was not logged:\n%s", logs)
+	}
+}
@@ -0,0 +1,146 @@
+package services
+
+import (
+	"TranscodingService/src/domain"
+	"bufio"
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// ffmpegCapabilities records which encoders and muxers the local ffmpeg build provides
+type ffmpegCapabilities struct {
+	encoders map[string]bool
+	muxers   map[string]bool
+}
+
+// capabilityCache holds the capabilities of the local ffmpeg once they have been read successfully
+type capabilityCache struct {
+	mu   sync.Mutex
+	caps *ffmpegCapabilities
+}
+
+// get returns the cached capabilities, detecting them on first use and retrying failed detections
+func (c *capabilityCache) get() (*ffmpegCapabilities, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.caps != nil {
+		return c.caps, nil
+	}
+
+	encoders, err := listFFmpegComponents("-encoders")
+	if err != nil {
+		return nil, err
+	}
+	muxers, err := listFFmpegComponents("-muxers")
+	if err != nil {
+		return nil, err
+	}
+	c.caps = &ffmpegCapabilities{encoders: encoders, muxers: muxers}
+	return c.caps, nil
+}
+
+// listFFmpegComponents collects the names ffmpeg prints after the "--" line of a listing such as -encoders
+func listFFmpegComponents(flag string) (map[string]bool, error) {
+	output, err := exec.Command("ffmpeg", "-hide_banner", flag).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ffmpeg %s: %v", strings.TrimPrefix(flag, "-"), err)
+	}
+
+	names := make(map[string]bool)
+	listing := false
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			if len(fields) == 1 && strings.HasPrefix(fields[0], "--") {
+				listing = true
+			}
+			continue
+		}
+		if !listing {
+			continue
+		}
+		for _, name := range strings.Split(fields[1], ",") {
+			names[name] = true
+		}
+	}
+	return names, scanner.Err()
+}
+
+// supportsFormat reports whether ffmpeg can write the format
+func (c *ffmpegCapabilities) supportsFormat(format domain.VideoFormat) bool {
+	return c.muxers[format.Muxer()]
+}
+
+// supportsVideo reports whether ffmpeg can encode the video codec
+func (c *ffmpegCapabilities) supportsVideo(codec domain.VideoCodec) bool {
+	return c.encoders[codec.Encoder()]
+}
+
+// supportsAudio reports whether ffmpeg can encode the audio codec
+func (c *ffmpegCapabilities) supportsAudio(codec domain.AudioCodec) bool {
+	return c.encoders[codec.Encoder()]
+}
+
+// codecAllowList holds the codecs enabled in the configuration; an empty list enables every codec
+type codecAllowList map[string]bool
+
+func newCodecAllowList(codecs []string) codecAllowList {
+	allowed := make(codecAllowList, len(codecs))
+	for _, codec := range codecs {
+		allowed[strings.ToLower(codec)] = true
+	}
+	return allowed
+}
+
+func (a codecAllowList) allows(codec string) bool {
+	return len(a) == 0 || a[codec]
+}
+
+// GetSupportedFormats reports the enabled formats and codecs the local ffmpeg build can produce
+func (s *transcodingServiceImpl) GetSupportedFormats() ([]domain.FormatSupport, error) {
+	caps, err := s.capabilities.get()
+	if err != nil {
+		return nil, err
+	}
+	return domain.FormatSupportFor(caps.supportsFormat,
+		func(codec domain.VideoCodec) bool {
+			return s.videoCodecs.allows(string(codec)) && caps.supportsVideo(codec)
+		},
+		func(codec domain.AudioCodec) bool {
+			return s.audioCodecs.allows(string(codec)) && caps.supportsAudio(codec)
+		}), nil
+}
+
+// GetProfiles lists the configured encoding profiles by name
+func (s *transcodingServiceImpl) GetProfiles() []domain.EncodingProfile {
+	return domain.SortedProfiles(s.profiles)
+}
+
+// checkEncoders rejects codecs that are disabled in the configuration or that the local ffmpeg cannot produce
+func (s *transcodingServiceImpl) checkEncoders(format domain.VideoFormat, video domain.VideoCodec, audio domain.AudioCodec) error {
+	if !s.videoCodecs.allows(string(video)) {
+		return fmt.Errorf("%w: %s video is not enabled", domain.ErrUnsupportedCodec, video)
+	}
+	if !s.audioCodecs.allows(string(audio)) {
+		return fmt.Errorf("%w: %s audio is not enabled", domain.ErrUnsupportedCodec, audio)
+	}
+
+	caps, err := s.capabilities.get()
+	if err != nil {
+		return err
+	}
+	if !caps.supportsFormat(format) {
+		return fmt.Errorf("%w: this ffmpeg build cannot write %s", domain.ErrUnsupportedCodec, format)
+	}
+	if !caps.supportsVideo(video) {
+		return fmt.Errorf("%w: this ffmpeg build has no %s encoder", domain.ErrUnsupportedCodec, video.Encoder())
+	}
+	if !caps.supportsAudio(audio) {
+		return fmt.Errorf("%w: this ffmpeg build has no %s encoder", domain.ErrUnsupportedCodec, audio.Encoder())
+	}
+	return nil
+}
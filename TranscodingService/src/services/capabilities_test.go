@@ -0,0 +1,87 @@
+package services
+
+import (
+	"TranscodingService/src/domain"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// fullCapabilities is an ffmpeg build with every encoder and muxer the service can use
+func fullCapabilities() *ffmpegCapabilities {
+	return &ffmpegCapabilities{
+		encoders: map[string]bool{"libx264": true, "libx265": true, "libvpx-vp9": true, "libaom-av1": true, "aac": true, "libopus": true},
+		muxers:   map[string]bool{"mp4": true, "matroska": true, "avi": true, "mov": true, "webm": true, "hls": true, "dash": true},
+	}
+}
+
+func TestCheckEncoders(t *testing.T) {
+	noAV1 := fullCapabilities()
+	delete(noAV1.encoders, "libaom-av1")
+	noWebM := fullCapabilities()
+	delete(noWebM.muxers, "webm")
+
+	tests := []struct {
+		name   string
+		caps   *ffmpegCapabilities
+		video  []string
+		audio  []string
+		format domain.VideoFormat
+		codecs [2]string
+		ok     bool
+	}{
+		{name: "available and enabled", caps: fullCapabilities(), format: domain.WebM, codecs: [2]string{"vp9", "opus"}, ok: true},
+		{name: "enabled through the allow list", caps: fullCapabilities(), video: []string{"H265"}, audio: []string{"aac"}, format: domain.MP4, codecs: [2]string{"h265", "aac"}, ok: true},
+		{name: "video codec not enabled", caps: fullCapabilities(), video: []string{"h264"}, format: domain.MP4, codecs: [2]string{"h265", "aac"}},
+		{name: "audio codec not enabled", caps: fullCapabilities(), audio: []string{"aac"}, format: domain.WebM, codecs: [2]string{"vp9", "opus"}},
+		{name: "no encoder in this build", caps: noAV1, format: domain.MP4, codecs: [2]string{"av1", "aac"}},
+		{name: "no muxer in this build", caps: noWebM, format: domain.WebM, codecs: [2]string{"vp9", "opus"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &transcodingServiceImpl{videoCodecs: newCodecAllowList(tt.video), audioCodecs: newCodecAllowList(tt.audio)}
+			s.capabilities.caps = tt.caps
+
+			err := s.checkEncoders(tt.format, domain.VideoCodec(tt.codecs[0]), domain.AudioCodec(tt.codecs[1]))
+			if tt.ok {
+				if err != nil {
+					t.Errorf("checkEncoders() = %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, domain.ErrUnsupportedCodec) {
+				t.Errorf("checkEncoders() = %v, want %v", err, domain.ErrUnsupportedCodec)
+			}
+		})
+	}
+}
+
+func TestGetSupportedFormats(t *testing.T) {
+	caps := fullCapabilities()
+	delete(caps.encoders, "libx265")
+	delete(caps.muxers, "avi")
+	s := &transcodingServiceImpl{videoCodecs: newCodecAllowList([]string{"h264", "h265", "vp9"}), audioCodecs: newCodecAllowList(nil)}
+	s.capabilities.caps = caps
+
+	support, err := s.GetSupportedFormats()
+	if err != nil {
+		t.Fatalf("GetSupportedFormats() = %v", err)
+	}
+	got := make(map[domain.VideoFormat]domain.FormatSupport)
+	for _, entry := range support {
+		got[entry.Format] = entry
+	}
+	if _, ok := got[domain.AVI]; ok {
+		t.Error("avi listed without a muxer")
+	}
+	if want := []domain.VideoCodec{domain.H264}; !reflect.DeepEqual(got[domain.MP4].VideoCodecs, want) {
+		t.Errorf("mp4 video codecs = %v, want %v", got[domain.MP4].VideoCodecs, want)
+	}
+	if want := []domain.VideoCodec{domain.VP9}; !reflect.DeepEqual(got[domain.WebM].VideoCodecs, want) {
+		t.Errorf("webm video codecs = %v, want %v", got[domain.WebM].VideoCodecs, want)
+	}
+	if want := []domain.AudioCodec{domain.AAC, domain.Opus}; !reflect.DeepEqual(got[domain.MKV].AudioCodecs, want) {
+		t.Errorf("mkv audio codecs = %v, want %v", got[domain.MKV].AudioCodecs, want)
+	}
+}
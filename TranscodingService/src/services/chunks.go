@@ -0,0 +1,193 @@
+package services
+
+import (
+	"TranscodingService/src/domain"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// chunkDurationTolerance is how far the length of a joined output may stray from the source
+const chunkDurationTolerance = time.Second
+
+// chunkKeyframes lists the keyframes to split a task's input at, or nil to encode in one piece
+func (s *transcodingServiceImpl) chunkKeyframes(ctx context.Context, task *TranscodingTask, duration time.Duration) []time.Duration {
+	if task.Format.IsStreaming() || s.chunking.MinDuration == 0 || duration < s.chunking.MinDuration {
+		return nil
+	}
+	keyframes, err := probeKeyframes(ctx, task.InputFile)
+	if err != nil {
+		if ctx.Err() == nil {
+			s.appendLog(task.ID, "Encoding without chunks, the input's keyframes could not be listed: %v", err)
+		}
+		return nil
+	}
+	return keyframes
+}
+
+// encodeChunked encodes a rendition as keyframe-aligned chunks across the worker pool and joins them
+func (s *transcodingServiceImpl) encodeChunked(ctx context.Context, task *TranscodingTask, rendition domain.Rendition, chunks []domain.Chunk, duration time.Duration) error {
+	dir := filepath.Dir(chunks[0].File)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create chunk directory: %v", err)
+	}
+	s.appendLog(task.ID, "Encoding %s rendition in %d chunks across the worker pool", rendition.Resolution, len(chunks))
+
+	s.taskMutex.Lock()
+	task.chunked = true
+	s.taskMutex.Unlock()
+	defer func() {
+		s.taskMutex.Lock()
+		task.chunked = false
+		s.taskMutex.Unlock()
+	}()
+
+	// Progress is the share of the source encoded across all chunks, with their speeds added up
+	_, onProgress := s.progressReporter(task)
+	var progressMutex sync.Mutex
+	encoded := make([]time.Duration, len(chunks))
+	speeds := make([]float64, len(chunks))
+	fps := make([]float64, len(chunks))
+	report := func(i int, p ffmpegProgress) {
+		progressMutex.Lock()
+		encoded[i], speeds[i], fps[i] = p.OutTime, p.Speed, p.FPS
+		if p.Done || encoded[i] > chunks[i].Duration() {
+			encoded[i], speeds[i], fps[i] = chunks[i].Duration(), 0, 0
+		}
+		var total ffmpegProgress
+		for j := range chunks {
+			total.OutTime += encoded[j]
+			total.Speed += speeds[j]
+			total.FPS += fps[j]
+		}
+		progressMutex.Unlock()
+		onProgress(total)
+	}
+
+	chunkCtx, cancelChunks := context.WithCancel(ctx)
+	defer cancelChunks()
+	var wg sync.WaitGroup
+	var failure error
+	var failureOnce sync.Once
+	for i, chunk := range chunks {
+		if _, err := os.Stat(chunk.File); err == nil {
+			report(i, ffmpegProgress{Done: true})
+			s.appendLog(task.ID, "Reusing chunk %d of %s rendition from an earlier attempt", chunk.Index, rendition.Resolution)
+			continue
+		}
+		i, chunk := i, chunk
+		wg.Add(1)
+		s.taskQueue.PushChunk(&chunkWork{taskID: task.ID, run: func() {
+			defer wg.Done()
+			err := s.encodeChunk(chunkCtx, task, rendition, chunk, func(p ffmpegProgress) { report(i, p) })
+			if err != nil && chunkCtx.Err() == nil {
+				failureOnce.Do(func() { failure = err })
+				cancelChunks()
+			}
+		}})
+	}
+	for work := s.taskQueue.TakeChunk(task.ID); work != nil; work = s.taskQueue.TakeChunk(task.ID) {
+		work.run()
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if failure != nil {
+		return failure
+	}
+
+	if err := s.joinChunks(ctx, task, rendition, chunks, duration); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		log.Printf("Failed to remove chunks of job %s: %v", task.ID, err)
+	}
+	return nil
+}
+
+// encodeChunk encodes one chunk, retrying it up to the configured number of attempts
+func (s *transcodingServiceImpl) encodeChunk(ctx context.Context, task *TranscodingTask, rendition domain.Rendition, chunk domain.Chunk, onProgress func(ffmpegProgress)) error {
+	args, err := domain.NewChunkCommand(s.paths, task.InputFile, rendition, chunk).
+		Global("-nostats", "-progress", "pipe:1").
+		Build()
+	if err != nil {
+		return err
+	}
+	partial := domain.PartialChunkFile(chunk)
+	for attempt := 1; ; attempt++ {
+		cmd := exec.Command("ffmpeg", args...)
+		output, err := runCommand(ctx, cmd, nil, onProgress)
+		s.recordUsage(task, cmd)
+		if err == nil {
+			if err := os.Rename(partial, chunk.File); err != nil {
+				return fmt.Errorf("failed to keep chunk %d: %v", chunk.Index, err)
+			}
+			return nil
+		}
+		removePartialOutput(partial)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		s.appendLog(task.ID, "Chunk %d of %s rendition failed on attempt %d of %d: %v\nOutput: %s",
+			chunk.Index, rendition.Resolution, attempt, s.chunking.Attempts, err, string(output))
+		if attempt >= s.chunking.Attempts {
+			return fmt.Errorf("chunk %d of %s rendition failed after %d attempts: %v", chunk.Index, rendition.Resolution, attempt, err)
+		}
+	}
+}
+
+// joinChunks concatenates the encoded chunks and audio into the rendition, checking its length against the source
+func (s *transcodingServiceImpl) joinChunks(ctx context.Context, task *TranscodingTask, rendition domain.Rendition, chunks []domain.Chunk, duration time.Duration) error {
+	list, err := domain.WriteChunkList(filepath.Dir(chunks[0].File), chunks)
+	if err != nil {
+		return err
+	}
+	args, err := domain.NewChunkJoinCommand(s.paths, task.Format, task.InputFile, list, rendition).Build()
+	if err != nil {
+		return err
+	}
+	onStart, _ := s.progressReporter(task)
+	cmd := exec.Command("ffmpeg", args...)
+	output, err := runCommand(ctx, cmd, onStart, nil)
+	s.recordUsage(task, cmd)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		s.appendLog(task.ID, "Joining chunks of %s rendition failed: %v\nOutput: %s", rendition.Resolution, err, string(output))
+		return fmt.Errorf("joining chunks of %s rendition failed: %v", rendition.Resolution, err)
+	}
+
+	media, err := probeMedia(ctx, rendition.OutputFile)
+	if err != nil {
+		return fmt.Errorf("could not verify joined %s rendition: %v", rendition.Resolution, err)
+	}
+	if drift := media.Duration() - duration; drift > chunkDurationTolerance || drift < -chunkDurationTolerance {
+		removePartialOutput(rendition.OutputFile)
+		return fmt.Errorf("joined %s rendition runs %s but the source runs %s", rendition.Resolution, media.Duration(), duration)
+	}
+	s.appendLog(task.ID, "Joined %d chunks into %s, %s long", len(chunks), rendition.OutputFile, media.Duration())
+	return nil
+}
+
+// removeChunks deletes the chunks of renditions a cancelled run did not complete
+func removeChunks(format domain.VideoFormat, renditions []domain.Rendition) {
+	if format.IsStreaming() {
+		return
+	}
+	for _, rendition := range renditions {
+		if rendition.Status == domain.RenditionCompleted {
+			continue
+		}
+		dir := domain.ArtifactDir(format, rendition.OutputFile, "chunks")
+		if err := os.RemoveAll(dir); err != nil {
+			log.Printf("Failed to remove chunks %s: %v", dir, err)
+		}
+	}
+}
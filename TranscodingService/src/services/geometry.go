@@ -0,0 +1,81 @@
+package services
+
+import (
+	"TranscodingService/src/domain"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os/exec"
+	"time"
+)
+
+// cropSampleSeconds is how much of the source cropdetect looks at
+const cropSampleSeconds = 30
+
+// planGeometry detects black bars when asked and plans the filter chain of every rendition
+func (s *transcodingServiceImpl) planGeometry(ctx context.Context, task *TranscodingTask, media *domain.MediaInfo) domain.OutputMetadata {
+	metadata := domain.OutputMetadata{Padded: task.Pad}
+	if media != nil {
+		if video := media.VideoStream(); video != nil {
+			metadata.SourceWidth, metadata.SourceHeight = video.Width, video.Height
+		}
+	}
+
+	if task.AutoCrop {
+		if metadata.SourceWidth == 0 {
+			s.appendLog(task.ID, "Skipping black bar detection, the source frame size is unknown")
+		} else {
+			crop, err := detectCrop(ctx, s.paths, task.InputFile, media.Duration(), metadata.SourceWidth, metadata.SourceHeight)
+			if err != nil {
+				s.appendLog(task.ID, "Black bar detection failed, encoding the full frame: %v", err)
+			} else if crop != nil {
+				s.appendLog(task.ID, "Cropping black bars to %dx%d at %d,%d", crop.Width, crop.Height, crop.X, crop.Y)
+			}
+			metadata.Crop = crop
+		}
+	}
+
+	s.taskMutex.Lock()
+	for i := range task.Renditions {
+		geometry := domain.PlanGeometry(metadata.SourceWidth, metadata.SourceHeight, metadata.Crop, task.Renditions[i].Resolution, task.Pad)
+		task.Renditions[i].ApplyGeometry(geometry)
+		metadata.Renditions = append(metadata.Renditions, geometry)
+	}
+	s.taskMutex.Unlock()
+
+	s.saveMetadata(task.ID, metadata)
+	return metadata
+}
+
+// saveMetadata records a job's output metadata, logging failures
+func (s *transcodingServiceImpl) saveMetadata(jobID string, metadata domain.OutputMetadata) {
+	encoded, err := json.Marshal(metadata)
+	if err != nil {
+		log.Printf("Failed to encode output metadata for job %s: %v", jobID, err)
+		return
+	}
+	if err := s.repo.UpdateJobMetadata(jobID, string(encoded)); err != nil {
+		log.Printf("Failed to persist output metadata for job %s: %v", jobID, err)
+	}
+}
+
+// detectCrop runs cropdetect over a sample from the first part of the source, past any opening titles
+func detectCrop(ctx context.Context, paths domain.PathPolicy, inputFile string, duration time.Duration, width, height int) (*domain.CropArea, error) {
+	start := duration.Seconds() / 10
+	length := float64(cropSampleSeconds)
+	if remaining := duration.Seconds() - start; duration > 0 && remaining < length {
+		length = remaining
+	}
+
+	args, err := domain.NewCropDetectCommand(paths, inputFile, start, length).Build()
+	if err != nil {
+		return nil, err
+	}
+	output, err := runCommand(ctx, exec.Command("ffmpeg", args...), nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("cropdetect failed: %v", err)
+	}
+	return domain.ParseCropDetect(bytes.NewReader(output), width, height)
+}
@@ -0,0 +1,272 @@
+package services
+
+import (
+	"TranscodingService/src/domain"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// WorkerStatus is the externally visible state of a registered worker process
+type WorkerStatus struct {
+	WorkerID     string    `json:"worker_id"`
+	Hostname     string    `json:"hostname"`
+	Slots        int       `json:"slots"`
+	ActiveJobs   int       `json:"active_jobs"`
+	RegisteredAt time.Time `json:"registered_at"`
+	HeartbeatAt  time.Time `json:"heartbeat_at"`
+	Alive        bool      `json:"alive"` // renewed its leases within the lease duration
+}
+
+// startLeasing registers this process as a worker and claims, renews and expires job leases
+func (s *transcodingServiceImpl) startLeasing() {
+	s.registerWorker()
+	go s.renewLeases()
+	go s.expireLeases()
+	for i := 0; i < s.maxConcurrent; i++ {
+		go s.leaseWorker()
+	}
+}
+
+// registerWorker records this process in the repository, retrying until it succeeds
+func (s *transcodingServiceImpl) registerWorker() {
+	hostname, err := os.Hostname()
+	if err != nil {
+		log.Printf("Registering worker without a hostname: %v", err)
+	}
+	for {
+		workerID, err := s.repo.RegisterWorker(hostname, s.maxConcurrent)
+		if err == nil {
+			s.workerID = workerID
+			break
+		}
+		log.Printf("Failed to register worker, retrying in %s: %v", s.leases.Poll, err)
+		time.Sleep(s.leases.Poll)
+	}
+	log.Printf("Registered as worker %s with %d slots", s.workerID, s.maxConcurrent)
+}
+
+// leaseWorker claims and runs jobs one at a time, encoding offered chunks in between
+func (s *transcodingServiceImpl) leaseWorker() {
+	for {
+		if chunk := s.taskQueue.PopChunk(); chunk != nil {
+			chunk.run()
+			continue
+		}
+		job, err := s.repo.ClaimJob(s.workerID, s.leases.Lease, s.agingInterval, s.retryDelay)
+		if err != nil || job == nil {
+			time.Sleep(s.leases.Poll)
+			continue
+		}
+
+		task := taskFromJob(*job, domain.Running, s.loadRenditions(*job))
+		task.leased = true
+		ctx := s.startLeasedTask(task)
+		s.processTask(ctx, task)
+		s.completeTask(task)
+	}
+}
+
+// startLeasedTask moves a claimed task into activeTasks under a cancellable context
+func (s *transcodingServiceImpl) startLeasedTask(task *TranscodingTask) context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.taskMutex.Lock()
+	task.cancel = cancel
+	task.StartedAt = time.Now()
+	s.activeTasks[task.ID] = task
+	s.taskMutex.Unlock()
+
+	s.appendLog(task.ID, "Task %s started on worker %s.", task.ID, s.workerID)
+	return ctx
+}
+
+// renewLeases extends the leases of running jobs every heartbeat, stopping those no longer held here
+func (s *transcodingServiceImpl) renewLeases() {
+	renewedAt := time.Now()
+	for range time.Tick(s.leases.Heartbeat) {
+		tasks := s.leasedTasks()
+		jobIDs := make([]string, 0, len(tasks))
+		for jobID := range tasks {
+			jobIDs = append(jobIDs, jobID)
+		}
+
+		held, err := s.repo.RenewLeases(s.workerID, jobIDs, s.leases.Lease)
+		if err != nil {
+			if time.Since(renewedAt) >= s.leases.Lease {
+				for _, task := range tasks {
+					s.dropLease(task, "its lease could not be renewed")
+				}
+			}
+			continue
+		}
+		renewedAt = time.Now()
+
+		for _, jobID := range held {
+			delete(tasks, jobID)
+		}
+		for jobID, task := range tasks {
+			if job, err := s.repo.GetJobStatus(jobID); err == nil && job.Status == domain.Cancelled {
+				if err := s.CancelTask(jobID); err != nil {
+					log.Printf("Failed to stop cancelled task %s: %v", jobID, err)
+				}
+				continue
+			}
+			s.dropLease(task, "its lease was handed to another worker")
+		}
+	}
+}
+
+// leasedTasks returns the running tasks this process holds leases for, keyed by job ID
+func (s *transcodingServiceImpl) leasedTasks() map[string]*TranscodingTask {
+	s.taskMutex.Lock()
+	defer s.taskMutex.Unlock()
+	tasks := make(map[string]*TranscodingTask)
+	for jobID, task := range s.activeTasks {
+		if task.leased && !task.leaseLost {
+			tasks[jobID] = task
+		}
+	}
+	return tasks
+}
+
+// dropLease stops a task whose lease this process no longer holds, leaving the job to the repository
+func (s *transcodingServiceImpl) dropLease(task *TranscodingTask, reason string) {
+	s.taskMutex.Lock()
+	defer s.taskMutex.Unlock()
+	if s.activeTasks[task.ID] != task {
+		return
+	}
+	task.leaseLost = true
+	task.cancel()
+	log.Printf("Stopping task %s, %s", task.ID, reason)
+}
+
+// expireLeases re-queues the jobs of workers that stopped renewing their leases every heartbeat
+func (s *transcodingServiceImpl) expireLeases() {
+	for range time.Tick(s.leases.Heartbeat) {
+		jobs, err := s.repo.ExpireLeases(s.maxRetries)
+		if err != nil {
+			continue
+		}
+		for _, job := range jobs {
+			if job.Status == domain.Failed {
+				s.appendLog(job.JobID, "Lease of worker %s expired and the job has no retries left", job.WorkerID)
+			} else {
+				s.appendLog(job.JobID, "Lease of worker %s expired, re-queuing", job.WorkerID)
+			}
+		}
+	}
+}
+
+// GetWorkers lists the worker processes registered to claim jobs
+func (s *transcodingServiceImpl) GetWorkers() ([]WorkerStatus, error) {
+	workers, err := s.repo.GetWorkers()
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]WorkerStatus, 0, len(workers))
+	for _, worker := range workers {
+		statuses = append(statuses, WorkerStatus{
+			WorkerID:     worker.WorkerID,
+			Hostname:     worker.Hostname,
+			Slots:        worker.Slots,
+			ActiveJobs:   worker.ActiveJobs,
+			RegisteredAt: worker.RegisteredAt,
+			HeartbeatAt:  worker.HeartbeatAt,
+			Alive:        time.Since(worker.HeartbeatAt) < s.leases.Lease,
+		})
+	}
+	return statuses, nil
+}
+
+// remoteQueue reports whether waiting jobs are tracked in the repository rather than by this process
+func (s *transcodingServiceImpl) remoteQueue() bool {
+	return s.distributed || s.brokered
+}
+
+// isActive reports whether a job is running in this process
+func (s *transcodingServiceImpl) isActive(jobID string) bool {
+	s.taskMutex.Lock()
+	defer s.taskMutex.Unlock()
+	_, active := s.activeTasks[jobID]
+	return active
+}
+
+// cancelStoredJob cancels a job this process is not running, which its runner stops at its next check
+func (s *transcodingServiceImpl) cancelStoredJob(jobID string) error {
+	job, err := s.repo.GetJobStatus(jobID)
+	if err != nil {
+		return err
+	}
+	if err := job.Status.ValidateTransition(domain.Cancelled); err != nil {
+		return err
+	}
+	if err := s.repo.MarkJobFinished(jobID, domain.Cancelled, ""); err != nil {
+		return err
+	}
+	s.appendLog(jobID, "Job cancelled")
+	return nil
+}
+
+// pauseStoredJob holds a job waiting in the repository back from the workers
+func (s *transcodingServiceImpl) pauseStoredJob(jobID string) error {
+	job, err := s.repo.GetJobStatus(jobID)
+	if err != nil {
+		return err
+	}
+	if job.Status == domain.Running {
+		return fmt.Errorf("job %s is running on worker %s and cannot be paused: %w", jobID, job.WorkerID, ErrNotSupported)
+	}
+	if err := job.Status.ValidateTransition(domain.Paused); err != nil {
+		return err
+	}
+	if err := s.repo.UpdateJobStatus(jobID, domain.Paused); err != nil {
+		return err
+	}
+	s.appendLog(jobID, "Queued job paused")
+	return nil
+}
+
+// resumeStoredJob lets the workers claim a paused job again
+func (s *transcodingServiceImpl) resumeStoredJob(jobID string) error {
+	job, err := s.repo.GetJobStatus(jobID)
+	if err != nil {
+		return err
+	}
+	if job.Status != domain.Paused {
+		return fmt.Errorf("job %s is not paused", jobID)
+	}
+	if err := s.repo.UpdateJobStatus(jobID, domain.Queued); err != nil {
+		return err
+	}
+	if s.brokered {
+		job.Status = domain.Queued
+		if err := s.AddTask(taskFromJob(job, domain.Queued, s.loadRenditions(job))); err != nil {
+			s.finishJob(jobID, domain.Failed, err.Error())
+			return err
+		}
+	}
+	s.appendLog(jobID, "Paused job returned to the queue")
+	return nil
+}
+
+// prioritizeStoredJob changes the priority of a job waiting in the repository
+func (s *transcodingServiceImpl) prioritizeStoredJob(jobID string, priority int) error {
+	job, err := s.repo.GetJobStatus(jobID)
+	if err != nil {
+		return err
+	}
+	if job.Status != domain.Queued && job.Status != domain.Retrying {
+		return fmt.Errorf("job %s is not waiting in the queue", jobID)
+	}
+	if s.brokered && !s.taskQueue.UpdatePriority(jobID, priority) {
+		return fmt.Errorf("failed to publish job %s at priority %d", jobID, priority)
+	}
+	if err := s.repo.UpdateJobPriority(jobID, priority); err != nil {
+		return err
+	}
+	s.appendLog(jobID, "Priority changed to %d", priority)
+	return nil
+}
@@ -0,0 +1,73 @@
+package services
+
+import (
+	"TranscodingService/src/domain"
+	"TranscodingService/src/repositories"
+	"context"
+	"errors"
+	"testing"
+)
+
+func newDistributedService(repo *fakeRepo) *transcodingServiceImpl {
+	s := newTestService(repo, 1)
+	s.distributed = true
+	s.workerID = "worker-1"
+	return s
+}
+
+func TestCancelJobStoredElsewhere(t *testing.T) {
+	repo := newFakeRepo(repositories.TranscodingJob{JobID: "job-1", Status: domain.Running, WorkerID: "worker-2"})
+	s := newDistributedService(repo)
+
+	if err := s.CancelJob("job-1"); err != nil {
+		t.Fatalf("CancelJob() = %v", err)
+	}
+	if status := repo.jobs["job-1"].Status; status != domain.Cancelled {
+		t.Errorf("status = %s, want %s for the holding worker to see at its heartbeat", status, domain.Cancelled)
+	}
+}
+
+func TestPauseJobStoredElsewhere(t *testing.T) {
+	repo := newFakeRepo(
+		repositories.TranscodingJob{JobID: "job-1", Status: domain.Running, WorkerID: "worker-2"},
+		repositories.TranscodingJob{JobID: "job-2", Status: domain.Queued},
+	)
+	s := newDistributedService(repo)
+
+	if err := s.PauseJob("job-1"); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("PauseJob() of a job running on another worker = %v, want %v", err, ErrNotSupported)
+	}
+	if err := s.PauseJob("job-2"); err != nil {
+		t.Fatalf("PauseJob() = %v", err)
+	}
+	if status := repo.jobs["job-2"].Status; status != domain.Paused {
+		t.Fatalf("status = %s, want %s", status, domain.Paused)
+	}
+	if err := s.ResumeJob("job-2"); err != nil {
+		t.Fatalf("ResumeJob() = %v", err)
+	}
+	if status := repo.jobs["job-2"].Status; status != domain.Queued {
+		t.Errorf("status = %s, want %s", status, domain.Queued)
+	}
+}
+
+func TestDropLease(t *testing.T) {
+	s := newDistributedService(newFakeRepo())
+	ctx, cancel := context.WithCancel(context.Background())
+	task := &TranscodingTask{ID: "job-1", leased: true, cancel: cancel}
+	s.activeTasks[task.ID] = task
+
+	if tasks := s.leasedTasks(); tasks["job-1"] != task {
+		t.Fatalf("leasedTasks() = %v, want job-1", tasks)
+	}
+	s.dropLease(task, "its lease was handed to another worker")
+	if ctx.Err() == nil || !task.leaseLost {
+		t.Fatal("dropLease() left the task running")
+	}
+	if tasks := s.leasedTasks(); len(tasks) != 0 {
+		t.Errorf("leasedTasks() = %v, want a lost lease left out of renewals", tasks)
+	}
+
+	stale := &TranscodingTask{ID: "job-1", leased: true, cancel: func() { t.Error("dropLease() stopped a task that is no longer active") }}
+	s.dropLease(stale, "its lease could not be renewed")
+}
@@ -0,0 +1,204 @@
+package services
+
+import (
+	"TranscodingService/src/domain"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+// encodeRenditions encodes the pending renditions of a task, sharing one decode among those encoded in one piece
+func (s *transcodingServiceImpl) encodeRenditions(ctx context.Context, task *TranscodingTask, renditions []domain.Rendition, pending []int, duration time.Duration) (*domain.EncodeStats, error) {
+	if len(pending) == 0 {
+		return nil, nil
+	}
+	keyframes := s.chunkKeyframes(ctx, task, duration)
+	chunks := make(map[int][]domain.Chunk)
+	var shared, separate []int
+	for _, i := range pending {
+		if renditions[i].TwoPass != nil {
+			separate = append(separate, i)
+			continue
+		}
+		if keyframes != nil {
+			if plan := domain.PlanChunks(keyframes, duration, s.chunking.Length, domain.ArtifactDir(task.Format, renditions[i].OutputFile, "chunks")); len(plan) > 1 {
+				chunks[i] = plan
+				separate = append(separate, i)
+				continue
+			}
+		}
+		shared = append(shared, i)
+	}
+	if len(shared) < 2 {
+		separate = append(shared, separate...)
+		shared = nil
+	}
+
+	s.taskMutex.Lock()
+	task.encodeCount = passCount(renditions, separate)
+	if len(shared) > 0 {
+		task.encodeCount++
+	}
+	task.encodeRuns, task.encodeCPU = 0, 0
+	s.taskMutex.Unlock()
+
+	stats := &domain.EncodeStats{}
+	encodeIndex := 0
+	if len(shared) > 0 {
+		err := s.encodeShared(ctx, task, renditions, shared)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err == nil {
+			stats.SharedWith = len(shared)
+			encodeIndex++
+		} else {
+			s.appendLog(task.ID, "Falling back to encoding each rendition on its own: %v", err)
+			separate = append(shared, separate...)
+			s.taskMutex.Lock()
+			task.encodeCount = passCount(renditions, separate)
+			s.taskMutex.Unlock()
+		}
+	}
+
+	for _, i := range separate {
+		s.setRenditionStatus(task, i, domain.RenditionRunning, "")
+		s.taskMutex.Lock()
+		task.encodeIndex = encodeIndex
+		s.taskMutex.Unlock()
+		encodeIndex += passCount(renditions, []int{i})
+
+		var err error
+		if plan, ok := chunks[i]; ok {
+			err = s.encodeChunked(ctx, task, renditions[i], plan, duration)
+		} else if renditions[i].TwoPass != nil {
+			err = s.encodeTwoPass(ctx, task, renditions[i])
+		} else {
+			err = s.encodeRendition(ctx, task, renditions[i])
+		}
+		if ctx.Err() != nil {
+			s.setRenditionStatus(task, i, domain.RenditionQueued, "")
+			return nil, ctx.Err()
+		}
+		if err != nil {
+			s.setRenditionStatus(task, i, domain.RenditionFailed, err.Error())
+			return nil, err
+		}
+		s.setRenditionStatus(task, i, domain.RenditionCompleted, "")
+	}
+
+	s.taskMutex.Lock()
+	stats.Invocations = task.encodeRuns
+	stats.CPUSeconds = task.encodeCPU.Seconds()
+	s.taskMutex.Unlock()
+	if stats.SharedWith > 1 {
+		if decode, err := s.estimateDecodeCPU(ctx, task, duration); err != nil {
+			s.appendLog(task.ID, "Could not estimate the CPU time the shared decode saved: %v", err)
+		} else {
+			stats.CPUSecondsSaved = decode.Seconds() * float64(stats.SharedWith-1)
+			s.appendLog(task.ID, "Encoded %d renditions from one decode, saving about %.0fs of CPU time", stats.SharedWith, stats.CPUSecondsSaved)
+		}
+	}
+	return stats, nil
+}
+
+// encodeShared runs one ffmpeg invocation that decodes the source once and encodes every listed rendition
+func (s *transcodingServiceImpl) encodeShared(ctx context.Context, task *TranscodingTask, renditions []domain.Rendition, positions []int) error {
+	group := make([]domain.Rendition, len(positions))
+	for n, i := range positions {
+		group[n] = renditions[i]
+	}
+	args, err := domain.NewMultiRenditionCommand(s.paths, task.Format, task.InputFile, group).
+		Global("-nostats", "-progress", "pipe:1").
+		Build()
+	if err != nil {
+		return err
+	}
+	if task.Format.IsStreaming() {
+		for _, rendition := range group {
+			if err := os.MkdirAll(filepath.Dir(rendition.OutputFile), 0755); err != nil {
+				return fmt.Errorf("failed to create rendition directory: %v", err)
+			}
+		}
+	}
+	for _, i := range positions {
+		s.setRenditionStatus(task, i, domain.RenditionRunning, "")
+	}
+	s.taskMutex.Lock()
+	task.encodeIndex = 0
+	s.taskMutex.Unlock()
+
+	cmd := exec.Command("ffmpeg", args...)
+	onStart, onProgress := s.progressReporter(task)
+	output, err := runCommand(ctx, cmd, onStart, onProgress)
+	s.recordUsage(task, cmd)
+	if ctx.Err() != nil {
+		for _, i := range positions {
+			s.setRenditionStatus(task, i, domain.RenditionQueued, "")
+		}
+		return ctx.Err()
+	}
+	if err != nil {
+		s.appendLog(task.ID, "Shared encode of %d renditions failed: %v\nOutput: %s", len(group), err, string(output))
+		for _, i := range positions {
+			s.setRenditionStatus(task, i, domain.RenditionQueued, "")
+		}
+		return fmt.Errorf("shared encode failed: %v", err)
+	}
+	for n, i := range positions {
+		s.setRenditionStatus(task, i, domain.RenditionCompleted, "")
+		s.appendLog(task.ID, "Encoded %s rendition to %s", group[n].Resolution, group[n].OutputFile)
+	}
+	return nil
+}
+
+// estimateDecodeCPU scales the CPU time of decoding the start of a task's input to the whole input
+func (s *transcodingServiceImpl) estimateDecodeCPU(ctx context.Context, task *TranscodingTask, duration time.Duration) (time.Duration, error) {
+	if duration <= 0 {
+		return 0, fmt.Errorf("the source duration is unknown")
+	}
+	args, err := domain.NewDecodeSampleCommand(s.paths, task.InputFile).Global("-nostats").Build()
+	if err != nil {
+		return 0, err
+	}
+	cmd := exec.Command("ffmpeg", args...)
+	if output, err := runCommand(ctx, cmd, nil, nil); err != nil {
+		return 0, fmt.Errorf("decode sample failed: %v: %s", err, string(output))
+	}
+	sampled := domain.DecodeSampleLength
+	if duration < sampled {
+		sampled = duration
+	}
+	return time.Duration(float64(processCPUTime(cmd)) * float64(duration) / float64(sampled)), nil
+}
+
+// passCount is the number of encodes the listed renditions take when each runs on its own
+func passCount(renditions []domain.Rendition, positions []int) int {
+	count := 0
+	for _, i := range positions {
+		count++
+		if renditions[i].TwoPass != nil {
+			count++
+		}
+	}
+	return count
+}
+
+// recordUsage adds a finished encode's invocation and CPU time to the task's totals
+func (s *transcodingServiceImpl) recordUsage(task *TranscodingTask, cmd *exec.Cmd) {
+	s.taskMutex.Lock()
+	defer s.taskMutex.Unlock()
+	task.encodeRuns++
+	task.encodeCPU += processCPUTime(cmd)
+}
+
+// processCPUTime is the user and system CPU time an exited command used
+func processCPUTime(cmd *exec.Cmd) time.Duration {
+	if cmd.ProcessState == nil {
+		return 0
+	}
+	return cmd.ProcessState.UserTime() + cmd.ProcessState.SystemTime()
+}
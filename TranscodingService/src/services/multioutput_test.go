@@ -0,0 +1,116 @@
+package services
+
+import (
+	"TranscodingService/src/domain"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newMultiOutputTask(t *testing.T) *TranscodingTask {
+	dir := t.TempDir()
+	return &TranscodingTask{
+		ID:        "job-1",
+		Format:    domain.MP4,
+		InputFile: filepath.Join(dir, "movie.mkv"),
+		Renditions: []domain.Rendition{
+			{Resolution: domain.FHD, Bitrate: "5000k", VideoCodec: domain.H264, AudioCodec: domain.AAC, OutputFile: filepath.Join(dir, "movie_1080p.mp4")},
+			{Resolution: domain.HD, Bitrate: "2500k", VideoCodec: domain.H264, AudioCodec: domain.AAC, OutputFile: filepath.Join(dir, "movie_720p.mp4")},
+		},
+	}
+}
+
+func ffmpegRuns(t *testing.T, calls string) []string {
+	logged, err := os.ReadFile(calls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSuffix(string(logged), "\n"), "\n")
+}
+
+func TestEncodeRenditionsSharesDecode(t *testing.T) {
+	calls := fakeFFmpeg(t, "no failure")
+	s := newTestService(newFakeRepo(), 1)
+	task := newMultiOutputTask(t)
+
+	stats, err := s.encodeRenditions(context.Background(), task, task.Renditions, []int{0, 1}, time.Minute)
+	if err != nil {
+		t.Fatalf("encodeRenditions() = %v", err)
+	}
+	if stats.Invocations != 1 || stats.SharedWith != 2 {
+		t.Errorf("stats = %+v, want one invocation shared by 2 renditions", stats)
+	}
+
+	runs := ffmpegRuns(t, calls)
+	if len(runs) != 2 {
+		t.Fatalf("ran ffmpeg %d times, want the shared encode and a decode sample:\n%s", len(runs), strings.Join(runs, "\n"))
+	}
+	if !strings.Contains(runs[0], "split=2") {
+		t.Errorf("first run is not the shared encode: %s", runs[0])
+	}
+	if !strings.HasSuffix(runs[1], "-f null -") {
+		t.Errorf("second run is not the decode sample: %s", runs[1])
+	}
+	for i, rendition := range task.Renditions {
+		if rendition.Status != domain.RenditionCompleted {
+			t.Errorf("rendition %d is %s, want %s", i, rendition.Status, domain.RenditionCompleted)
+		}
+	}
+}
+
+func TestEncodeRenditionsFallsBackToSeparateRuns(t *testing.T) {
+	calls := fakeFFmpeg(t, "split=")
+	repo := newFakeRepo()
+	s := newTestService(repo, 1)
+	task := newMultiOutputTask(t)
+
+	stats, err := s.encodeRenditions(context.Background(), task, task.Renditions, []int{0, 1}, time.Minute)
+	if err != nil {
+		t.Fatalf("encodeRenditions() = %v", err)
+	}
+	if stats.SharedWith != 0 || stats.CPUSecondsSaved != 0 {
+		t.Errorf("stats = %+v, want no shared decode reported", stats)
+	}
+	if stats.Invocations != 3 {
+		t.Errorf("stats.Invocations = %d, want the failed shared encode and 2 separate runs", stats.Invocations)
+	}
+
+	runs := ffmpegRuns(t, calls)
+	if len(runs) != 3 {
+		t.Fatalf("ran ffmpeg %d times, want 3:\n%s", len(runs), strings.Join(runs, "\n"))
+	}
+	for i, rendition := range task.Renditions {
+		if !strings.Contains(runs[i+1], "file:"+rendition.OutputFile) || strings.Contains(runs[i+1], "split=") {
+			t.Errorf("run %d does not encode %s on its own: %s", i+2, rendition.Resolution, runs[i+1])
+		}
+		if rendition.Status != domain.RenditionCompleted {
+			t.Errorf("rendition %d is %s, want %s", i, rendition.Status, domain.RenditionCompleted)
+		}
+	}
+	if logs := strings.Join(repo.logs["job-1"], "\n"); !strings.Contains(logs, "Falling back to encoding each rendition on its own") {
+		t.Errorf("fallback was not logged:\n%s", logs)
+	}
+}
+
+func TestEncodeRenditionsSingleRenditionRunsAlone(t *testing.T) {
+	calls := fakeFFmpeg(t, "no failure")
+	s := newTestService(newFakeRepo(), 1)
+	task := newMultiOutputTask(t)
+
+	stats, err := s.encodeRenditions(context.Background(), task, task.Renditions, []int{1}, time.Minute)
+	if err != nil {
+		t.Fatalf("encodeRenditions() = %v", err)
+	}
+	if stats.Invocations != 1 || stats.SharedWith != 0 {
+		t.Errorf("stats = %+v, want one unshared invocation", stats)
+	}
+	if runs := ffmpegRuns(t, calls); len(runs) != 1 || strings.Contains(runs[0], "split=") {
+		t.Errorf("runs = %q, want one separate encode", runs)
+	}
+	if task.Renditions[0].Status != "" {
+		t.Errorf("rendition not pending was touched: %+v", task.Renditions[0])
+	}
+}
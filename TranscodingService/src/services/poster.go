@@ -0,0 +1,94 @@
+package services
+
+import (
+	"TranscodingService/src/domain"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// runPosters renders the best scoring frames of the input at every configured width
+func (s *transcodingServiceImpl) runPosters(ctx context.Context, task *TranscodingTask) error {
+	if task.Poster == nil {
+		return errors.New("poster job has no recorded options")
+	}
+	options := *task.Poster
+	media, err := probeMedia(ctx, task.InputFile)
+	if err != nil {
+		return fmt.Errorf("poster frames need the source duration: %v", err)
+	}
+	var width, height int
+	if video := media.VideoStream(); video != nil {
+		width, height = video.Width, video.Height
+	}
+
+	s.taskMutex.Lock()
+	task.Duration = media.Duration()
+	task.encodeIndex, task.encodeCount = 0, 1
+	s.taskMutex.Unlock()
+
+	args, err := domain.NewPosterAnalysisCommand(s.paths, task.InputFile, options.IntervalSeconds).
+		Global("-nostats", "-progress", "pipe:1").
+		Build()
+	if err != nil {
+		return err
+	}
+	onStart, onProgress := s.progressReporter(task)
+	output, err := runCommand(ctx, exec.Command("ffmpeg", args...), onStart, onProgress)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		s.appendLog(task.ID, "Poster frame analysis error: %v\nOutput: %s", err, string(output))
+		return fmt.Errorf("poster frame analysis failed: %v", err)
+	}
+	frames, err := domain.ParsePosterAnalysis(bytes.NewReader(output))
+	if err != nil {
+		return err
+	}
+
+	// Spread the candidates over the film so they come from different scenes
+	minGap := media.Duration().Seconds() / float64(options.Candidates*2)
+	picked := domain.SelectPosterFrames(frames, options.Candidates, minGap)
+	if len(picked) == 0 {
+		return fmt.Errorf("none of the %d sampled frames is usable as a poster", len(frames))
+	}
+	s.appendLog(task.ID, "Picked %d poster candidates from %d sampled frames", len(picked), len(frames))
+
+	removeArtifacts(task.Type, task.OutputFile)
+	if err := os.MkdirAll(task.OutputFile, 0755); err != nil {
+		return fmt.Errorf("failed to create poster directory: %v", err)
+	}
+	candidates := make([]domain.PosterCandidate, 0, len(picked))
+	for i, frame := range picked {
+		candidate := domain.PosterCandidate{
+			Rank:       i + 1,
+			FrameScore: frame,
+			Images:     domain.PosterImages(task.OutputFile, i+1, options.Widths, width),
+		}
+		args, err := domain.NewPosterExtractCommand(s.paths, task.InputFile, frame.TimeSeconds, candidate.Images).Build()
+		if err != nil {
+			return err
+		}
+		output, err := runCommand(ctx, exec.Command("ffmpeg", args...), onStart, nil)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			s.appendLog(task.ID, "Poster extraction error at %.3fs: %v\nOutput: %s", frame.TimeSeconds, err, string(output))
+			return fmt.Errorf("poster extraction failed: %v", err)
+		}
+		candidates = append(candidates, candidate)
+	}
+
+	s.saveMetadata(task.ID, domain.OutputMetadata{
+		SourceWidth:  width,
+		SourceHeight: height,
+		Posters:      candidates,
+	})
+	s.appendLog(task.ID, "Wrote %d poster candidates to %s", len(candidates), task.OutputFile)
+	return nil
+}
@@ -0,0 +1,69 @@
+package services
+
+import (
+	"TranscodingService/src/domain"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// probeTimeout bounds how long inspecting a single input may take
+const probeTimeout = 30 * time.Second
+
+// probeMedia describes the container and streams of inputFile, reporting unreadable files as ErrInvalidMedia
+func probeMedia(ctx context.Context, inputFile string) (*domain.MediaInfo, error) {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "ffprobe", "-v", "error", "-show_format", "-show_streams",
+		"-of", "json", "file:"+inputFile)
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && ctx.Err() == nil {
+			return nil, fmt.Errorf("%w: ffprobe could not read %s: %s", domain.ErrInvalidMedia, inputFile, strings.TrimSpace(stderr.String()))
+		}
+		return nil, fmt.Errorf("ffprobe failed: %v", err)
+	}
+	return domain.ParseProbeOutput(output)
+}
+
+// probeKeyframes lists the keyframe times of the first video stream of inputFile
+func probeKeyframes(ctx context.Context, inputFile string) ([]time.Duration, error) {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "ffprobe", "-v", "error", "-select_streams", "v:0",
+		"-show_entries", "packet=pts_time,flags", "-of", "csv=p=0", "file:"+inputFile)
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("ffprobe could not list keyframes: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return domain.ParseKeyframes(output)
+}
+
+// Probe inspects an input file allowed by the path policy
+func (s *transcodingServiceImpl) Probe(inputFile string) (*domain.MediaInfo, error) {
+	resolved, err := s.paths.ResolveInput(inputFile)
+	if err != nil {
+		return nil, err
+	}
+	return probeMedia(context.Background(), resolved)
+}
+
+// inspectInput rejects inputs that are corrupt or carry nothing to transcode before they are queued
+func (s *transcodingServiceImpl) inspectInput(inputFile string) (*domain.MediaInfo, error) {
+	media, err := probeMedia(context.Background(), inputFile)
+	if err != nil {
+		return nil, err
+	}
+	if err := media.Validate(); err != nil {
+		return nil, err
+	}
+	return media, nil
+}
@@ -0,0 +1,29 @@
+//go:build !windows
+
+package services
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup starts cmd in its own process group so its children can be signalled together
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// killProcessGroup kills cmd along with every process it spawned
+func killProcessGroup(cmd *exec.Cmd) error {
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
+
+// suspendProcessGroup stops every process in the group with SIGSTOP
+func suspendProcessGroup(process *os.Process) error {
+	return syscall.Kill(-process.Pid, syscall.SIGSTOP)
+}
+
+// resumeProcessGroup continues a group previously stopped with SIGSTOP
+func resumeProcessGroup(process *os.Process) error {
+	return syscall.Kill(-process.Pid, syscall.SIGCONT)
+}
@@ -0,0 +1,126 @@
+//go:build !windows
+
+package services
+
+import (
+	"TranscodingService/src/domain"
+	"TranscodingService/src/repositories"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunCommandKillsProcessGroup(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	// The background sleep keeps the output pipe open, so the run only ends early if it is killed too
+	start := time.Now()
+	_, err := runCommand(ctx, exec.Command("sh", "-c", "sleep 30 & wait"), nil, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("runCommand() = %v, want %v", err, context.Canceled)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("runCommand() returned after %v", elapsed)
+	}
+}
+
+func TestPauseResumeRunningJob(t *testing.T) {
+	cmd := exec.Command("sleep", "30")
+	setProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		killProcessGroup(cmd)
+		cmd.Wait()
+	}()
+
+	repo := newFakeRepo(repositories.TranscodingJob{JobID: "job-1", Status: domain.Running})
+	s := newTestService(repo, 1)
+	s.activeTasks["job-1"] = &TranscodingTask{ID: "job-1", Status: domain.Running, process: cmd.Process}
+
+	if err := s.PauseJob("job-1"); err != nil {
+		t.Fatalf("PauseJob() = %v", err)
+	}
+	if got := repo.jobs["job-1"].Status; got != domain.Paused {
+		t.Errorf("recorded status = %s, want paused", got)
+	}
+	waitForProcessState(t, cmd.Process.Pid, true)
+	if err := s.PauseJob("job-1"); err == nil {
+		t.Error("PauseJob() of a paused job succeeded")
+	}
+
+	if err := s.ResumeJob("job-1"); err != nil {
+		t.Fatalf("ResumeJob() = %v", err)
+	}
+	if got := repo.jobs["job-1"].Status; got != domain.Running {
+		t.Errorf("recorded status = %s, want in_progress", got)
+	}
+	waitForProcessState(t, cmd.Process.Pid, false)
+}
+
+// waitForProcessState waits for a process to be stopped or running, where /proc reports its state
+func waitForProcessState(t *testing.T, pid int, stopped bool) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); ; {
+		stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+		if err != nil {
+			return
+		}
+		// The state follows the parenthesised command name
+		fields := strings.Fields(string(stat[strings.LastIndexByte(string(stat), ')')+1:]))
+		if (fields[0] == "T") == stopped {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("process %d is in state %s, want stopped %v", pid, fields[0], stopped)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestPauseRunningJobBetweenEncodes(t *testing.T) {
+	repo := newFakeRepo(repositories.TranscodingJob{JobID: "job-1", Status: domain.Running})
+	s := newTestService(repo, 1)
+	task := &TranscodingTask{ID: "job-1", Status: domain.Running}
+	s.activeTasks["job-1"] = task
+
+	if err := s.PauseJob("job-1"); err != nil {
+		t.Fatalf("PauseJob() between encodes = %v", err)
+	}
+	if got := repo.jobs["job-1"].Status; got != domain.Running {
+		t.Fatalf("recorded status = %s before the next encode, want in_progress", got)
+	}
+
+	cmd := exec.Command("sleep", "30")
+	setProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		killProcessGroup(cmd)
+		cmd.Wait()
+	}()
+	onStart, _ := s.progressReporter(task)
+	onStart(cmd.Process)
+
+	if task.Status != domain.Paused || repo.jobs["job-1"].Status != domain.Paused {
+		t.Fatalf("status = %s, recorded %s, want the next encode paused as it starts", task.Status, repo.jobs["job-1"].Status)
+	}
+	waitForProcessState(t, cmd.Process.Pid, true)
+	if err := s.ResumeJob("job-1"); err != nil {
+		t.Fatalf("ResumeJob() = %v", err)
+	}
+	waitForProcessState(t, cmd.Process.Pid, false)
+
+	onStart(nil)
+	if task.process != nil {
+		t.Error("exited encoder is still recorded as the task's process")
+	}
+}
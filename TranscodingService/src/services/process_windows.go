@@ -0,0 +1,26 @@
+//go:build windows
+
+package services
+
+import (
+	"os"
+	"os/exec"
+)
+
+// setProcessGroup is a no-op on Windows
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// killProcessGroup kills the ffmpeg process itself on Windows
+func killProcessGroup(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
+
+// suspendProcessGroup is not available on Windows
+func suspendProcessGroup(process *os.Process) error {
+	return ErrNotSupported
+}
+
+// resumeProcessGroup is not available on Windows
+func resumeProcessGroup(process *os.Process) error {
+	return ErrNotSupported
+}
@@ -0,0 +1,117 @@
+package services
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ffmpegProgress is one block of the key=value report ffmpeg writes with -progress
+type ffmpegProgress struct {
+	OutTime time.Duration
+	Frame   int64
+	FPS     float64
+	Speed   float64
+	Done    bool
+}
+
+// parseProgress reads ffmpeg -progress output and calls onUpdate at the end of every block
+func parseProgress(r io.Reader, onUpdate func(ffmpegProgress)) error {
+	var current ffmpegProgress
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !ok || value == "N/A" {
+			continue
+		}
+
+		switch key {
+		case "out_time_us", "out_time_ms":
+			// ffmpeg reports microseconds under both keys
+			if us, err := strconv.ParseInt(value, 10, 64); err == nil {
+				current.OutTime = time.Duration(us) * time.Microsecond
+			}
+		case "out_time":
+			if d, err := parseTimestamp(value); err == nil && current.OutTime == 0 {
+				current.OutTime = d
+			}
+		case "frame":
+			current.Frame, _ = strconv.ParseInt(value, 10, 64)
+		case "fps":
+			current.FPS, _ = strconv.ParseFloat(value, 64)
+		case "speed":
+			current.Speed, _ = strconv.ParseFloat(strings.TrimSuffix(value, "x"), 64)
+		case "progress":
+			current.Done = value == "end"
+			onUpdate(current)
+			current = ffmpegProgress{}
+		}
+	}
+	return scanner.Err()
+}
+
+// parseTimestamp converts an ffmpeg HH:MM:SS.micro timestamp into a duration
+func parseTimestamp(value string) (time.Duration, error) {
+	parts := strings.Split(value, ":")
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("invalid timestamp: %s", value)
+	}
+	hours, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, err
+	}
+	minutes, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, err
+	}
+	seconds, err := strconv.ParseFloat(parts[2], 64)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute + time.Duration(seconds*float64(time.Second)), nil
+}
+
+// applyProgress scales an ffmpeg report into the task's overall progress; the caller must hold the task mutex
+func applyProgress(task *TranscodingTask, p ffmpegProgress) {
+	task.FPS = p.FPS
+	task.Speed = p.Speed
+	task.Frame = p.Frame
+
+	count := task.encodeCount
+	if count < 1 {
+		count = 1
+	}
+	remainingEncodes := count - task.encodeIndex - 1
+	if remainingEncodes < 0 {
+		remainingEncodes = 0
+	}
+
+	if p.Done {
+		task.Progress = float64(task.encodeIndex+1) / float64(count) * 100
+		if remainingEncodes == 0 {
+			task.ETA = 0
+		}
+		return
+	}
+	if task.Duration <= 0 {
+		return
+	}
+
+	fraction := float64(p.OutTime) / float64(task.Duration)
+	if fraction > 1 {
+		fraction = 1
+	}
+	task.Progress = (float64(task.encodeIndex) + fraction) / float64(count) * 100
+
+	if p.Speed > 0 {
+		remaining := task.Duration - p.OutTime
+		if remaining < 0 {
+			remaining = 0
+		}
+		remaining += time.Duration(remainingEncodes) * task.Duration
+		task.ETA = time.Duration(float64(remaining) / p.Speed)
+	}
+}
@@ -0,0 +1,61 @@
+package services
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseProgress(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   []ffmpegProgress
+	}{
+		{
+			name: "one block per report",
+			output: "frame=120\nfps=59.94\nout_time_us=4000000\nspeed=1.5x\nprogress=continue\n" +
+				"frame=240\nfps=60\nout_time_us=8000000\nspeed=2x\nprogress=end\n",
+			want: []ffmpegProgress{
+				{OutTime: 4 * time.Second, Frame: 120, FPS: 59.94, Speed: 1.5},
+				{OutTime: 8 * time.Second, Frame: 240, FPS: 60, Speed: 2, Done: true},
+			},
+		},
+		{
+			name:   "out_time_ms is in microseconds",
+			output: "out_time_ms=1500000\nprogress=continue\n",
+			want:   []ffmpegProgress{{OutTime: 1500 * time.Millisecond}},
+		},
+		{
+			name:   "timestamp when no microseconds are reported",
+			output: "out_time=01:02:03.500000\nprogress=continue\n",
+			want:   []ffmpegProgress{{OutTime: time.Hour + 2*time.Minute + 3500*time.Millisecond}},
+		},
+		{
+			name:   "unavailable and malformed values are skipped",
+			output: "speed=N/A\nout_time_us=N/A\nnot a key value line\n  frame=7  \nprogress=continue\n",
+			want:   []ffmpegProgress{{Frame: 7}},
+		},
+		{
+			name:   "trailing values without a progress line are dropped",
+			output: "frame=1\nprogress=continue\nframe=2\n",
+			want:   []ffmpegProgress{{Frame: 1}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []ffmpegProgress
+			err := parseProgress(strings.NewReader(tt.output), func(p ffmpegProgress) {
+				got = append(got, p)
+			})
+			if err != nil {
+				t.Fatalf("parseProgress() = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseProgress() reported %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
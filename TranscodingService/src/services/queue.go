@@ -0,0 +1,223 @@
+package services
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// jobQueue carries queued tasks, and chunks of running ones, to the worker pool
+type jobQueue interface {
+	// Push offers a queued task to the workers
+	Push(task *TranscodingTask) error
+	// Pop blocks until a chunk or a task is available and removes it, returning false once the queue is closed
+	Pop() (*TranscodingTask, *chunkWork, bool)
+	// Ack settles the delivery of a popped task once the worker is done with it
+	Ack(taskID string)
+	PushChunk(chunk *chunkWork)
+	TakeChunk(taskID string) *chunkWork
+	PopChunk() *chunkWork
+	// Remove and UpdatePriority act on a task still waiting in the queue, reporting false when they cannot
+	Remove(taskID string) bool
+	UpdatePriority(taskID string, priority int) bool
+	Len() int
+	Close()
+}
+
+// queueItem wraps a waiting task with the bookkeeping the heap needs
+type queueItem struct {
+	task       *TranscodingTask
+	enqueuedAt time.Time
+	seq        uint64
+	index      int
+}
+
+// chunkWork is one chunk of a running task's encode, run by whichever worker takes it
+type chunkWork struct {
+	taskID string
+	run    func()
+}
+
+// priorityQueue hands out chunks first, then waiting tasks by priority plus one level per agingInterval waited
+type priorityQueue struct {
+	mu            sync.Mutex
+	notEmpty      *sync.Cond
+	items         []*queueItem
+	chunks        []*chunkWork
+	byID          map[string]*queueItem
+	capacity      int
+	agingInterval time.Duration
+	nextSeq       uint64
+	closed        bool
+}
+
+// newPriorityQueue creates a queue holding at most capacity tasks
+func newPriorityQueue(capacity int, agingInterval time.Duration) *priorityQueue {
+	q := &priorityQueue{
+		byID:          make(map[string]*queueItem),
+		capacity:      capacity,
+		agingInterval: agingInterval,
+	}
+	q.notEmpty = sync.NewCond(&q.mu)
+	return q
+}
+
+// Push adds a task to the queue, failing with ErrQueueFull when it is at capacity
+func (q *priorityQueue) Push(task *TranscodingTask) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.items) >= q.capacity {
+		return ErrQueueFull
+	}
+	item := &queueItem{task: task, enqueuedAt: time.Now(), seq: q.nextSeq}
+	q.nextSeq++
+	heap.Push((*taskHeap)(q), item)
+	q.byID[task.ID] = item
+	q.notEmpty.Signal()
+	return nil
+}
+
+// Pop blocks until a chunk or a task is available and removes it, returning false once the queue is closed
+func (q *priorityQueue) Pop() (*TranscodingTask, *chunkWork, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for len(q.items) == 0 && len(q.chunks) == 0 && !q.closed {
+		q.notEmpty.Wait()
+	}
+	if q.closed {
+		return nil, nil, false
+	}
+	if len(q.chunks) > 0 {
+		chunk := q.chunks[0]
+		q.chunks = q.chunks[1:]
+		return nil, chunk, true
+	}
+	item := heap.Pop((*taskHeap)(q)).(*queueItem)
+	delete(q.byID, item.task.ID)
+	return item.task, nil, true
+}
+
+// Ack does nothing, since a task popped from memory is gone from the queue
+func (q *priorityQueue) Ack(taskID string) {}
+
+// PushChunk offers a chunk of a running task to idle workers. Chunks are not bounded by the queue capacity.
+func (q *priorityQueue) PushChunk(chunk *chunkWork) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.chunks = append(q.chunks, chunk)
+	q.notEmpty.Signal()
+}
+
+// TakeChunk removes the next waiting chunk of a task, returning nil when none is left
+func (q *priorityQueue) TakeChunk(taskID string) *chunkWork {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i, chunk := range q.chunks {
+		if chunk.taskID == taskID {
+			q.chunks = append(q.chunks[:i], q.chunks[i+1:]...)
+			return chunk
+		}
+	}
+	return nil
+}
+
+// PopChunk removes the next waiting chunk of any task without blocking, returning nil when none is waiting
+func (q *priorityQueue) PopChunk() *chunkWork {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.chunks) == 0 {
+		return nil
+	}
+	chunk := q.chunks[0]
+	q.chunks = q.chunks[1:]
+	return chunk
+}
+
+// Remove drops a waiting task from the queue
+func (q *priorityQueue) Remove(taskID string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	item, ok := q.byID[taskID]
+	if !ok {
+		return false
+	}
+	heap.Remove((*taskHeap)(q), item.index)
+	delete(q.byID, taskID)
+	return true
+}
+
+// UpdatePriority changes the priority of a waiting task and moves it to its new position
+func (q *priorityQueue) UpdatePriority(taskID string, priority int) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	item, ok := q.byID[taskID]
+	if !ok {
+		return false
+	}
+	item.task.Priority = priority
+	heap.Fix((*taskHeap)(q), item.index)
+	return true
+}
+
+// Len returns the number of waiting tasks
+func (q *priorityQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
+
+// Close wakes every blocked Pop and stops the queue from handing out tasks
+func (q *priorityQueue) Close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.notEmpty.Broadcast()
+}
+
+// effectivePriority is the task priority plus the levels earned by waiting since the Unix epoch
+func (q *priorityQueue) effectivePriority(item *queueItem) float64 {
+	if q.agingInterval <= 0 {
+		return float64(item.task.Priority)
+	}
+	return float64(item.task.Priority) - float64(item.enqueuedAt.UnixNano())/float64(q.agingInterval)
+}
+
+// taskHeap adapts priorityQueue to container/heap; callers must hold q.mu
+type taskHeap priorityQueue
+
+func (h *taskHeap) Len() int { return len(h.items) }
+
+func (h *taskHeap) Less(i, j int) bool {
+	q := (*priorityQueue)(h)
+	a, b := h.items[i], h.items[j]
+	pa, pb := q.effectivePriority(a), q.effectivePriority(b)
+	if pa != pb {
+		return pa > pb
+	}
+	return a.seq < b.seq
+}
+
+func (h *taskHeap) Swap(i, j int) {
+	h.items[i], h.items[j] = h.items[j], h.items[i]
+	h.items[i].index = i
+	h.items[j].index = j
+}
+
+func (h *taskHeap) Push(x interface{}) {
+	item := x.(*queueItem)
+	item.index = len(h.items)
+	h.items = append(h.items, item)
+}
+
+func (h *taskHeap) Pop() interface{} {
+	old := h.items
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	h.items = old[:n-1]
+	return item
+}
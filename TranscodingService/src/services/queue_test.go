@@ -0,0 +1,126 @@
+package services
+
+import (
+	"container/heap"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPriorityQueueOrder(t *testing.T) {
+	type waiting struct {
+		id       string
+		priority int
+		waited   time.Duration
+	}
+	tests := []struct {
+		name          string
+		agingInterval time.Duration
+		tasks         []waiting
+		want          []string
+	}{
+		{
+			name:  "highest priority first",
+			tasks: []waiting{{id: "low", priority: 1}, {id: "high", priority: 10}, {id: "mid", priority: 5}},
+			want:  []string{"high", "mid", "low"},
+		},
+		{
+			name:  "equal priorities in arrival order",
+			tasks: []waiting{{id: "first"}, {id: "second"}, {id: "third"}},
+			want:  []string{"first", "second", "third"},
+		},
+		{
+			name:          "waiting earns priority",
+			agingInterval: time.Minute,
+			tasks:         []waiting{{id: "high", priority: 5}, {id: "old", priority: 0, waited: 10 * time.Minute}},
+			want:          []string{"old", "high"},
+		},
+		{
+			name:          "short waits do not overtake",
+			agingInterval: time.Minute,
+			tasks:         []waiting{{id: "high", priority: 5}, {id: "old", priority: 0, waited: 3 * time.Minute}},
+			want:          []string{"high", "old"},
+		},
+		{
+			name:  "no aging without an interval",
+			tasks: []waiting{{id: "high", priority: 5}, {id: "old", priority: 0, waited: time.Hour}},
+			want:  []string{"high", "old"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := newPriorityQueue(len(tt.tasks), tt.agingInterval)
+			now := time.Now()
+			for _, w := range tt.tasks {
+				if err := q.Push(&TranscodingTask{ID: w.id, Priority: w.priority}); err != nil {
+					t.Fatal(err)
+				}
+				q.byID[w.id].enqueuedAt = now.Add(-w.waited)
+			}
+			heap.Init((*taskHeap)(q))
+
+			if got := popIDs(q); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("pop order = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPriorityQueueUpdates(t *testing.T) {
+	q := newPriorityQueue(3, 0)
+	for i, id := range []string{"a", "b", "c"} {
+		if err := q.Push(&TranscodingTask{ID: id, Priority: i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := q.Push(&TranscodingTask{ID: "d"}); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Push() on a full queue = %v, want ErrQueueFull", err)
+	}
+
+	if !q.UpdatePriority("a", 10) {
+		t.Error("UpdatePriority(a) = false, want true")
+	}
+	if !q.Remove("b") {
+		t.Error("Remove(b) = false, want true")
+	}
+	if q.Remove("b") || q.UpdatePriority("b", 1) {
+		t.Error("a removed task is still in the queue")
+	}
+	if got, want := popIDs(q), []string{"a", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("pop order = %v, want %v", got, want)
+	}
+}
+
+func TestPriorityQueueChunksFirst(t *testing.T) {
+	q := newPriorityQueue(1, 0)
+	if err := q.Push(&TranscodingTask{ID: "waiting", Priority: 100}); err != nil {
+		t.Fatal(err)
+	}
+	q.PushChunk(&chunkWork{taskID: "running"})
+
+	task, chunk, ok := q.Pop()
+	if !ok || task != nil || chunk == nil || chunk.taskID != "running" {
+		t.Fatalf("Pop() = %v, %v, %v, want the chunk of the running task", task, chunk, ok)
+	}
+	task, _, ok = q.Pop()
+	if !ok || task == nil || task.ID != "waiting" {
+		t.Fatalf("Pop() = %v, %v, want the waiting task", task, ok)
+	}
+
+	q.Close()
+	if _, _, ok := q.Pop(); ok {
+		t.Error("Pop() on a closed queue = true, want false")
+	}
+}
+
+// popIDs drains q, returning the IDs of its tasks in the order they were handed out
+func popIDs(q *priorityQueue) []string {
+	var ids []string
+	for q.Len() > 0 {
+		task, _, _ := q.Pop()
+		ids = append(ids, task.ID)
+	}
+	return ids
+}
@@ -0,0 +1,475 @@
+package services
+
+import (
+	"TranscodingService/src/config"
+	"TranscodingService/src/domain"
+	"TranscodingService/src/repositories"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	// rabbitMaxPriority is the highest message priority the queue is declared with
+	rabbitMaxPriority = 10
+	// rabbitRetryDelay is how long to wait before reconnecting, or before a job that could not be looked up is delivered again
+	rabbitRetryDelay = 5 * time.Second
+	// rabbitPublishTimeout bounds how long publishing a job waits for the broker to confirm it
+	rabbitPublishTimeout = 10 * time.Second
+)
+
+// rabbitMessage is the body of a queued job's message. The job itself is read from the repository.
+type rabbitMessage struct {
+	JobID string `json:"job_id"`
+	// Interrupted marks a redelivered message held back in the retry queue, which the broker delivers as new
+	Interrupted bool `json:"interrupted,omitempty"`
+}
+
+// deliveryResolver turns a delivered job into a task ready to start, or nil when the message can be dropped
+type deliveryResolver func(jobID string, redelivered bool) (*TranscodingTask, error)
+
+// deferredError is returned by a deliveryResolver for a job that cannot run until delay has passed
+type deferredError struct {
+	delay time.Duration
+	err   error
+}
+
+func (e *deferredError) Error() string { return e.err.Error() }
+
+// rabbitQueue carries queued jobs through a durable RabbitMQ queue shared by every instance
+type rabbitQueue struct {
+	url      string
+	name     string
+	prefetch int
+	resolve  deliveryResolver
+	publish  func(queue string, message amqp.Publishing) error // waits for the broker to confirm the message
+
+	mu         sync.Mutex
+	conn       *amqp.Connection
+	publisher  *amqp.Channel
+	unacked    map[string]amqp.Delivery
+	chunks     []*chunkWork
+	chunkReady chan struct{}
+	deliveries chan amqp.Delivery
+	closed     chan struct{}
+	closeOnce  sync.Once
+}
+
+// newRabbitQueue creates a queue on the configured broker and keeps connecting to it in the background
+func newRabbitQueue(cfg config.RabbitMQConfig, resolve deliveryResolver) *rabbitQueue {
+	q := &rabbitQueue{
+		url:        cfg.URL,
+		name:       cfg.QueueName,
+		prefetch:   cfg.PrefetchCount,
+		resolve:    resolve,
+		unacked:    make(map[string]amqp.Delivery),
+		chunkReady: make(chan struct{}, 1),
+		deliveries: make(chan amqp.Delivery),
+		closed:     make(chan struct{}),
+	}
+	q.publish = q.publishConfirmed
+	go q.maintain()
+	return q
+}
+
+// retryQueue names the queue holding messages back until their expiration, when they are dead-lettered into the job queue
+func (q *rabbitQueue) retryQueue() string {
+	return q.name + ".retry"
+}
+
+// maintain keeps a connection to the broker until the queue is closed, reconnecting after it is lost
+func (q *rabbitQueue) maintain() {
+	for {
+		lost, err := q.connect()
+		if err != nil {
+			log.Printf("Failed to connect to RabbitMQ queue %s, retrying in %s: %v", q.name, rabbitRetryDelay, err)
+		} else {
+			log.Printf("Connected to RabbitMQ queue %s with a prefetch of %d", q.name, q.prefetch)
+			select {
+			case <-q.closed:
+				return
+			case err := <-lost:
+				// The broker requeues the unacknowledged messages, which can no longer be acknowledged here
+				q.mu.Lock()
+				q.conn, q.publisher = nil, nil
+				q.unacked = make(map[string]amqp.Delivery)
+				q.mu.Unlock()
+				if err == nil {
+					return
+				}
+				log.Printf("Lost connection to RabbitMQ queue %s, reconnecting in %s: %v", q.name, rabbitRetryDelay, err)
+			}
+		}
+		select {
+		case <-q.closed:
+			return
+		case <-time.After(rabbitRetryDelay):
+		}
+	}
+}
+
+// connect declares the queue and starts consuming it, returning a channel reporting when the connection closes
+func (q *rabbitQueue) connect() (chan *amqp.Error, error) {
+	conn, err := amqp.Dial(q.url)
+	if err != nil {
+		return nil, err
+	}
+	fail := func(err error) (chan *amqp.Error, error) {
+		conn.Close()
+		return nil, err
+	}
+
+	publisher, err := conn.Channel()
+	if err != nil {
+		return fail(err)
+	}
+	if _, err := publisher.QueueDeclare(q.name, true, false, false, false, amqp.Table{"x-max-priority": int32(rabbitMaxPriority)}); err != nil {
+		return fail(fmt.Errorf("failed to declare queue: %v", err))
+	}
+	retryArgs := amqp.Table{"x-dead-letter-exchange": "", "x-dead-letter-routing-key": q.name}
+	if _, err := publisher.QueueDeclare(q.retryQueue(), true, false, false, false, retryArgs); err != nil {
+		return fail(fmt.Errorf("failed to declare retry queue: %v", err))
+	}
+	if err := publisher.Confirm(false); err != nil {
+		return fail(fmt.Errorf("failed to enable publisher confirms: %v", err))
+	}
+
+	consumer, err := conn.Channel()
+	if err != nil {
+		return fail(err)
+	}
+	if err := consumer.Qos(q.prefetch, 0, false); err != nil {
+		return fail(fmt.Errorf("failed to set prefetch: %v", err))
+	}
+	deliveries, err := consumer.Consume(q.name, "", false, false, false, false, nil)
+	if err != nil {
+		return fail(fmt.Errorf("failed to consume queue: %v", err))
+	}
+
+	lost := conn.NotifyClose(make(chan *amqp.Error, 1))
+	q.mu.Lock()
+	q.conn, q.publisher = conn, publisher
+	q.mu.Unlock()
+	go q.forward(deliveries)
+	return lost, nil
+}
+
+// forward passes the deliveries of one connection on to the workers until it closes
+func (q *rabbitQueue) forward(deliveries <-chan amqp.Delivery) {
+	for delivery := range deliveries {
+		select {
+		case q.deliveries <- delivery:
+		case <-q.closed:
+			return
+		}
+	}
+}
+
+// Push publishes a task's job and waits for the broker to confirm it
+func (q *rabbitQueue) Push(task *TranscodingTask) error {
+	body, err := json.Marshal(rabbitMessage{JobID: task.ID})
+	if err != nil {
+		return err
+	}
+	priority := task.Priority
+	if priority < 0 {
+		priority = 0
+	} else if priority > rabbitMaxPriority {
+		priority = rabbitMaxPriority
+	}
+	return q.publish(q.name, amqp.Publishing{
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent,
+		Priority:     uint8(priority),
+		MessageId:    task.ID,
+		Body:         body,
+	})
+}
+
+// publishConfirmed publishes a message to a queue and waits for the broker to confirm it
+func (q *rabbitQueue) publishConfirmed(queue string, message amqp.Publishing) error {
+	q.mu.Lock()
+	publisher := q.publisher
+	q.mu.Unlock()
+	if publisher == nil {
+		return fmt.Errorf("not connected to RabbitMQ queue %s", q.name)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), rabbitPublishTimeout)
+	defer cancel()
+	confirmation, err := publisher.PublishWithDeferredConfirmWithContext(ctx, "", queue, false, false, message)
+	if err != nil {
+		return fmt.Errorf("failed to publish job %s: %v", message.MessageId, err)
+	}
+	acked, err := confirmation.WaitContext(ctx)
+	if err != nil {
+		return fmt.Errorf("broker did not confirm job %s: %v", message.MessageId, err)
+	}
+	if !acked {
+		return fmt.Errorf("broker rejected job %s", message.MessageId)
+	}
+	return nil
+}
+
+// Pop blocks until a chunk or a runnable delivered job is available, returning false once the queue is closed
+func (q *rabbitQueue) Pop() (*TranscodingTask, *chunkWork, bool) {
+	for {
+		if chunk := q.PopChunk(); chunk != nil {
+			return nil, chunk, true
+		}
+		select {
+		case <-q.closed:
+			return nil, nil, false
+		case <-q.chunkReady:
+		case delivery := <-q.deliveries:
+			if task := q.accept(delivery); task != nil {
+				return task, nil, true
+			}
+		}
+	}
+}
+
+// accept resolves a delivered message into a task, settling the messages that do not yield one
+func (q *rabbitQueue) accept(delivery amqp.Delivery) *TranscodingTask {
+	var message rabbitMessage
+	if err := json.Unmarshal(delivery.Body, &message); err != nil || message.JobID == "" {
+		log.Printf("Discarding unreadable message from RabbitMQ queue %s: %s", q.name, string(delivery.Body))
+		q.settle(delivery.Reject(false))
+		return nil
+	}
+
+	// A job published again after a priority change can be delivered while its first message is held here
+	q.mu.Lock()
+	if _, held := q.unacked[message.JobID]; held {
+		q.mu.Unlock()
+		log.Printf("Dropping duplicate message for job %s from RabbitMQ queue %s", message.JobID, q.name)
+		q.settle(delivery.Ack(false))
+		return nil
+	}
+	q.unacked[message.JobID] = delivery
+	q.mu.Unlock()
+
+	interrupted := delivery.Redelivered || message.Interrupted
+	task, err := q.resolve(message.JobID, interrupted)
+	if err != nil || task == nil {
+		q.mu.Lock()
+		delete(q.unacked, message.JobID)
+		q.mu.Unlock()
+	}
+	if err != nil {
+		delay := rabbitRetryDelay
+		var deferred *deferredError
+		if errors.As(err, &deferred) {
+			delay = deferred.delay
+		}
+		log.Printf("Holding job %s back for %s: %v", message.JobID, delay.Round(time.Second), err)
+		q.holdBack(delivery, rabbitMessage{JobID: message.JobID, Interrupted: interrupted}, delay)
+		return nil
+	}
+	if task == nil {
+		q.settle(delivery.Ack(false))
+		return nil
+	}
+	return task
+}
+
+// holdBack moves a delivered message to the retry queue, which dead-letters it back into the job queue once it expires.
+// The broker only expires messages at the head of a queue, so a message can wait longer behind one with a later expiration.
+func (q *rabbitQueue) holdBack(delivery amqp.Delivery, message rabbitMessage, delay time.Duration) {
+	body, err := json.Marshal(message)
+	if err == nil {
+		err = q.publish(q.retryQueue(), amqp.Publishing{
+			ContentType:  "application/json",
+			DeliveryMode: amqp.Persistent,
+			Priority:     delivery.Priority,
+			MessageId:    message.JobID,
+			Expiration:   strconv.FormatInt(delay.Milliseconds(), 10),
+			Body:         body,
+		})
+	}
+	if err != nil {
+		log.Printf("Returning job %s to RabbitMQ queue %s, it could not be held back: %v", message.JobID, q.name, err)
+		q.settle(delivery.Nack(false, true))
+		return
+	}
+	q.settle(delivery.Ack(false))
+}
+
+// Ack acknowledges the message a popped task was delivered in
+func (q *rabbitQueue) Ack(taskID string) {
+	q.mu.Lock()
+	delivery, ok := q.unacked[taskID]
+	delete(q.unacked, taskID)
+	q.mu.Unlock()
+	if ok {
+		q.settle(delivery.Ack(false))
+	}
+}
+
+// settle logs a failed acknowledgement. The broker redelivers the message once its connection closes.
+func (q *rabbitQueue) settle(err error) {
+	if err != nil {
+		log.Printf("Failed to settle message from RabbitMQ queue %s: %v", q.name, err)
+	}
+}
+
+// PushChunk offers a chunk of a running task to this process's idle workers
+func (q *rabbitQueue) PushChunk(chunk *chunkWork) {
+	q.mu.Lock()
+	q.chunks = append(q.chunks, chunk)
+	q.mu.Unlock()
+	q.signalChunk()
+}
+
+// TakeChunk removes the next waiting chunk of a task, returning nil when none is left
+func (q *rabbitQueue) TakeChunk(taskID string) *chunkWork {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i, chunk := range q.chunks {
+		if chunk.taskID == taskID {
+			q.chunks = append(q.chunks[:i], q.chunks[i+1:]...)
+			return chunk
+		}
+	}
+	return nil
+}
+
+// PopChunk removes the next waiting chunk of any task without blocking, returning nil when none is waiting
+func (q *rabbitQueue) PopChunk() *chunkWork {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.chunks) == 0 {
+		return nil
+	}
+	chunk := q.chunks[0]
+	q.chunks = q.chunks[1:]
+	if len(q.chunks) > 0 {
+		q.signalChunk()
+	}
+	return chunk
+}
+
+// signalChunk wakes a worker blocked in Pop, unless one is already being woken
+func (q *rabbitQueue) signalChunk() {
+	select {
+	case q.chunkReady <- struct{}{}:
+	default:
+	}
+}
+
+// Remove drops the message of a task delivered here that has not started
+func (q *rabbitQueue) Remove(taskID string) bool {
+	q.mu.Lock()
+	delivery, ok := q.unacked[taskID]
+	delete(q.unacked, taskID)
+	q.mu.Unlock()
+	if ok {
+		q.settle(delivery.Ack(false))
+	}
+	return ok
+}
+
+// UpdatePriority publishes a task's job again at a new priority, the later delivery being dropped
+func (q *rabbitQueue) UpdatePriority(taskID string, priority int) bool {
+	if err := q.Push(&TranscodingTask{ID: taskID, Priority: priority}); err != nil {
+		log.Printf("Failed to publish job %s at priority %d: %v", taskID, priority, err)
+		return false
+	}
+	return true
+}
+
+// Len returns the number of jobs waiting in the broker, or 0 when it cannot be reached
+func (q *rabbitQueue) Len() int {
+	q.mu.Lock()
+	conn := q.conn
+	q.mu.Unlock()
+	if conn == nil {
+		return 0
+	}
+	// A failed passive declare closes its channel, so it gets one of its own
+	channel, err := conn.Channel()
+	if err != nil {
+		return 0
+	}
+	defer channel.Close()
+	queue, err := channel.QueueDeclarePassive(q.name, true, false, false, false, amqp.Table{"x-max-priority": int32(rabbitMaxPriority)})
+	if err != nil {
+		return 0
+	}
+	return queue.Messages
+}
+
+// Close stops handing out work and closes the connection, which returns unacknowledged jobs to the broker
+func (q *rabbitQueue) Close() {
+	q.closeOnce.Do(func() {
+		close(q.closed)
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		if q.conn != nil {
+			q.conn.Close()
+		}
+	})
+}
+
+// deliveredTask turns a delivered job into a queued task, or nil when it no longer waits to run
+func (s *transcodingServiceImpl) deliveredTask(jobID string, redelivered bool) (*TranscodingTask, error) {
+	job, err := s.repo.GetJobStatus(jobID)
+	if errors.Is(err, repositories.ErrJobNotFound) {
+		log.Printf("Dropping message for unknown job %s", jobID)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case job.Status == domain.Queued:
+	case job.Status == domain.Retrying:
+		if wait := s.retryDelay - time.Since(job.EnqueuedAt); wait > 0 {
+			return nil, &deferredError{delay: wait, err: fmt.Errorf("retry waits another %s", wait.Round(time.Second))}
+		}
+	case job.Status == domain.Running && redelivered && !s.isActive(jobID):
+		if job.LeaseExpiresAt != nil && time.Now().Before(*job.LeaseExpiresAt) {
+			return nil, &deferredError{delay: time.Until(*job.LeaseExpiresAt), err: fmt.Errorf("job is still running on worker %s", job.WorkerID)}
+		}
+		if job.Attempts > s.maxRetries {
+			s.finishJob(jobID, domain.Failed, fmt.Sprintf("interrupted on another instance after %d attempts", job.Attempts))
+			s.appendLog(jobID, "Job was interrupted on another instance and has no retries left")
+			return nil, nil
+		}
+		if err := s.repo.UpdateJobStatus(jobID, domain.Retrying); err != nil {
+			return nil, err
+		}
+		s.appendLog(jobID, "Job was interrupted on another instance, retrying")
+		if s.retryDelay > 0 {
+			return nil, &deferredError{delay: s.retryDelay, err: fmt.Errorf("retry waits %s", s.retryDelay)}
+		}
+		job.Status = domain.Retrying
+	default:
+		return nil, nil
+	}
+
+	task := taskFromJob(job, job.Status, s.loadRenditions(job))
+	s.taskMutex.Lock()
+	s.queuedTasks[task.ID] = task
+	s.taskMutex.Unlock()
+	return task, nil
+}
+
+// stopIfCancelled stops a running task whose job was cancelled through another instance sharing the broker
+func (s *transcodingServiceImpl) stopIfCancelled(task *TranscodingTask) {
+	job, err := s.repo.GetJobStatus(task.ID)
+	if err != nil || job.Status != domain.Cancelled {
+		return
+	}
+	if err := s.CancelTask(task.ID); err != nil {
+		log.Printf("Failed to stop cancelled task %s: %v", task.ID, err)
+	}
+}
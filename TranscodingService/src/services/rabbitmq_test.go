@@ -0,0 +1,269 @@
+package services
+
+import (
+	"TranscodingService/src/domain"
+	"TranscodingService/src/repositories"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// fakeAcknowledger records how deliveries were settled, by delivery tag
+type fakeAcknowledger struct {
+	settled []string
+}
+
+func (a *fakeAcknowledger) Ack(tag uint64, multiple bool) error {
+	a.settled = append(a.settled, fmt.Sprintf("ack %d", tag))
+	return nil
+}
+
+func (a *fakeAcknowledger) Nack(tag uint64, multiple, requeue bool) error {
+	a.settled = append(a.settled, fmt.Sprintf("nack %d requeue=%t", tag, requeue))
+	return nil
+}
+
+func (a *fakeAcknowledger) Reject(tag uint64, requeue bool) error {
+	a.settled = append(a.settled, fmt.Sprintf("reject %d requeue=%t", tag, requeue))
+	return nil
+}
+
+// newTestRabbitQueue builds a queue that is never connected, fed through its deliveries channel
+func newTestRabbitQueue(resolve deliveryResolver) *rabbitQueue {
+	return &rabbitQueue{
+		name:       "transcoding_jobs",
+		resolve:    resolve,
+		unacked:    make(map[string]amqp.Delivery),
+		chunkReady: make(chan struct{}, 1),
+		deliveries: make(chan amqp.Delivery),
+		closed:     make(chan struct{}),
+	}
+}
+
+func delivery(ack *fakeAcknowledger, tag uint64, body string) amqp.Delivery {
+	return amqp.Delivery{Acknowledger: ack, DeliveryTag: tag, Body: []byte(body)}
+}
+
+func TestRabbitQueueAccept(t *testing.T) {
+	ack := &fakeAcknowledger{}
+	q := newTestRabbitQueue(func(jobID string, redelivered bool) (*TranscodingTask, error) {
+		if jobID == "done" {
+			return nil, nil
+		}
+		return &TranscodingTask{ID: jobID}, nil
+	})
+
+	if task := q.accept(delivery(ack, 1, "not json")); task != nil {
+		t.Errorf("accept() of an unreadable message = %+v, want nil", task)
+	}
+	if task := q.accept(delivery(ack, 2, `{"job_id":"done"}`)); task != nil {
+		t.Errorf("accept() of a job no longer waiting = %+v, want nil", task)
+	}
+	task := q.accept(delivery(ack, 3, `{"job_id":"job-1"}`))
+	if task == nil || task.ID != "job-1" {
+		t.Fatalf("accept() = %+v, want job-1", task)
+	}
+	if want := []string{"reject 1 requeue=false", "ack 2"}; !reflect.DeepEqual(ack.settled, want) {
+		t.Errorf("settled = %q before the task ran, want %q", ack.settled, want)
+	}
+
+	q.Ack("job-1")
+	q.Ack("job-1")
+	if want := []string{"reject 1 requeue=false", "ack 2", "ack 3"}; !reflect.DeepEqual(ack.settled, want) {
+		t.Errorf("settled = %q, want the task's delivery acknowledged once", ack.settled)
+	}
+}
+
+func TestRabbitQueueHoldsBackJobs(t *testing.T) {
+	ack := &fakeAcknowledger{}
+	var interrupted []bool
+	q := newTestRabbitQueue(func(jobID string, redelivered bool) (*TranscodingTask, error) {
+		interrupted = append(interrupted, redelivered)
+		if jobID == "leased" {
+			return nil, &deferredError{delay: 30 * time.Second, err: errors.New("job is still running on worker worker-2")}
+		}
+		return nil, errors.New("database unavailable")
+	})
+	var published []amqp.Publishing
+	var queues []string
+	q.publish = func(queue string, message amqp.Publishing) error {
+		queues = append(queues, queue)
+		published = append(published, message)
+		return nil
+	}
+
+	redelivered := delivery(ack, 1, `{"job_id":"leased"}`)
+	redelivered.Redelivered = true
+	if task := q.accept(redelivered); task != nil {
+		t.Fatalf("accept() of a job held back = %+v, want nil", task)
+	}
+	if task := q.accept(delivery(ack, 2, `{"job_id":"leased","interrupted":true}`)); task != nil {
+		t.Fatalf("accept() of a job held back = %+v, want nil", task)
+	}
+	if task := q.accept(delivery(ack, 3, `{"job_id":"lookup"}`)); task != nil {
+		t.Fatalf("accept() of a job that could not be looked up = %+v, want nil", task)
+	}
+
+	if want := []bool{true, true, false}; !reflect.DeepEqual(interrupted, want) {
+		t.Errorf("resolved as interrupted = %v, want %v", interrupted, want)
+	}
+	if want := []string{"ack 1", "ack 2", "ack 3"}; !reflect.DeepEqual(ack.settled, want) {
+		t.Errorf("settled = %q, want every delivery acknowledged once held back", ack.settled)
+	}
+	wantBodies := []string{`{"job_id":"leased","interrupted":true}`, `{"job_id":"leased","interrupted":true}`, `{"job_id":"lookup"}`}
+	wantExpirations := []string{"30000", "30000", "5000"}
+	if len(published) != len(wantBodies) {
+		t.Fatalf("published %d messages, want %d", len(published), len(wantBodies))
+	}
+	for i, message := range published {
+		if queues[i] != "transcoding_jobs.retry" || string(message.Body) != wantBodies[i] || message.Expiration != wantExpirations[i] {
+			t.Errorf("message %d = %s %s expiring in %sms, want transcoding_jobs.retry %s expiring in %sms",
+				i+1, queues[i], message.Body, message.Expiration, wantBodies[i], wantExpirations[i])
+		}
+	}
+
+	q.publish = func(string, amqp.Publishing) error { return errors.New("channel closed") }
+	ack.settled = nil
+	if task := q.accept(delivery(ack, 4, `{"job_id":"lookup"}`)); task != nil {
+		t.Fatalf("accept() = %+v, want nil", task)
+	}
+	if want := []string{"nack 4 requeue=true"}; !reflect.DeepEqual(ack.settled, want) {
+		t.Errorf("settled = %q, want the delivery returned when it cannot be held back", ack.settled)
+	}
+}
+
+func TestRabbitQueueDropsDuplicateDelivery(t *testing.T) {
+	ack := &fakeAcknowledger{}
+	resolved := 0
+	q := newTestRabbitQueue(func(jobID string, redelivered bool) (*TranscodingTask, error) {
+		resolved++
+		return &TranscodingTask{ID: jobID}, nil
+	})
+
+	if task := q.accept(delivery(ack, 1, `{"job_id":"job-1"}`)); task == nil {
+		t.Fatal("accept() = nil, want job-1")
+	}
+	if task := q.accept(delivery(ack, 2, `{"job_id":"job-1"}`)); task != nil {
+		t.Errorf("accept() of a second message for a held job = %+v, want nil", task)
+	}
+	if resolved != 1 {
+		t.Errorf("resolved job-1 %d times, want the duplicate dropped unresolved", resolved)
+	}
+	if want := []string{"ack 2"}; !reflect.DeepEqual(ack.settled, want) {
+		t.Fatalf("settled = %q, want the duplicate acknowledged", ack.settled)
+	}
+
+	q.Ack("job-1")
+	if want := []string{"ack 2", "ack 1"}; !reflect.DeepEqual(ack.settled, want) {
+		t.Errorf("settled = %q, want the held delivery acknowledged when its task ends", ack.settled)
+	}
+}
+
+func TestRabbitQueueRemove(t *testing.T) {
+	ack := &fakeAcknowledger{}
+	q := newTestRabbitQueue(func(jobID string, redelivered bool) (*TranscodingTask, error) {
+		return &TranscodingTask{ID: jobID}, nil
+	})
+	if task := q.accept(delivery(ack, 1, `{"job_id":"job-1"}`)); task == nil {
+		t.Fatal("accept() = nil, want job-1")
+	}
+
+	if !q.Remove("job-1") {
+		t.Fatal("Remove() of a delivered task that has not started = false, want true")
+	}
+	if q.Remove("job-1") || q.Remove("job-2") {
+		t.Error("Remove() of a task not held here = true, want false")
+	}
+	q.Ack("job-1")
+	if want := []string{"ack 1"}; !reflect.DeepEqual(ack.settled, want) {
+		t.Errorf("settled = %q, want the dropped delivery acknowledged once", ack.settled)
+	}
+}
+
+func TestRabbitQueuePop(t *testing.T) {
+	ack := &fakeAcknowledger{}
+	q := newTestRabbitQueue(func(jobID string, redelivered bool) (*TranscodingTask, error) {
+		return &TranscodingTask{ID: jobID}, nil
+	})
+	chunk := &chunkWork{taskID: "running"}
+	q.PushChunk(chunk)
+
+	if task, got, ok := q.Pop(); !ok || task != nil || got != chunk {
+		t.Fatalf("Pop() = %+v, %+v, %t, want the waiting chunk first", task, got, ok)
+	}
+	go func() { q.deliveries <- delivery(ack, 1, `{"job_id":"job-1"}`) }()
+	if task, _, ok := q.Pop(); !ok || task == nil || task.ID != "job-1" {
+		t.Fatalf("Pop() = %+v, %t, want the delivered job", task, ok)
+	}
+
+	done := make(chan bool)
+	go func() {
+		_, _, ok := q.Pop()
+		done <- ok
+	}()
+	q.Close()
+	select {
+	case ok := <-done:
+		if ok {
+			t.Error("Pop() after Close() = true, want false")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Pop() still blocked after Close()")
+	}
+}
+
+func TestDeliveredTask(t *testing.T) {
+	leased := time.Now().Add(time.Minute)
+	repo := newFakeRepo(
+		repositories.TranscodingJob{JobID: "queued", JobType: domain.TrickplayJob, Status: domain.Queued},
+		repositories.TranscodingJob{JobID: "completed", JobType: domain.TrickplayJob, Status: domain.Completed},
+		repositories.TranscodingJob{JobID: "interrupted", JobType: domain.TrickplayJob, Status: domain.Running, Attempts: 2},
+		repositories.TranscodingJob{JobID: "exhausted", JobType: domain.TrickplayJob, Status: domain.Running, Attempts: 3},
+		repositories.TranscodingJob{JobID: "retry", JobType: domain.TrickplayJob, Status: domain.Retrying, EnqueuedAt: time.Now().Add(-time.Hour), UpdatedAt: time.Now()},
+		repositories.TranscodingJob{JobID: "recent-retry", JobType: domain.TrickplayJob, Status: domain.Retrying, EnqueuedAt: time.Now()},
+		repositories.TranscodingJob{JobID: "running", JobType: domain.TrickplayJob, Status: domain.Running, Attempts: 1},
+		repositories.TranscodingJob{JobID: "leased", JobType: domain.TrickplayJob, Status: domain.Running, Attempts: 1, WorkerID: "worker-2", LeaseExpiresAt: &leased},
+	)
+	s := newTestService(repo, 1)
+	s.retryDelay = time.Minute
+
+	tests := []struct {
+		jobID       string
+		redelivered bool
+		wantTask    bool
+		wantErr     bool
+		wantStatus  domain.TranscodingStatus
+	}{
+		{jobID: "queued", wantTask: true, wantStatus: domain.Queued},
+		{jobID: "completed", wantStatus: domain.Completed},
+		{jobID: "missing"},
+		{jobID: "interrupted", redelivered: true, wantErr: true, wantStatus: domain.Retrying},
+		{jobID: "exhausted", redelivered: true, wantStatus: domain.Failed},
+		{jobID: "running", wantStatus: domain.Running},
+		{jobID: "leased", redelivered: true, wantErr: true, wantStatus: domain.Running},
+		{jobID: "retry", wantTask: true, wantStatus: domain.Retrying},
+		{jobID: "recent-retry", wantErr: true, wantStatus: domain.Retrying},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.jobID, func(t *testing.T) {
+			task, err := s.deliveredTask(tt.jobID, tt.redelivered)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("deliveredTask() = %v, want error %t", err, tt.wantErr)
+			}
+			if (task != nil) != tt.wantTask {
+				t.Fatalf("deliveredTask() = %+v, want a task %t", task, tt.wantTask)
+			}
+			if task != nil && s.queuedTasks[tt.jobID] != task {
+				t.Error("delivered task is not tracked as queued")
+			}
+			if status := repo.jobs[tt.jobID].Status; status != tt.wantStatus {
+				t.Errorf("status = %s, want %s", status, tt.wantStatus)
+			}
+		})
+	}
+}
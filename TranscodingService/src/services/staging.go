@@ -0,0 +1,220 @@
+package services
+
+import (
+	"TranscodingService/src/domain"
+	"TranscodingService/src/repositories"
+	"TranscodingService/src/storage"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// stagingDir is the workspace holding the staged input and outputs of a job addressed by URI
+func (s *transcodingServiceImpl) stagingDir(jobID string) string {
+	return filepath.Join(s.stagingRoot, jobID)
+}
+
+// stagedOutputDir is where a job addressed by URI writes the outputs uploaded once it succeeds
+func (s *transcodingServiceImpl) stagedOutputDir(jobID string) string {
+	return filepath.Join(s.stagingDir(jobID), "output")
+}
+
+// stageRequest points a request's storage URIs at staged copies, returning the URIs or nil for local paths
+func (s *transcodingServiceImpl) stageRequest(jobID string, request *domain.TranscodingRequest) (*domain.RemoteFiles, error) {
+	var remote domain.RemoteFiles
+	if storage.IsURI(request.InputFile) {
+		uri, err := s.checkRemoteInput(request.InputFile)
+		if err != nil {
+			return nil, err
+		}
+		remote.Input = uri.String()
+		request.InputFile = filepath.Join(s.stagingDir(jobID), "input", uri.Base())
+	}
+	for i, subtitle := range request.Subtitles {
+		if !storage.IsURI(subtitle.File) {
+			continue
+		}
+		uri, err := s.checkRemoteInput(subtitle.File)
+		if err != nil {
+			return nil, err
+		}
+		// Each sidecar gets a directory of its own, keeping the name its language may be guessed from
+		staged := filepath.Join(s.stagingDir(jobID), "subtitles", strconv.Itoa(i), uri.Base())
+		if remote.Subtitles == nil {
+			remote.Subtitles = make(map[string]string)
+		}
+		remote.Subtitles[staged] = uri.String()
+		request.Subtitles[i].File = staged
+	}
+	if storage.IsURI(request.OutputFile) {
+		uri, _, err := s.openURI(request.OutputFile, true)
+		if err != nil {
+			return nil, err
+		}
+		remote.Output = uri.String()
+		request.OutputFile = filepath.Join(s.stagedOutputDir(jobID), uri.Base())
+	}
+	if remote.Input == "" && remote.Output == "" && len(remote.Subtitles) == 0 {
+		return nil, nil
+	}
+	return &remote, nil
+}
+
+// checkRemoteInput opens an input URI and checks that its object exists
+func (s *transcodingServiceImpl) checkRemoteInput(raw string) (storage.URI, error) {
+	uri, store, err := s.openURI(raw, false)
+	if err != nil {
+		return storage.URI{}, err
+	}
+	if _, err := store.Stat(context.Background(), uri.Key); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return storage.URI{}, fmt.Errorf("%w: %v", domain.ErrInvalidMedia, err)
+		}
+		return storage.URI{}, err
+	}
+	return uri, nil
+}
+
+// openURI parses a storage URI and opens its backend, checking it against the roots or the configured bucket
+func (s *transcodingServiceImpl) openURI(raw string, output bool) (storage.URI, storage.Storage, error) {
+	uri, err := storage.ParseURI(raw)
+	if err != nil {
+		return storage.URI{}, nil, err
+	}
+	switch uri.Scheme {
+	case "file":
+		resolve := s.paths.ResolveInput
+		if output {
+			resolve = s.paths.ResolveOutput
+		}
+		if _, err := resolve(uri.Path()); err != nil {
+			return storage.URI{}, nil, err
+		}
+	case "s3":
+		if uri.Bucket != s.bucket {
+			return storage.URI{}, nil, fmt.Errorf("bucket %s: %w", uri.Bucket, domain.ErrPathNotAllowed)
+		}
+	}
+	store, err := s.stores.Open(uri)
+	if err != nil {
+		return storage.URI{}, nil, err
+	}
+	return uri, store, nil
+}
+
+// stageInput downloads a task's input and subtitle sidecars from storage into its workspace
+func (s *transcodingServiceImpl) stageInput(ctx context.Context, task *TranscodingTask) error {
+	if task.Remote == nil {
+		return nil
+	}
+	if task.Remote.Input != "" {
+		if err := s.download(ctx, task.ID, task.Remote.Input, task.InputFile); err != nil {
+			return err
+		}
+	}
+	for file, raw := range task.Remote.Subtitles {
+		if err := s.download(ctx, task.ID, raw, file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// download stages one object at file, reusing a complete copy left by an earlier attempt
+func (s *transcodingServiceImpl) download(ctx context.Context, jobID, raw, file string) error {
+	uri, store, err := s.openURI(raw, false)
+	if err != nil {
+		return err
+	}
+	object, err := store.Stat(ctx, uri.Key)
+	if err != nil {
+		return fmt.Errorf("failed to stage %s: %v", uri, err)
+	}
+	if staged, err := os.Stat(file); err == nil && staged.Size() == object.Size {
+		s.appendLog(jobID, "Reusing %s staged by an earlier attempt", uri)
+		return nil
+	}
+
+	started := time.Now()
+	if err := storage.Download(ctx, store, uri.Key, file); err != nil {
+		return fmt.Errorf("failed to stage %s: %v", uri, err)
+	}
+	s.appendLog(jobID, "Staged %s (%d bytes) in %s", uri, object.Size, time.Since(started).Round(time.Millisecond))
+	return nil
+}
+
+// uploadOutputs copies a successful run's staged outputs into storage next to the job's output URI
+func (s *transcodingServiceImpl) uploadOutputs(ctx context.Context, task *TranscodingTask) error {
+	if task.Remote == nil || task.Remote.Output == "" {
+		return nil
+	}
+	uri, store, err := s.openURI(task.Remote.Output, true)
+	if err != nil {
+		return err
+	}
+	prefix := uri.Sibling("")
+	started := time.Now()
+	uploaded, err := storage.UploadDir(ctx, store, s.stagedOutputDir(task.ID), prefix.Key)
+	if err != nil {
+		return fmt.Errorf("failed to upload outputs: %v", err)
+	}
+	s.appendLog(task.ID, "Uploaded %d files to %s in %s", uploaded, prefix, time.Since(started).Round(time.Millisecond))
+	return nil
+}
+
+// removeStaging deletes the staged copies of a job addressed by URI once its run has ended
+func (s *transcodingServiceImpl) removeStaging(task *TranscodingTask) {
+	if task.Remote == nil {
+		return
+	}
+	if err := os.RemoveAll(s.stagingDir(task.ID)); err != nil {
+		log.Printf("Failed to remove staged files of job %s: %v", task.ID, err)
+	}
+}
+
+// publicLocation maps a staged file of a job to its storage URI, returning local paths unchanged
+func (s *transcodingServiceImpl) publicLocation(job repositories.TranscodingJob, file string) string {
+	remote := jobOptions(job).Remote
+	if remote == nil {
+		return file
+	}
+	if remote.Input != "" && file == job.InputFile {
+		return remote.Input
+	}
+	if remote.Output != "" {
+		rel, err := filepath.Rel(s.stagedOutputDir(job.JobID), file)
+		uri, parseErr := storage.ParseURI(remote.Output)
+		if err == nil && parseErr == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return uri.Sibling(filepath.ToSlash(rel)).String()
+		}
+	}
+	return file
+}
+
+// resolveStagingRoot creates the staging directory and returns its absolute, symlink-free path
+func resolveStagingRoot(dir string) string {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Printf("Failed to create staging workspace %s: %v", dir, err)
+	}
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	if real, err := filepath.EvalSymlinks(dir); err == nil {
+		dir = real
+	}
+	return dir
+}
+
+// allowStaging adds the staging directory to restricted roots so jobs can use their staged copies
+func allowStaging(roots []string, stagingRoot string) []string {
+	if len(roots) == 0 {
+		return roots
+	}
+	return append(append([]string(nil), roots...), stagingRoot)
+}
@@ -0,0 +1,108 @@
+package services
+
+import (
+	"TranscodingService/src/domain"
+	"TranscodingService/src/repositories"
+	"TranscodingService/src/storage"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// logRepository records job logs and leaves every other repository method unimplemented
+type logRepository struct {
+	repositories.TranscodingRepository
+	logs []string
+}
+
+func (r *logRepository) AppendJobLog(jobID, line string) error {
+	r.logs = append(r.logs, line)
+	return nil
+}
+
+func newStagingService(t *testing.T) *transcodingServiceImpl {
+	t.Helper()
+	stores, err := storage.NewBackends(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &transcodingServiceImpl{repo: &logRepository{}, stores: stores, bucket: "video-uploads", stagingRoot: t.TempDir()}
+}
+
+func TestStageRequestWithURIInput(t *testing.T) {
+	s := newStagingService(t)
+	dir := t.TempDir()
+	input := filepath.Join(dir, "movie.mp4")
+	sidecar := filepath.Join(dir, "movie.fr.srt")
+	for _, file := range []string{input, sidecar} {
+		if err := os.WriteFile(file, []byte("data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	request := domain.TranscodingRequest{
+		InputFile:        "file://" + input,
+		OutputFile:       "file://" + filepath.Join(dir, "out", "hls"),
+		TargetFormat:     domain.HLS,
+		TargetResolution: "720p",
+		Subtitles:        []domain.SubtitleSource{{File: "file://" + sidecar}},
+	}
+	if err := request.Validate(s.paths); err != nil {
+		t.Fatalf("Validate() = %v", err)
+	}
+	remote, err := s.stageRequest("job-1", &request)
+	if err != nil {
+		t.Fatalf("stageRequest() = %v", err)
+	}
+
+	if want := "file://" + input; remote == nil || remote.Input != want {
+		t.Fatalf("remote input = %+v, want %s", remote, want)
+	}
+	if want := filepath.Join(s.stagingRoot, "job-1", "input", "movie.mp4"); request.InputFile != want {
+		t.Errorf("staged input = %s, want %s", request.InputFile, want)
+	}
+	if want := filepath.Join(s.stagingRoot, "job-1", "output", "hls"); request.OutputFile != want {
+		t.Errorf("staged output = %s, want %s", request.OutputFile, want)
+	}
+	staged := request.Subtitles[0].File
+	if remote.Subtitles[staged] != "file://"+sidecar {
+		t.Errorf("remote subtitles = %v, want %s staged at %s", remote.Subtitles, sidecar, staged)
+	}
+	if got := request.Subtitles[0].LanguageOrGuess(); got != "fr" {
+		t.Errorf("staged sidecar language = %s, want fr", got)
+	}
+
+	task := &TranscodingTask{ID: "job-1", InputFile: request.InputFile, Remote: remote}
+	if err := s.stageInput(context.Background(), task); err != nil {
+		t.Fatalf("staging input: %v", err)
+	}
+	for _, file := range []string{request.InputFile, staged} {
+		if data, err := os.ReadFile(file); err != nil || string(data) != "data" {
+			t.Errorf("staged %s = %q, %v", file, data, err)
+		}
+	}
+}
+
+func TestStageRequestRejects(t *testing.T) {
+	s := newStagingService(t)
+	tests := []struct {
+		name  string
+		input string
+		want  error
+	}{
+		{"missing object", "file:///nonexistent/movie.mp4", domain.ErrInvalidMedia},
+		{"other bucket", "s3://other-bucket/movie.mp4", domain.ErrPathNotAllowed},
+		{"unsupported scheme", "gs://video-uploads/movie.mp4", storage.ErrUnsupportedScheme},
+		{"s3 not configured", "s3://video-uploads/movie.mp4", storage.ErrUnsupportedScheme},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := domain.TranscodingRequest{InputFile: tt.input, OutputFile: "/out/movie"}
+			if _, err := s.stageRequest("job-1", &request); !errors.Is(err, tt.want) {
+				t.Fatalf("stageRequest() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
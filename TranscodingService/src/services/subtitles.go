@@ -0,0 +1,115 @@
+package services
+
+import (
+	"TranscodingService/src/domain"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// subtitleConversion is one subtitle stream to convert to WebVTT
+type subtitleConversion struct {
+	track     domain.SubtitleTrack
+	inputFile string
+	stream    int
+	charset   string
+	sidecar   bool
+}
+
+// convertSubtitles converts the embedded text subtitles and sidecar files of a job to WebVTT
+func (s *transcodingServiceImpl) convertSubtitles(ctx context.Context, task *TranscodingTask, media *domain.MediaInfo, duration time.Duration) ([]domain.SubtitleTrack, error) {
+	var conversions []subtitleConversion
+	if media != nil {
+		for _, stream := range media.StreamsOfType(domain.SubtitleStream) {
+			if !domain.IsTextSubtitle(stream.Codec) {
+				s.appendLog(task.ID, "Skipping %s subtitle stream %d, only text subtitles can be converted", stream.Codec, stream.Index)
+				continue
+			}
+			language := stream.Language
+			if language == "" {
+				language = "und"
+			}
+			conversions = append(conversions, subtitleConversion{
+				track: domain.SubtitleTrack{
+					Language: language,
+					Title:    stream.Title,
+					Codec:    stream.Codec,
+					Source:   fmt.Sprintf("stream %d", stream.Index),
+					Default:  stream.Default,
+				},
+				inputFile: task.InputFile,
+				stream:    stream.Index,
+			})
+		}
+	}
+	for _, sidecar := range task.Subtitles {
+		data, err := os.ReadFile(sidecar.File)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read subtitle file: %v", err)
+		}
+		conversions = append(conversions, subtitleConversion{
+			track: domain.SubtitleTrack{
+				Language: sidecar.LanguageOrGuess(),
+				Title:    sidecar.Title,
+				Codec:    strings.TrimPrefix(strings.ToLower(filepath.Ext(sidecar.File)), "."),
+				Source:   sidecar.File,
+			},
+			inputFile: sidecar.File,
+			charset:   domain.SubtitleCharset(data, s.subtitleCharset),
+			sidecar:   true,
+		})
+	}
+	if len(conversions) == 0 {
+		return nil, nil
+	}
+
+	dir := domain.ArtifactDir(task.Format, task.OutputFile, "subtitles")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create subtitle directory: %v", err)
+	}
+	onStart, _ := s.progressReporter(task)
+	var tracks []domain.SubtitleTrack
+	for _, conversion := range conversions {
+		track := conversion.track
+		track.File = domain.SubtitlePath(dir, len(tracks)+1, track.Language)
+		err := s.convertSubtitle(ctx, task, conversion, track.File, onStart)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err == nil && task.Format == domain.HLS {
+			track.Playlist, err = domain.WriteHLSSubtitle(track, duration)
+		}
+		if err != nil {
+			if conversion.sidecar {
+				return nil, err
+			}
+			removePartialOutput(track.File)
+			s.appendLog(task.ID, "Skipping subtitle %s: %v", track.Source, err)
+			continue
+		}
+		if conversion.charset != "" {
+			s.appendLog(task.ID, "Decoded subtitle %s as %s", track.Source, conversion.charset)
+		}
+		s.appendLog(task.ID, "Converted %s subtitle %s (%s) to %s", track.Codec, track.Source, track.Language, track.File)
+		tracks = append(tracks, track)
+	}
+	return tracks, nil
+}
+
+// convertSubtitle runs ffmpeg to write one subtitle stream as UTF-8 WebVTT
+func (s *transcodingServiceImpl) convertSubtitle(ctx context.Context, task *TranscodingTask, conversion subtitleConversion, outputFile string, onStart func(*os.Process)) error {
+	args, err := domain.NewSubtitleCommand(s.paths, conversion.inputFile, conversion.stream, conversion.charset, outputFile).Build()
+	if err != nil {
+		return err
+	}
+	output, err := runCommand(ctx, exec.Command("ffmpeg", args...), onStart, nil)
+	if err != nil && ctx.Err() == nil {
+		s.appendLog(task.ID, "Subtitle conversion error for %s: %v\nOutput: %s", conversion.track.Source, err, string(output))
+		return fmt.Errorf("converting subtitle %s failed: %v", conversion.track.Source, err)
+	}
+	return err
+}
@@ -0,0 +1,114 @@
+package services
+
+import (
+	"TranscodingService/src/domain"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeFFmpeg puts an ffmpeg on PATH that logs its arguments to the returned file, writes a short WebVTT track to its last output and fails when the arguments contain failOn
+func fakeFFmpeg(t *testing.T, failOn string) string {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake ffmpeg is a shell script")
+	}
+	dir := t.TempDir()
+	calls := filepath.Join(dir, "calls")
+	script := fmt.Sprintf(`#!/bin/sh
+echo "$*" >> '%s'
+case "$*" in *'%s'*) echo 'Invalid data found when processing input' >&2; exit 1;; esac
+for last; do :; done
+case "$last" in file:*) printf 'WEBVTT\n\n00:00:01.000 --> 00:00:02.000\nHello\n' > "${last#file:}";; esac
+`, calls, failOn)
+	if err := os.WriteFile(filepath.Join(dir, "ffmpeg"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return calls
+}
+
+func TestConvertSubtitles(t *testing.T) {
+	calls := fakeFFmpeg(t, "-map 0:4 ")
+	dir := t.TempDir()
+	sidecar := filepath.Join(dir, "movie.de.srt")
+	if err := os.WriteFile(sidecar, []byte("1\n00:00:01,000 --> 00:00:02,000\nGr\xfc\xdfe\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	media := &domain.MediaInfo{Streams: []domain.MediaStream{
+		{Index: 0, Type: domain.VideoStream, Codec: "h264"},
+		{Index: 2, Type: domain.SubtitleStream, Codec: "subrip", Language: "en", Default: true},
+		{Index: 3, Type: domain.SubtitleStream, Codec: "hdmv_pgs_subtitle", Language: "fr"},
+		{Index: 4, Type: domain.SubtitleStream, Codec: "mov_text", Language: "es"},
+		{Index: 5, Type: domain.SubtitleStream, Codec: "ass"},
+	}}
+
+	repo := newFakeRepo()
+	s := newTestService(repo, 1)
+	task := &TranscodingTask{
+		ID:         "job-1",
+		Format:     domain.HLS,
+		InputFile:  filepath.Join(dir, "movie.mkv"),
+		OutputFile: filepath.Join(dir, "out", "master.m3u8"),
+		Subtitles:  []domain.SubtitleSource{{File: sidecar, Language: "de"}},
+	}
+
+	tracks, err := s.convertSubtitles(context.Background(), task, media, time.Minute)
+	if err != nil {
+		t.Fatalf("convertSubtitles() = %v", err)
+	}
+
+	subtitles := filepath.Join(dir, "out", "subtitles")
+	want := []domain.SubtitleTrack{
+		{Language: "en", Codec: "subrip", Source: "stream 2", File: filepath.Join(subtitles, "1_en.vtt"), Playlist: filepath.Join(subtitles, "1_en.m3u8"), Default: true},
+		{Language: "und", Codec: "ass", Source: "stream 5", File: filepath.Join(subtitles, "2_und.vtt"), Playlist: filepath.Join(subtitles, "2_und.m3u8")},
+		{Language: "de", Codec: "srt", Source: sidecar, File: filepath.Join(subtitles, "3_de.vtt"), Playlist: filepath.Join(subtitles, "3_de.m3u8")},
+	}
+	if len(tracks) != len(want) {
+		t.Fatalf("convertSubtitles() = %+v, want %+v", tracks, want)
+	}
+	for i := range want {
+		if tracks[i] != want[i] {
+			t.Errorf("track %d = %+v, want %+v", i+1, tracks[i], want[i])
+		}
+		if _, err := os.Stat(tracks[i].Playlist); err != nil {
+			t.Errorf("track %d playlist: %v", i+1, err)
+		}
+	}
+
+	logged, err := os.ReadFile(calls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runs := strings.Count(string(logged), "\n"); runs != 4 {
+		t.Errorf("ran ffmpeg %d times, want 4 (bitmap subtitles skipped):\n%s", runs, logged)
+	}
+	if !strings.Contains(string(logged), "-sub_charenc CP1252 -i file:"+sidecar) {
+		t.Errorf("sidecar was not decoded with the fallback charset:\n%s", logged)
+	}
+	if _, err := os.Stat(filepath.Join(subtitles, "3_es.vtt")); !os.IsNotExist(err) {
+		t.Errorf("failed conversion left its output behind: %v", err)
+	}
+	if logs := strings.Join(repo.logs["job-1"], "\n"); !strings.Contains(logs, "Skipping hdmv_pgs_subtitle subtitle stream 3") || !strings.Contains(logs, "Skipping subtitle stream 4") {
+		t.Errorf("skipped streams were not logged:\n%s", logs)
+	}
+}
+
+func TestConvertSubtitlesFailsOnBadSidecar(t *testing.T) {
+	fakeFFmpeg(t, "movie.en.srt")
+	dir := t.TempDir()
+	sidecar := filepath.Join(dir, "movie.en.srt")
+	if err := os.WriteFile(sidecar, []byte("not subtitles"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := newTestService(newFakeRepo(), 1)
+	task := &TranscodingTask{ID: "job-1", Format: domain.MP4, OutputFile: filepath.Join(dir, "movie.mp4"), Subtitles: []domain.SubtitleSource{{File: sidecar}}}
+	if _, err := s.convertSubtitles(context.Background(), task, nil, time.Minute); err == nil {
+		t.Error("convertSubtitles() of an unreadable sidecar succeeded")
+	}
+}
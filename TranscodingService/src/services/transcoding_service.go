@@ -1,87 +1,539 @@
 package services
 
 import (
+	"TranscodingService/src/config"
+	"TranscodingService/src/domain"
+	"TranscodingService/src/repositories"
+	"TranscodingService/src/storage"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
+
+	"github.com/google/uuid"
+)
+
+// TranscodingService defines the operations exposed through the transcoding API
+type TranscodingService interface {
+	StartQueue()
+	Transcode(request domain.TranscodingRequest) (*TranscodingResult, error)
+	GetStatus(jobID string) (*JobStatus, error)
+	GetAllJobs() ([]*JobStatus, error)
+	CancelJob(jobID string) error
+	GetJobLogs(jobID string) ([]string, error)
+	ResubmitJob(jobID string) error
+	GetSupportedFormats() ([]domain.FormatSupport, error)
+	UpdatePriority(jobID string, priority int) error
+	ProcessWebhook(notification domain.TranscodingNotification) error
+	PauseJob(jobID string) error
+	ResumeJob(jobID string) error
+	CheckHealth() HealthStatus
+	GetWorkers() ([]WorkerStatus, error)
+	Probe(inputFile string) (*domain.MediaInfo, error)
+	GetProfiles() []domain.EncodingProfile
+}
+
+var (
+	// ErrQueueFull is returned when a job cannot be queued without blocking
+	ErrQueueFull = errors.New("transcoding queue is full")
+	// ErrNotSupported is returned for operations the worker pool cannot perform
+	ErrNotSupported = errors.New("operation not supported")
 )
 
-type TranscodingService struct {
-	taskQueue     chan *TranscodingTask
-	activeTasks   map[string]*TranscodingTask
-	taskMutex     sync.Mutex
-	maxConcurrent int
+// transcodingServiceImpl implements the TranscodingService interface on top of a worker pool
+type transcodingServiceImpl struct {
+	repo            repositories.TranscodingRepository
+	taskQueue       jobQueue
+	queuedTasks     map[string]*TranscodingTask
+	pausedTasks     map[string]*TranscodingTask
+	activeTasks     map[string]*TranscodingTask
+	taskMutex       sync.Mutex
+	maxConcurrent   int
+	maxRetries      int
+	retryDelay      time.Duration
+	paths           domain.PathPolicy
+	bitrates        domain.BitrateRange
+	videoCodecs     codecAllowList
+	audioCodecs     codecAllowList
+	profiles        map[string]domain.EncodingProfile
+	trickplay       domain.TrickplayOptions
+	posters         domain.PosterOptions
+	subtitleCharset string
+	audio           audioDefaults
+	chunking        domain.ChunkOptions
+	twoPass         domain.TwoPassOptions
+	distributed     bool // jobs wait in the repository for worker processes to claim
+	brokered        bool // jobs wait in a message broker shared with other instances
+	agingInterval   time.Duration
+	stores          *storage.Backends
+	bucket          string // the only bucket s3 URIs may name
+	stagingRoot     string
+	leases          domain.LeaseOptions
+	workerID        string // registration of this process, in distributed mode
+	capabilities    capabilityCache
 }
 
 type TranscodingTask struct {
 	ID         string
+	Type       domain.JobType
+	VideoID    string
 	InputFile  string
 	OutputFile string
-	Status     string
+	Format     domain.VideoFormat
+	Resolution domain.Resolution
+	Profile    string
+	Pad        bool
+	AutoCrop   bool
+	Renditions []domain.Rendition
+	Trickplay  *domain.TrickplayOptions
+	Poster     *domain.PosterOptions
+	Subtitles  []domain.SubtitleSource
+	Audio      *domain.AudioOptions
+	TwoPass    bool
+	Remote     *domain.RemoteFiles
+	Priority   int
+	Status     domain.TranscodingStatus
 	Progress   float64
+	Duration   time.Duration
+	Frame      int64
+	FPS        float64
+	Speed      float64
+	ETA        time.Duration
 	StartedAt  time.Time
 	FinishedAt time.Time
 	Error      error
+
+	cancel          context.CancelFunc
+	process         *os.Process
+	pausePending    bool // a pause requested between encodes, applied when the next one starts
+	progressSavedAt time.Time
+	encodeIndex     int // position of the running encode among those this attempt performs
+	encodeCount     int
+	chunked         bool // encoding chunks in several processes, which cannot be suspended as one
+	encodeRuns      int  // ffmpeg invocations encoding renditions in this attempt
+	encodeCPU       time.Duration
+	leased          bool // claimed from the repository under a lease this process renews
+	leaseLost       bool // the lease lapsed or was revoked, so the job may be running elsewhere
+}
+
+// TranscodingResult is returned once a job has been accepted
+type TranscodingResult struct {
+	JobID  string                   `json:"job_id"`
+	Status domain.TranscodingStatus `json:"status"`
+}
+
+// JobStatus is the externally visible state of a transcoding job
+type JobStatus struct {
+	JobID        string                   `json:"job_id"`
+	Type         domain.JobType           `json:"type"`
+	VideoID      string                   `json:"video_id"`
+	OutputFormat string                   `json:"output_format"`
+	VideoCodec   string                   `json:"video_codec,omitempty"`
+	AudioCodec   string                   `json:"audio_codec,omitempty"`
+	Profile      string                   `json:"profile,omitempty"`
+	Pad          bool                     `json:"pad,omitempty"`
+	AutoCrop     bool                     `json:"auto_crop,omitempty"`
+	Resolution   string                   `json:"resolution"`
+	Priority     int                      `json:"priority"`
+	Status       domain.TranscodingStatus `json:"status"`
+	Progress     float64                  `json:"progress"`
+	FPS          float64                  `json:"fps,omitempty"`
+	Speed        float64                  `json:"speed,omitempty"`
+	ETASeconds   float64                  `json:"eta_seconds,omitempty"`
+	Error        string                   `json:"error,omitempty"`
+	Attempts     int                      `json:"attempts"`
+	StartedAt    *time.Time               `json:"started_at,omitempty"`
+	FinishedAt   *time.Time               `json:"finished_at,omitempty"`
+	CreatedAt    time.Time                `json:"created_at"`
+	UpdatedAt    time.Time                `json:"updated_at"`
+	ManifestFile string                   `json:"manifest_file,omitempty"`
+	Metadata     *domain.OutputMetadata   `json:"output_metadata,omitempty"`
+	Renditions   []domain.Rendition       `json:"renditions,omitempty"`
+	Trickplay    *domain.TrickplayOptions `json:"trickplay,omitempty"`
+	Poster       *domain.PosterOptions    `json:"poster,omitempty"`
+	WorkerID     string                   `json:"worker_id,omitempty"`
+	LeaseExpires *time.Time               `json:"lease_expires_at,omitempty"`
+}
+
+// HealthStatus reports whether the service is able to accept and run jobs
+type HealthStatus struct {
+	Status     string `json:"status"`
+	FFmpeg     bool   `json:"ffmpeg"`
+	QueuedJobs int    `json:"queued_jobs"`
+	PausedJobs int    `json:"paused_jobs"`
+	ActiveJobs int    `json:"active_jobs"`
+	Workers    int    `json:"workers"`
 }
 
+// progressSaveInterval limits how often running progress is written to the repository
+const progressSaveInterval = 5 * time.Second
+
 // NewTranscodingService creates a new TranscodingService
-func NewTranscodingService(queueSize, maxConcurrent int) *TranscodingService {
-	return &TranscodingService{
-		taskQueue:     make(chan *TranscodingTask, queueSize),
+func NewTranscodingService(repo repositories.TranscodingRepository, cfg *config.Config) TranscodingService {
+	bitrates, err := cfg.Transcoding.BitrateRange.Range()
+	if err != nil {
+		log.Printf("Bitrate ladders are unavailable: %v", err)
+	}
+	profiles, err := cfg.Transcoding.EncodingProfiles()
+	if err != nil {
+		log.Printf("Encoding profiles are unavailable: %v", err)
+	}
+	var s3 *storage.S3Options
+	if cfg.Storage.S3Enabled() {
+		options := cfg.Storage.S3.Options()
+		s3 = &options
+	}
+	stores, err := storage.NewBackends(s3)
+	if err != nil {
+		log.Printf("S3 storage is unavailable: %v", err)
+		stores, _ = storage.NewBackends(nil)
+	}
+	stagingRoot := resolveStagingRoot(cfg.Storage.WorkspaceDir())
+	s := &transcodingServiceImpl{
+		repo:          repo,
+		queuedTasks:   make(map[string]*TranscodingTask),
+		pausedTasks:   make(map[string]*TranscodingTask),
 		activeTasks:   make(map[string]*TranscodingTask),
-		maxConcurrent: maxConcurrent,
+		maxConcurrent: cfg.Transcoding.MaxConcurrentJobs,
+		maxRetries:    cfg.RetryPolicy.MaxRetries,
+		retryDelay:    cfg.RetryPolicy.Delay(),
+		paths: domain.PathPolicy{
+			InputRoots:  allowStaging(cfg.Transcoding.InputRoots, stagingRoot),
+			OutputRoots: allowStaging(cfg.Transcoding.OutputRoots, stagingRoot),
+		},
+		bitrates:        bitrates,
+		videoCodecs:     newCodecAllowList(cfg.Transcoding.Formats),
+		audioCodecs:     newCodecAllowList(cfg.Transcoding.Audio.Codecs),
+		profiles:        profiles,
+		trickplay:       cfg.Transcoding.Trickplay.Options(),
+		posters:         cfg.Transcoding.Posters.Options(),
+		subtitleCharset: cfg.Transcoding.Subtitles.Charset(),
+		audio:           newAudioDefaults(cfg.Transcoding.Audio),
+		chunking:        cfg.Transcoding.Chunking.Options(),
+		twoPass:         cfg.Transcoding.TwoPass.Options(),
+		distributed:     cfg.Transcoding.Workers.Distributed(),
+		leases:          cfg.Transcoding.Workers.Options(),
+		agingInterval:   cfg.Transcoding.PriorityAgingInterval(),
+		stores:          stores,
+		bucket:          cfg.Storage.S3.BucketName,
+		stagingRoot:     stagingRoot,
 	}
+	// Worker processes claim jobs from the repository, so their queue only carries chunks
+	if cfg.Queue.Brokered() && !s.distributed {
+		s.brokered = true
+		s.taskQueue = newRabbitQueue(cfg.Queue.RabbitMQ, s.deliveredTask)
+	} else {
+		s.taskQueue = newPriorityQueue(cfg.Transcoding.QueueSize, s.agingInterval)
+	}
+	return s
 }
 
-// StartQueue starts processing the task queue
-func (s *TranscodingService) StartQueue() {
+// StartQueue restores jobs left over from a previous run and starts the workers, or leases jobs when shared
+func (s *transcodingServiceImpl) StartQueue() {
+	if s.distributed {
+		go s.startLeasing()
+		return
+	}
+	if s.brokered {
+		go func() {
+			s.registerWorker()
+			go s.renewLeases()
+			s.startWorkers()
+		}()
+		return
+	}
+	s.restorePausedJobs()
+	s.recoverInterruptedJobs()
+	s.startWorkers()
+}
+
+// startWorkers starts as many workers taking tasks from the queue as there are slots
+func (s *transcodingServiceImpl) startWorkers() {
 	for i := 0; i < s.maxConcurrent; i++ {
 		go s.worker()
 	}
 }
 
-// AddTask adds a new transcoding task to the queue
-func (s *TranscodingService) AddTask(task *TranscodingTask) {
-	s.taskQueue <- task
+// Transcode validates a request, records it as a job and queues it for the worker pool
+func (s *transcodingServiceImpl) Transcode(request domain.TranscodingRequest) (*TranscodingResult, error) {
+	if request.JobType() != domain.TranscodeJob {
+		return s.submitArtifactJob(request)
+	}
+
+	var profile *domain.EncodingProfile
+	if request.Profile != "" {
+		p, ok := s.profiles[request.Profile]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", domain.ErrUnknownProfile, request.Profile)
+		}
+		if err := request.ApplyProfile(p); err != nil {
+			return nil, err
+		}
+		profile = &p
+	}
+	if err := request.Validate(s.paths); err != nil {
+		return nil, err
+	}
+	videoCodec, audioCodec := request.VideoCodecOrDefault(), request.AudioCodecOrDefault()
+	if err := s.checkEncoders(request.TargetFormat, videoCodec, audioCodec); err != nil {
+		return nil, err
+	}
+
+	jobID := uuid.New().String()
+	remote, err := s.stageRequest(jobID, &request)
+	if err != nil {
+		return nil, err
+	}
+	inputFile, err := s.paths.ResolveInput(request.InputFile)
+	if err != nil {
+		return nil, err
+	}
+	// An input in storage is only staged once the job runs, which probes it then
+	if remote == nil || remote.Input == "" {
+		media, err := s.inspectInput(inputFile)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := domain.SelectAudioTracks(media, request.AudioLanguages); err != nil {
+			return nil, err
+		}
+	}
+	outputFile, err := s.paths.ResolveOutput(request.OutputPath())
+	if err != nil {
+		return nil, err
+	}
+	renditions, err := request.Renditions(s.bitrates)
+	if err != nil {
+		return nil, err
+	}
+	resolutions := make([]string, len(renditions))
+	for i := range renditions {
+		if renditions[i].OutputFile, err = s.paths.ResolveOutput(renditions[i].OutputFile); err != nil {
+			return nil, err
+		}
+		resolutions[i] = string(renditions[i].Resolution)
+		if profile != nil && renditions[i].Bitrate == "" {
+			renditions[i].Bitrate = profile.Bitrate
+		}
+		if request.TwoPass {
+			if renditions[i].Bitrate, err = s.bitrates.TwoPassBitrate(renditions[i]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	resolution := strings.Join(resolutions, ",")
+
+	subtitles := make([]domain.SubtitleSource, len(request.Subtitles))
+	for i, subtitle := range request.Subtitles {
+		if subtitle.File, err = s.paths.ResolveInput(subtitle.File); err != nil {
+			return nil, err
+		}
+		subtitle.Language = subtitle.LanguageOrGuess()
+		subtitles[i] = subtitle
+	}
+	var audio *domain.AudioOptions
+	if len(request.AudioLanguages) > 0 || request.NormalizeAudio != nil {
+		audio = &domain.AudioOptions{Languages: request.AudioLanguages, Normalize: request.NormalizeAudio}
+	}
+	var options []byte
+	if len(subtitles) > 0 || audio != nil || request.TwoPass || remote != nil {
+		if options, err = json.Marshal(domain.JobOptions{Subtitles: subtitles, Audio: audio, TwoPass: request.TwoPass, Remote: remote}); err != nil {
+			return nil, fmt.Errorf("failed to encode job options: %v", err)
+		}
+	}
+
+	jobID, err = s.repo.CreateJob(repositories.TranscodingJobInput{
+		JobID:        jobID,
+		Options:      string(options),
+		VideoID:      request.VideoID,
+		InputFormat:  strings.TrimPrefix(filepath.Ext(inputFile), "."),
+		OutputFormat: string(request.TargetFormat),
+		VideoCodec:   string(videoCodec),
+		AudioCodec:   string(audioCodec),
+		Profile:      request.Profile,
+		Pad:          request.Pad,
+		AutoCrop:     request.AutoCrop,
+		InputFile:    inputFile,
+		OutputFile:   outputFile,
+		Resolution:   resolution,
+		Priority:     request.Priority,
+		Renditions:   renditions,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create transcoding job: %v", err)
+	}
+
+	task := &TranscodingTask{
+		ID:         jobID,
+		Type:       domain.TranscodeJob,
+		VideoID:    request.VideoID,
+		InputFile:  inputFile,
+		OutputFile: outputFile,
+		Format:     request.TargetFormat,
+		Resolution: domain.Resolution(resolution),
+		Profile:    request.Profile,
+		Pad:        request.Pad,
+		AutoCrop:   request.AutoCrop,
+		Renditions: renditions,
+		Subtitles:  subtitles,
+		Audio:      audio,
+		TwoPass:    request.TwoPass,
+		Remote:     remote,
+		Priority:   request.Priority,
+		Status:     domain.Queued,
+	}
+	if err := s.AddTask(task); err != nil {
+		s.finishJob(jobID, domain.Failed, err.Error())
+		return nil, err
+	}
+
+	s.appendLog(jobID, "Job queued: %s -> %s (%s, priority %d)", task.InputFile, task.OutputFile, task.Resolution, task.Priority)
+	return &TranscodingResult{JobID: jobID, Status: task.Status}, nil
+}
+
+// AddTask adds a new transcoding task to the queue, which the repository or broker may already hold
+func (s *transcodingServiceImpl) AddTask(task *TranscodingTask) error {
+	if s.distributed {
+		return nil
+	}
+	if s.brokered {
+		return s.taskQueue.Push(task)
+	}
+	s.taskMutex.Lock()
+	defer s.taskMutex.Unlock()
+
+	if err := s.taskQueue.Push(task); err != nil {
+		return err
+	}
+	s.queuedTasks[task.ID] = task
+	return nil
+}
+
+// queueRetry queues a task marked for retry once the retry delay has passed
+func (s *transcodingServiceImpl) queueRetry(task *TranscodingTask) error {
+	if s.remoteQueue() || s.retryDelay <= 0 {
+		return s.AddTask(task)
+	}
+	s.taskMutex.Lock()
+	s.queuedTasks[task.ID] = task
+	s.taskMutex.Unlock()
+
+	time.AfterFunc(s.retryDelay, func() {
+		s.taskMutex.Lock()
+		var err error
+		if s.queuedTasks[task.ID] == task {
+			if err = s.taskQueue.Push(task); err != nil {
+				delete(s.queuedTasks, task.ID)
+			}
+		}
+		s.taskMutex.Unlock()
+		if err != nil {
+			s.finishJob(task.ID, domain.Failed, err.Error())
+		}
+	})
+	return nil
 }
 
-// worker processes tasks from the queue
-func (s *TranscodingService) worker() {
-	for task := range s.taskQueue {
-		s.startTask(task)
-		s.processTask(task)
+// worker processes tasks from the queue, highest priority first
+func (s *transcodingServiceImpl) worker() {
+	for {
+		task, chunk, ok := s.taskQueue.Pop()
+		if !ok {
+			return
+		}
+		if chunk != nil {
+			chunk.run()
+			continue
+		}
+		ctx, started := s.startTask(task)
+		if !started {
+			s.taskQueue.Ack(task.ID)
+			continue
+		}
+		s.processTask(ctx, task)
 		s.completeTask(task)
+		s.taskQueue.Ack(task.ID)
 	}
 }
 
-// startTask updates task state and adds it to activeTasks
-func (s *TranscodingService) startTask(task *TranscodingTask) {
-	task.StartedAt = time.Now()
-	task.Status = "Started"
+// startTask moves a queued task into activeTasks, reporting false when it was cancelled while waiting
+func (s *transcodingServiceImpl) startTask(task *TranscodingTask) (context.Context, bool) {
 	s.taskMutex.Lock()
+	if s.queuedTasks[task.ID] != task {
+		s.taskMutex.Unlock()
+		return nil, false
+	}
+	delete(s.queuedTasks, task.ID)
+	if err := task.setStatus(domain.Running); err != nil {
+		s.taskMutex.Unlock()
+		log.Printf("Task %s cannot start: %v", task.ID, err)
+		return nil, false
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	task.cancel = cancel
+	task.leased = s.brokered
+	task.StartedAt = time.Now()
 	s.activeTasks[task.ID] = task
 	s.taskMutex.Unlock()
-	log.Printf("Task %s started.", task.ID)
+
+	if err := s.repo.MarkJobStarted(task.ID, s.workerID, s.leases.Lease); err != nil {
+		// Another instance sharing the broker started the job from a message published after a priority change
+		var transitionErr *domain.TransitionError
+		if s.brokered && errors.As(err, &transitionErr) {
+			s.taskMutex.Lock()
+			delete(s.activeTasks, task.ID)
+			s.taskMutex.Unlock()
+			cancel()
+			log.Printf("Task %s is no longer waiting to run: %v", task.ID, err)
+			return nil, false
+		}
+		log.Printf("Failed to persist start of job %s: %v", task.ID, err)
+	}
+	s.appendLog(task.ID, "Task %s started.", task.ID)
+	return ctx, true
 }
 
-// completeTask marks the task as finished and removes it from activeTasks
-func (s *TranscodingService) completeTask(task *TranscodingTask) {
-	task.FinishedAt = time.Now()
+// completeTask records the task's terminal state and removes it from activeTasks
+func (s *transcodingServiceImpl) completeTask(task *TranscodingTask) {
 	s.taskMutex.Lock()
+	task.FinishedAt = time.Now()
+	task.cancel()
+	task.process = nil
 	delete(s.activeTasks, task.ID)
+	lost := task.leaseLost
 	s.taskMutex.Unlock()
+
+	if lost {
+		s.appendLog(task.ID, "Task %s stopped on worker %s, which no longer holds its lease.", task.ID, s.workerID)
+		return
+	}
+
+	errorMessage := ""
 	if task.Error != nil {
-		log.Printf("Task %s completed with error: %v", task.ID, task.Error)
+		errorMessage = task.Error.Error()
+	}
+	s.finishJob(task.ID, task.Status, errorMessage)
+	if task.Status == domain.Cancelled {
+		s.appendLog(task.ID, "Task %s was cancelled.", task.ID)
+	} else if task.Error != nil {
+		s.appendLog(task.ID, "Task %s completed with error: %v", task.ID, task.Error)
 	} else {
-		log.Printf("Task %s completed successfully.", task.ID)
+		s.appendLog(task.ID, "Task %s completed successfully.", task.ID)
 	}
 }
 
 // GetActiveTasks returns a list of active transcoding tasks
-func (s *TranscodingService) GetActiveTasks() []*TranscodingTask {
+func (s *transcodingServiceImpl) GetActiveTasks() []*TranscodingTask {
 	s.taskMutex.Lock()
 	defer s.taskMutex.Unlock()
 	tasks := make([]*TranscodingTask, 0, len(s.activeTasks))
@@ -92,127 +544,903 @@ func (s *TranscodingService) GetActiveTasks() []*TranscodingTask {
 }
 
 // GetTaskByID retrieves a task by its ID
-func (s *TranscodingService) GetTaskByID(taskID string) (*TranscodingTask, error) {
+func (s *transcodingServiceImpl) GetTaskByID(taskID string) (*TranscodingTask, error) {
 	s.taskMutex.Lock()
 	defer s.taskMutex.Unlock()
 	task, exists := s.activeTasks[taskID]
 	if !exists {
-		return nil, fmt.Errorf("task %s not found", taskID)
+		return nil, fmt.Errorf("%w: %s", repositories.ErrJobNotFound, taskID)
 	}
 	return task, nil
 }
 
 // processTask runs the transcoding process for a task
-func (s *TranscodingService) processTask(task *TranscodingTask) {
-	// Simulate transcoding with a sleep
-	time.Sleep(5 * time.Second)
-
-	inputFilePath := task.InputFile
-	outputFilePath := task.OutputFile
+func (s *transcodingServiceImpl) processTask(ctx context.Context, task *TranscodingTask) {
+	err := s.stageInput(ctx, task)
+	if err == nil {
+		switch task.Type {
+		case domain.TrickplayJob:
+			err = s.runTrickplay(ctx, task)
+		case domain.PosterJob:
+			err = s.runPosters(ctx, task)
+		default:
+			err = s.runTranscoding(ctx, task)
+		}
+	}
+	if err == nil && ctx.Err() == nil {
+		// The workspace sits among the outputs, so it goes before they are uploaded
+		s.removeWorkspace(task)
+		err = s.uploadOutputs(ctx, task)
+	}
 
-	err := s.runTranscoding(inputFilePath, outputFilePath)
-	if err != nil {
+	s.taskMutex.Lock()
+	defer s.taskMutex.Unlock()
+	if task.leaseLost {
+		// Another worker may already be running the job, so its outputs and workspace are left alone
+		return
+	}
+	s.removeWorkspace(task)
+	defer s.removeStaging(task)
+	next := domain.Completed
+	if ctx.Err() != nil {
+		next = domain.Cancelled
+		removeUnfinishedRenditions(task.Format, task.Renditions)
+		removeChunks(task.Format, task.Renditions)
+		removeArtifacts(task.Type, task.OutputFile)
+	} else if err != nil {
 		task.Error = err
-		task.Status = "Failed"
+		next = domain.Failed
 	} else {
-		task.Status = "Completed"
 		task.Progress = 100
 	}
+
+	if task.Status == next {
+		return
+	}
+	if err := task.setStatus(next); err != nil {
+		log.Printf("Task %s finished but could not record it: %v", task.ID, err)
+	}
 }
 
-// runTranscoding performs the actual transcoding
-func (s *TranscodingService) runTranscoding(inputFile, outputFile string) error {
-	// Command that uses ffmpeg for video transcoding
-	cmd := exec.Command("ffmpeg", "-i", inputFile, "-codec:v", "libx264", outputFile)
+// runTranscoding performs the actual transcoding, encoding each outstanding rendition in turn
+func (s *transcodingServiceImpl) runTranscoding(ctx context.Context, task *TranscodingTask) error {
+	var profile *domain.EncodingProfile
+	if task.Profile != "" {
+		p, ok := s.profiles[task.Profile]
+		if !ok {
+			return fmt.Errorf("%w: %s is no longer configured", domain.ErrUnknownProfile, task.Profile)
+		}
+		profile = &p
+	}
 
-	// Run the command and capture output
-	output, err := cmd.CombinedOutput()
+	var duration time.Duration
+	var sourceHeight int
+	media, err := probeMedia(ctx, task.InputFile)
+	if err != nil && task.Format == domain.DASH {
+		return fmt.Errorf("a DASH manifest needs the source duration: %v", err)
+	}
 	if err != nil {
-		log.Printf("Transcoding error: %v\nOutput: %s", err, string(output))
-		return fmt.Errorf("transcoding failed: %v", err)
+		s.appendLog(task.ID, "Could not probe input, progress will not be reported and no renditions are skipped: %v", err)
+	} else {
+		duration = media.Duration()
+		if video := media.VideoStream(); video != nil {
+			sourceHeight = video.Height
+		}
 	}
 
-	log.Printf("Transcoding successful for file: %s", inputFile)
-	return nil
-}
+	metadata := s.planGeometry(ctx, task, media)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	audio, err := s.planAudio(ctx, task, media, profile)
+	if err != nil {
+		return err
+	}
+	if audio != nil {
+		metadata.Audio = audio.Tracks
+		metadata.Loudness = audio.Loudness
+		s.saveMetadata(task.ID, metadata)
+	}
+
+	s.taskMutex.Lock()
+	task.Duration = duration
+	for i := range task.Renditions {
+		if task.Renditions[i].Status != domain.RenditionCompleted {
+			task.Renditions[i].Status = domain.RenditionQueued
+			task.Renditions[i].Error = ""
+		}
+	}
+	domain.SkipAboveSource(task.Renditions, sourceHeight)
+	var pending []int
+	for i, rendition := range task.Renditions {
+		if rendition.Status == domain.RenditionQueued {
+			pending = append(pending, i)
+		}
+	}
+	renditions := append([]domain.Rendition(nil), task.Renditions...)
+	s.taskMutex.Unlock()
+	for i := range renditions {
+		renditions[i].Profile = profile
+		renditions[i].Audio = audio
+		if task.TwoPass && renditions[i].Status == domain.RenditionQueued {
+			if renditions[i].TwoPass, err = s.twoPass.Plan(renditions[i], s.workspace(task)); err != nil {
+				return err
+			}
+		}
+	}
+
+	for i, rendition := range renditions {
+		if rendition.Status == domain.RenditionSkipped {
+			s.updateRendition(task.ID, i, rendition.Status, "")
+			s.appendLog(task.ID, "Skipped %s rendition, the source is only %dp", rendition.Resolution, sourceHeight)
+		}
+	}
 
-// SaveTaskResults saves the transcoding results to a file or database
-func (s *TranscodingService) SaveTaskResults(task *TranscodingTask) error {
-	// Simulate saving the results to a file or database
-	resultPath := filepath.Join("transcoding_results", task.ID+".json")
-	err := writeToFile(resultPath, fmt.Sprintf("Task ID: %s, Status: %s", task.ID, task.Status))
+	stats, err := s.encodeRenditions(ctx, task, renditions, pending, duration)
 	if err != nil {
 		return err
 	}
-	log.Printf("Results saved for task: %s", task.ID)
+	if stats != nil {
+		metadata.Encoding = stats
+		s.saveMetadata(task.ID, metadata)
+	}
+
+	subtitles, err := s.convertSubtitles(ctx, task, media, duration)
+	if err != nil {
+		return err
+	}
+	if len(subtitles) > 0 {
+		metadata.Subtitles = subtitles
+		s.saveMetadata(task.ID, metadata)
+	}
+
+	if task.Format.IsStreaming() {
+		s.taskMutex.Lock()
+		renditions = append(renditions[:0], task.Renditions...)
+		s.taskMutex.Unlock()
+		for i := range renditions {
+			renditions[i].Profile = profile
+			renditions[i].Audio = audio
+		}
+		if task.Format == domain.HLS && audio != nil && len(audio.Tracks) > 1 {
+			if err := s.encodeAlternateAudio(ctx, task, renditions, audio); err != nil {
+				return err
+			}
+			s.saveMetadata(task.ID, metadata)
+		}
+		if err := domain.WriteManifest(task.Format, task.OutputFile, renditions, subtitles, duration); err != nil {
+			return err
+		}
+		s.appendLog(task.ID, "Wrote manifest %s", task.OutputFile)
+	}
+
+	s.appendLog(task.ID, "Transcoding successful for file: %s", task.InputFile)
 	return nil
 }
 
-// writeToFile saves the transcoding results to a file
-func writeToFile(filePath, content string) error {
-	file, err := exec.Command("touch", filePath).Output()
+// encodeRendition runs ffmpeg for one rendition of a task, reporting progress as it goes
+func (s *transcodingServiceImpl) encodeRendition(ctx context.Context, task *TranscodingTask, rendition domain.Rendition) error {
+	// Command that uses ffmpeg for video transcoding, reporting progress on stdout
+	args, err := domain.NewPackagedRenditionCommand(s.paths, task.Format, task.InputFile, rendition).
+		Global("-nostats", "-progress", "pipe:1").
+		Build()
 	if err != nil {
-		log.Printf("Error creating file: %v", err)
 		return err
 	}
-	err = exec.Command("echo", content).Run()
+	if task.Format.IsStreaming() {
+		if err := os.MkdirAll(filepath.Dir(rendition.OutputFile), 0755); err != nil {
+			return fmt.Errorf("failed to create rendition directory: %v", err)
+		}
+	}
+	cmd := exec.Command("ffmpeg", args...)
+
+	// Run the command and capture output
+	onStart, onProgress := s.progressReporter(task)
+	output, err := runCommand(ctx, cmd, onStart, onProgress)
+	s.recordUsage(task, cmd)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
 	if err != nil {
-		log.Printf("Error writing to file: %v", err)
-		return err
+		s.appendLog(task.ID, "Transcoding error for %s rendition: %v\nOutput: %s", rendition.Resolution, err, string(output))
+		return fmt.Errorf("transcoding %s rendition failed: %v", rendition.Resolution, err)
 	}
-	log.Printf("File written successfully: %s", string(file))
+
+	s.appendLog(task.ID, "Encoded %s rendition to %s", rendition.Resolution, rendition.OutputFile)
 	return nil
 }
 
+// progressReporter returns the runCommand callbacks that track a task's process and progress
+func (s *transcodingServiceImpl) progressReporter(task *TranscodingTask) (func(*os.Process), func(ffmpegProgress)) {
+	onStart := func(process *os.Process) {
+		s.taskMutex.Lock()
+		task.process = process
+		paused := false
+		if process != nil && task.pausePending && task.Status == domain.Running {
+			task.pausePending = false
+			if err := suspendProcessGroup(process); err != nil {
+				log.Printf("Failed to suspend job %s: %v", task.ID, err)
+			} else {
+				task.Status = domain.Paused
+				paused = true
+			}
+		}
+		s.taskMutex.Unlock()
+
+		if paused {
+			s.updateJobStatus(task.ID, domain.Paused)
+			s.appendLog(task.ID, "Running job paused as its next encode started")
+		}
+	}
+	onProgress := func(p ffmpegProgress) {
+		s.taskMutex.Lock()
+		applyProgress(task, p)
+		progress := task.Progress
+		save := time.Since(task.progressSavedAt) >= progressSaveInterval
+		if save {
+			task.progressSavedAt = time.Now()
+		}
+		s.taskMutex.Unlock()
+
+		if save {
+			if err := s.repo.UpdateJobProgress(task.ID, progress); err != nil {
+				log.Printf("Failed to persist progress for job %s: %v", task.ID, err)
+			}
+			if s.brokered {
+				s.stopIfCancelled(task)
+			}
+		}
+	}
+	return onStart, onProgress
+}
+
+// setRenditionStatus records the state of one rendition on the live task and in the repository
+func (s *transcodingServiceImpl) setRenditionStatus(task *TranscodingTask, position int, status domain.RenditionStatus, errorMessage string) {
+	s.taskMutex.Lock()
+	task.Renditions[position].Status = status
+	task.Renditions[position].Error = errorMessage
+	s.taskMutex.Unlock()
+	s.updateRendition(task.ID, position, status, errorMessage)
+}
+
+// runCommand runs cmd to completion, killing its process group if ctx is cancelled, and returns its stderr
+func runCommand(ctx context.Context, cmd *exec.Cmd, onStart func(*os.Process), onProgress func(ffmpegProgress)) ([]byte, error) {
+	var output bytes.Buffer
+	cmd.Stderr = &output
+	setProcessGroup(cmd)
+
+	progressReader, progressWriter := io.Pipe()
+	parsed := make(chan struct{})
+	if onProgress != nil {
+		cmd.Stdout = progressWriter
+		go func() {
+			defer close(parsed)
+			if err := parseProgress(progressReader, onProgress); err != nil {
+				log.Printf("Failed to parse ffmpeg progress: %v", err)
+			}
+			io.Copy(io.Discard, progressReader)
+		}()
+	} else {
+		cmd.Stdout = &output
+		close(parsed)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	if onStart != nil {
+		onStart(cmd.Process)
+		// The process is handed back as nil once it has exited
+		defer onStart(nil)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		err := cmd.Wait()
+		progressWriter.Close()
+		<-parsed
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		return output.Bytes(), err
+	case <-ctx.Done():
+		if err := killProcessGroup(cmd); err != nil {
+			log.Printf("Failed to kill ffmpeg process group %d: %v", cmd.Process.Pid, err)
+		}
+		<-done
+		return output.Bytes(), ctx.Err()
+	}
+}
+
+// removeUnfinishedRenditions deletes the outputs of renditions an interrupted run did not complete
+func removeUnfinishedRenditions(format domain.VideoFormat, renditions []domain.Rendition) {
+	for _, rendition := range renditions {
+		if rendition.Status == domain.RenditionCompleted {
+			continue
+		}
+		if !format.IsStreaming() {
+			removePartialOutput(rendition.OutputFile)
+			continue
+		}
+		if err := os.RemoveAll(filepath.Dir(rendition.OutputFile)); err != nil {
+			log.Printf("Failed to remove partial rendition %s: %v", filepath.Dir(rendition.OutputFile), err)
+		}
+	}
+}
+
+// removePartialOutput deletes whatever a cancelled run left behind
+func removePartialOutput(outputFile string) {
+	if err := os.Remove(outputFile); err != nil && !os.IsNotExist(err) {
+		log.Printf("Failed to remove partial output %s: %v", outputFile, err)
+	}
+}
+
 // CancelTask cancels a transcoding task by ID
-func (s *TranscodingService) CancelTask(taskID string) error {
+func (s *transcodingServiceImpl) CancelTask(taskID string) error {
 	s.taskMutex.Lock()
 	defer s.taskMutex.Unlock()
 
+	if task, queued := s.queuedTasks[taskID]; queued {
+		if err := task.setStatus(domain.Cancelled); err != nil {
+			return err
+		}
+		delete(s.queuedTasks, taskID)
+		s.taskQueue.Remove(taskID)
+		task.FinishedAt = time.Now()
+		log.Printf("Queued task %s has been cancelled.", task.ID)
+		return nil
+	}
+	if task, paused := s.pausedTasks[taskID]; paused {
+		if err := task.setStatus(domain.Cancelled); err != nil {
+			return err
+		}
+		delete(s.pausedTasks, taskID)
+		task.FinishedAt = time.Now()
+		log.Printf("Paused task %s has been cancelled.", task.ID)
+		return nil
+	}
+
 	task, exists := s.activeTasks[taskID]
 	if !exists {
 		return fmt.Errorf("task %s not found", taskID)
 	}
 
 	// Signal a running process to stop
-	task.Status = "Cancelled"
+	if err := task.setStatus(domain.Cancelled); err != nil {
+		return err
+	}
+	task.cancel()
 	log.Printf("Task %s has been cancelled.", task.ID)
 	return nil
 }
 
-// RetryTask retries a failed task by ID
-func (s *TranscodingService) RetryTask(taskID string) error {
-	task, err := s.GetTaskByID(taskID)
+// GetStatus returns the recorded state of a job, overlaid with live progress while it runs
+func (s *transcodingServiceImpl) GetStatus(jobID string) (*JobStatus, error) {
+	job, err := s.repo.GetJobStatus(jobID)
+	if err != nil {
+		return nil, err
+	}
+	status := s.jobStatus(job)
+	status.Renditions = s.loadRenditions(job)
+
+	s.taskMutex.Lock()
+	if task, ok := s.activeTasks[jobID]; ok {
+		status.Renditions = append([]domain.Rendition(nil), task.Renditions...)
+	}
+	s.taskMutex.Unlock()
+	for i := range status.Renditions {
+		status.Renditions[i].OutputFile = s.publicLocation(job, status.Renditions[i].OutputFile)
+	}
+	return status, nil
+}
+
+// GetAllJobs lists every recorded job, overlaying live progress for running ones
+func (s *transcodingServiceImpl) GetAllJobs() ([]*JobStatus, error) {
+	jobs, err := s.repo.GetAllJobs()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]*JobStatus, 0, len(jobs))
+	for _, job := range jobs {
+		statuses = append(statuses, s.jobStatus(job))
+	}
+	return statuses, nil
+}
+
+// CancelJob cancels a queued or running job and records the cancellation
+func (s *transcodingServiceImpl) CancelJob(jobID string) error {
+	if s.remoteQueue() && !s.isActive(jobID) {
+		return s.cancelStoredJob(jobID)
+	}
+	if err := s.CancelTask(jobID); err != nil {
+		return s.untrackedJob(jobID, err)
+	}
+	s.finishJob(jobID, domain.Cancelled, "")
+	s.appendLog(jobID, "Job cancelled")
+	return nil
+}
+
+// untrackedJob reports a job this process does not hold as not found when no job has that ID, and as err otherwise
+func (s *transcodingServiceImpl) untrackedJob(jobID string, err error) error {
+	if _, lookupErr := s.repo.GetJobStatus(jobID); errors.Is(lookupErr, repositories.ErrJobNotFound) {
+		return lookupErr
+	}
+	return err
+}
+
+// GetJobLogs returns the log lines recorded for a job
+func (s *transcodingServiceImpl) GetJobLogs(jobID string) ([]string, error) {
+	if _, err := s.repo.GetJobStatus(jobID); err != nil {
+		return nil, err
+	}
+	return s.repo.GetJobLogs(jobID)
+}
+
+// ResubmitJob queues a failed job again using its recorded input and output
+func (s *transcodingServiceImpl) ResubmitJob(jobID string) error {
+	job, err := s.repo.GetJobStatus(jobID)
 	if err != nil {
 		return err
 	}
-	if task.Status != "Failed" {
-		return fmt.Errorf("task %s is not in a failed state", taskID)
+	// Only failed jobs are resubmitted; a running job moves to retrying only when its run is interrupted
+	if err := s.repo.RetryJob(jobID); err != nil {
+		return err
 	}
 
-	log.Printf("Retrying task %s", task.ID)
-	go s.AddTask(task)
+	task := taskFromJob(job, domain.Retrying, s.loadRenditions(job))
+	if err := s.queueRetry(task); err != nil {
+		s.finishJob(jobID, domain.Failed, err.Error())
+		return err
+	}
+	s.appendLog(jobID, "Job resubmitted")
 	return nil
 }
 
-// MonitorProgress simulates a real-time task progress update
-func (s *TranscodingService) MonitorProgress(taskID string) {
-	for {
-		task, err := s.GetTaskByID(taskID)
-		if err != nil || task.Status == "Completed" || task.Status == "Failed" {
-			break
+// UpdatePriority changes the scheduling priority of a job still waiting in the queue
+func (s *transcodingServiceImpl) UpdatePriority(jobID string, priority int) error {
+	if s.remoteQueue() {
+		return s.prioritizeStoredJob(jobID, priority)
+	}
+	s.taskMutex.Lock()
+	task, queued := s.queuedTasks[jobID]
+	if queued && !s.taskQueue.UpdatePriority(jobID, priority) {
+		// A retry waiting out its delay enters the queue with the new priority
+		task.Priority = priority
+	}
+	s.taskMutex.Unlock()
+	if !queued {
+		return s.untrackedJob(jobID, fmt.Errorf("job %s is not waiting in the queue", jobID))
+	}
+
+	if err := s.repo.UpdateJobPriority(jobID, priority); err != nil {
+		log.Printf("Failed to persist priority %d for job %s: %v", priority, jobID, err)
+	}
+	s.appendLog(jobID, "Priority changed to %d", priority)
+	return nil
+}
+
+// ProcessWebhook applies a status report from an external encoder to the job
+func (s *transcodingServiceImpl) ProcessWebhook(notification domain.TranscodingNotification) error {
+	if notification.JobID == "" {
+		return errors.New("job ID cannot be empty")
+	}
+
+	status := notification.Status
+	if status != domain.Running && !status.IsTerminal() {
+		return fmt.Errorf("unsupported job status: %s", status)
+	}
+
+	if _, err := s.repo.GetJobStatus(notification.JobID); err != nil {
+		return err
+	}
+	if status == domain.Running {
+		if err := s.repo.UpdateJobStatus(notification.JobID, status); err != nil {
+			return err
+		}
+	} else {
+		errorMessage := ""
+		if status == domain.Failed {
+			errorMessage = notification.Message
+		}
+		if err := s.repo.MarkJobFinished(notification.JobID, status, errorMessage); err != nil {
+			return err
+		}
+	}
+	s.appendLog(notification.JobID, "Webhook reported status %s: %s", status, notification.Message)
+	return nil
+}
+
+// PauseJob holds a queued job out of scheduling, or suspends the encoder of a running one
+func (s *transcodingServiceImpl) PauseJob(jobID string) error {
+	if s.remoteQueue() && !s.isActive(jobID) {
+		return s.pauseStoredJob(jobID)
+	}
+	s.taskMutex.Lock()
+	if task, queued := s.queuedTasks[jobID]; queued {
+		if err := task.setStatus(domain.Paused); err != nil {
+			s.taskMutex.Unlock()
+			return err
+		}
+		delete(s.queuedTasks, jobID)
+		s.taskQueue.Remove(jobID)
+		s.pausedTasks[jobID] = task
+		s.taskMutex.Unlock()
+		s.updateJobStatus(jobID, task.Status)
+		s.appendLog(jobID, "Queued job paused")
+		return nil
+	}
+
+	task, active := s.activeTasks[jobID]
+	if !active {
+		s.taskMutex.Unlock()
+		return s.untrackedJob(jobID, fmt.Errorf("job %s is not queued or running", jobID))
+	}
+	if err := task.Status.ValidateTransition(domain.Paused); err != nil {
+		s.taskMutex.Unlock()
+		return err
+	}
+	if task.chunked {
+		s.taskMutex.Unlock()
+		return fmt.Errorf("job %s is encoding chunks across the worker pool and cannot be paused: %w", jobID, ErrNotSupported)
+	}
+	if task.leased && s.distributed {
+		s.taskMutex.Unlock()
+		return fmt.Errorf("job %s is leased to a worker and cannot be paused while running: %w", jobID, ErrNotSupported)
+	}
+	if task.process == nil {
+		task.pausePending = true
+		s.taskMutex.Unlock()
+		s.appendLog(jobID, "Running job will pause when its next encode starts")
+		return nil
+	}
+	if err := suspendProcessGroup(task.process); err != nil {
+		s.taskMutex.Unlock()
+		return fmt.Errorf("failed to suspend job %s: %w", jobID, err)
+	}
+	task.Status = domain.Paused
+	s.taskMutex.Unlock()
+
+	s.updateJobStatus(jobID, task.Status)
+	s.appendLog(jobID, "Running job paused")
+	return nil
+}
+
+// ResumeJob returns a paused job to the queue, or continues its suspended encoder
+func (s *transcodingServiceImpl) ResumeJob(jobID string) error {
+	if s.remoteQueue() && !s.isActive(jobID) {
+		return s.resumeStoredJob(jobID)
+	}
+	s.taskMutex.Lock()
+	if task, paused := s.pausedTasks[jobID]; paused {
+		if err := task.setStatus(domain.Queued); err != nil {
+			s.taskMutex.Unlock()
+			return err
+		}
+		if err := s.taskQueue.Push(task); err != nil {
+			task.Status = domain.Paused
+			s.taskMutex.Unlock()
+			return err
 		}
+		delete(s.pausedTasks, jobID)
+		s.queuedTasks[jobID] = task
+		s.taskMutex.Unlock()
+		s.updateJobStatus(jobID, domain.Queued)
+		s.appendLog(jobID, "Paused job returned to the queue")
+		return nil
+	}
+
+	task, active := s.activeTasks[jobID]
+	if !active {
+		s.taskMutex.Unlock()
+		return s.untrackedJob(jobID, fmt.Errorf("job %s is not paused", jobID))
+	}
+	if task.pausePending {
+		task.pausePending = false
+		s.taskMutex.Unlock()
+		s.appendLog(jobID, "Pending pause withdrawn")
+		return nil
+	}
+	if err := task.Status.ValidateTransition(domain.Running); err != nil {
+		s.taskMutex.Unlock()
+		return err
+	}
+	if err := resumeProcessGroup(task.process); err != nil {
+		s.taskMutex.Unlock()
+		return fmt.Errorf("failed to resume job %s: %w", jobID, err)
+	}
+	task.Status = domain.Running
+	s.taskMutex.Unlock()
 
-		s.updateProgress(task)
-		time.Sleep(2 * time.Second)
+	s.updateJobStatus(jobID, task.Status)
+	s.appendLog(jobID, "Running job resumed")
+	return nil
+}
+
+// restorePausedJobs reloads jobs recorded as paused so they survive a restart
+func (s *transcodingServiceImpl) restorePausedJobs() {
+	jobs, err := s.repo.GetJobsByStatus(domain.Paused)
+	if err != nil {
+		log.Printf("Failed to load paused jobs: %v", err)
+		return
+	}
+
+	tasks := make([]*TranscodingTask, 0, len(jobs))
+	for _, job := range jobs {
+		tasks = append(tasks, taskFromJob(job, domain.Paused, s.loadRenditions(job)))
+	}
+
+	s.taskMutex.Lock()
+	defer s.taskMutex.Unlock()
+	for _, task := range tasks {
+		s.pausedTasks[task.ID] = task
+	}
+	if len(jobs) > 0 {
+		log.Printf("Restored %d paused jobs", len(jobs))
+	}
+}
+
+// recoverInterruptedJobs re-queues work that was waiting or running when the previous process stopped
+func (s *transcodingServiceImpl) recoverInterruptedJobs() {
+	var pending []repositories.TranscodingJob
+	for _, status := range []domain.TranscodingStatus{domain.Queued, domain.Retrying} {
+		jobs, err := s.repo.GetJobsByStatus(status)
+		if err != nil {
+			log.Printf("Failed to load %s jobs: %v", status, err)
+			return
+		}
+		pending = append(pending, jobs...)
+	}
+	running, err := s.repo.GetJobsByStatus(domain.Running)
+	if err != nil {
+		log.Printf("Failed to load running jobs: %v", err)
+		return
+	}
+
+	for _, job := range running {
+		removeUnfinishedRenditions(domain.VideoFormat(job.OutputFormat), s.loadRenditions(job))
+		removeArtifacts(job.JobType, job.OutputFile)
+		if job.Attempts > s.maxRetries {
+			s.finishJob(job.JobID, domain.Failed, fmt.Sprintf("interrupted by a service restart after %d attempts", job.Attempts))
+			s.appendLog(job.JobID, "Job was running during a restart and has no retries left")
+			continue
+		}
+		if err := s.repo.UpdateJobStatus(job.JobID, domain.Retrying); err != nil {
+			log.Printf("Failed to mark job %s for retry: %v", job.JobID, err)
+			continue
+		}
+		s.appendLog(job.JobID, "Job was running during a restart, re-queuing")
+		job.Status = domain.Retrying
+		pending = append(pending, job)
+	}
+
+	for _, job := range pending {
+		task := taskFromJob(job, job.Status, s.loadRenditions(job))
+		queue := s.AddTask
+		if job.Status == domain.Retrying {
+			queue = s.queueRetry
+		}
+		if err := queue(task); err != nil {
+			s.finishJob(job.JobID, domain.Failed, err.Error())
+		}
+	}
+	if len(pending) > 0 {
+		log.Printf("Re-queued %d interrupted jobs", len(pending))
+	}
+}
+
+// CheckHealth reports the worker pool state and whether ffmpeg is available
+func (s *transcodingServiceImpl) CheckHealth() HealthStatus {
+	_, err := exec.LookPath("ffmpeg")
+
+	s.taskMutex.Lock()
+	queued := len(s.queuedTasks)
+	paused := len(s.pausedTasks)
+	active := len(s.activeTasks)
+	s.taskMutex.Unlock()
+	if s.brokered {
+		queued = s.taskQueue.Len()
+	}
+
+	health := HealthStatus{
+		Status:     "ok",
+		FFmpeg:     err == nil,
+		QueuedJobs: queued,
+		PausedJobs: paused,
+		ActiveJobs: active,
+		Workers:    s.maxConcurrent,
+	}
+	if !health.FFmpeg {
+		health.Status = "degraded"
 	}
+	return health
 }
 
-// updateProgress updates the task progress periodically
-func (s *TranscodingService) updateProgress(task *TranscodingTask) {
-	task.Progress += 10.0
-	if task.Progress > 100.0 {
-		task.Progress = 100.0
+// jobStatus builds the API view of a job, preferring the live task when one is running
+func (s *transcodingServiceImpl) jobStatus(job repositories.TranscodingJob) *JobStatus {
+	status := &JobStatus{
+		JobID:        job.JobID,
+		Type:         job.JobType,
+		VideoID:      job.VideoID,
+		OutputFormat: job.OutputFormat,
+		VideoCodec:   job.VideoCodec,
+		AudioCodec:   job.AudioCodec,
+		Profile:      job.Profile,
+		Pad:          job.Pad,
+		AutoCrop:     job.AutoCrop,
+		Resolution:   job.Resolution,
+		Priority:     job.Priority,
+		Status:       job.Status,
+		Progress:     job.Progress,
+		Error:        job.ErrorMessage,
+		Attempts:     job.Attempts,
+		StartedAt:    job.StartedAt,
+		FinishedAt:   job.FinishedAt,
+		CreatedAt:    job.CreatedAt,
+		UpdatedAt:    job.UpdatedAt,
+		WorkerID:     job.WorkerID,
+		LeaseExpires: job.LeaseExpiresAt,
 	}
-	log.Printf("Progress updated for task %s: %.2f%%", task.ID, task.Progress)
+	if domain.VideoFormat(job.OutputFormat).IsStreaming() && job.Status == domain.Completed {
+		status.ManifestFile = s.publicLocation(job, job.OutputFile)
+	}
+	options := jobOptions(job)
+	status.Trickplay, status.Poster = options.Trickplay, options.Poster
+	if job.OutputMetadata.Valid {
+		var metadata domain.OutputMetadata
+		if err := json.Unmarshal([]byte(job.OutputMetadata.String), &metadata); err != nil {
+			log.Printf("Ignoring unreadable output metadata of job %s: %v", job.JobID, err)
+		} else {
+			status.Metadata = &metadata
+		}
+	}
+
+	s.taskMutex.Lock()
+	defer s.taskMutex.Unlock()
+	if task, ok := s.queuedTasks[job.JobID]; ok {
+		status.Priority = task.Priority
+	} else if task, ok := s.pausedTasks[job.JobID]; ok {
+		status.Priority = task.Priority
+	} else if task, ok := s.activeTasks[job.JobID]; ok {
+		startedAt := task.StartedAt
+		status.Status = task.Status
+		status.Progress = task.Progress
+		status.FPS = task.FPS
+		status.Speed = task.Speed
+		status.ETASeconds = task.ETA.Seconds()
+		status.StartedAt = &startedAt
+		if task.Error != nil {
+			status.Error = task.Error.Error()
+		}
+	}
+	return status
+}
+
+// updateJobStatus writes a task status to the repository, logging failures
+func (s *transcodingServiceImpl) updateJobStatus(jobID string, status domain.TranscodingStatus) {
+	if err := s.repo.UpdateJobStatus(jobID, status); err != nil {
+		log.Printf("Failed to persist status %s for job %s: %v", status, jobID, err)
+	}
+}
+
+// finishJob writes a terminal task status to the repository unless one is already recorded
+func (s *transcodingServiceImpl) finishJob(jobID string, status domain.TranscodingStatus, errorMessage string) {
+	err := s.repo.MarkJobFinished(jobID, status, errorMessage)
+	var transitionErr *domain.TransitionError
+	if errors.As(err, &transitionErr) {
+		// Another instance or request finished the job first, and its outcome stands
+		log.Printf("Keeping recorded status %s for job %s instead of %s", transitionErr.From, jobID, status)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to persist status %s for job %s: %v", status, jobID, err)
+	}
+}
+
+// updateRendition writes a rendition status to the repository, logging failures
+func (s *transcodingServiceImpl) updateRendition(jobID string, position int, status domain.RenditionStatus, errorMessage string) {
+	if err := s.repo.UpdateRendition(jobID, position, status, errorMessage); err != nil {
+		log.Printf("Failed to persist rendition %d status %s for job %s: %v", position, status, jobID, err)
+	}
+}
+
+// loadRenditions reads the recorded renditions of a job, or the single output of a job that predates them
+func (s *transcodingServiceImpl) loadRenditions(job repositories.TranscodingJob) []domain.Rendition {
+	if job.JobType != domain.TranscodeJob {
+		return nil
+	}
+	videoCodec, audioCodec := domain.DefaultCodecs(domain.VideoFormat(job.OutputFormat))
+	if job.VideoCodec != "" {
+		videoCodec = domain.VideoCodec(job.VideoCodec)
+	}
+	if job.AudioCodec != "" {
+		audioCodec = domain.AudioCodec(job.AudioCodec)
+	}
+
+	records, err := s.repo.GetRenditions(job.JobID)
+	if err != nil || len(records) == 0 {
+		status := domain.RenditionQueued
+		if job.Status == domain.Completed {
+			status = domain.RenditionCompleted
+		}
+		return []domain.Rendition{{
+			Resolution: domain.Resolution(job.Resolution),
+			VideoCodec: videoCodec,
+			AudioCodec: audioCodec,
+			OutputFile: job.OutputFile,
+			Status:     status,
+		}}
+	}
+
+	renditions := make([]domain.Rendition, 0, len(records))
+	for _, record := range records {
+		renditions = append(renditions, domain.Rendition{
+			Resolution: domain.Resolution(record.Resolution),
+			Bitrate:    record.Bitrate,
+			VideoCodec: videoCodec,
+			AudioCodec: audioCodec,
+			OutputFile: record.OutputFile,
+			Status:     record.Status,
+			Error:      record.ErrorMessage,
+		})
+	}
+	return renditions
+}
+
+// appendLog records a line against a job in the repository and mirrors it to the process log
+func (s *transcodingServiceImpl) appendLog(jobID, format string, args ...interface{}) {
+	line := fmt.Sprintf(format, args...)
+	log.Printf("[%s] %s", jobID, line)
+
+	if err := s.repo.AppendJobLog(jobID, line); err != nil {
+		log.Printf("Failed to persist log line for job %s: %v", jobID, err)
+	}
+}
+
+// taskFromJob rebuilds a task from its repository record and recorded renditions
+func taskFromJob(job repositories.TranscodingJob, status domain.TranscodingStatus, renditions []domain.Rendition) *TranscodingTask {
+	options := jobOptions(job)
+	return &TranscodingTask{
+		ID:         job.JobID,
+		Type:       job.JobType,
+		VideoID:    job.VideoID,
+		InputFile:  job.InputFile,
+		OutputFile: job.OutputFile,
+		Format:     domain.VideoFormat(job.OutputFormat),
+		Resolution: domain.Resolution(job.Resolution),
+		Profile:    job.Profile,
+		Pad:        job.Pad,
+		AutoCrop:   job.AutoCrop,
+		Renditions: renditions,
+		Trickplay:  options.Trickplay,
+		Poster:     options.Poster,
+		Subtitles:  options.Subtitles,
+		Audio:      options.Audio,
+		TwoPass:    options.TwoPass,
+		Remote:     options.Remote,
+		Priority:   job.Priority,
+		Status:     status,
+	}
+}
+
+// jobOptions decodes the settings recorded for a job's type
+func jobOptions(job repositories.TranscodingJob) domain.JobOptions {
+	var options domain.JobOptions
+	if job.Options.Valid {
+		if err := json.Unmarshal([]byte(job.Options.String), &options); err != nil {
+			log.Printf("Ignoring unreadable options of job %s: %v", job.JobID, err)
+		}
+	}
+	return options
+}
+
+// setStatus moves the task to next if the state machine allows it; the caller must hold the task mutex
+func (t *TranscodingTask) setStatus(next domain.TranscodingStatus) error {
+	if err := t.Status.ValidateTransition(next); err != nil {
+		return fmt.Errorf("task %s: %w", t.ID, err)
+	}
+	t.Status = next
+	return nil
 }
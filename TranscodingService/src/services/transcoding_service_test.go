@@ -0,0 +1,634 @@
+package services
+
+import (
+	"TranscodingService/src/config"
+	"TranscodingService/src/domain"
+	"TranscodingService/src/repositories"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"testing"
+	"time"
+)
+
+// fakeRepo keeps jobs in memory; methods the tests do not need panic through the nil interface
+type fakeRepo struct {
+	repositories.TranscodingRepository
+	jobs       map[string]repositories.TranscodingJob
+	renditions map[string][]repositories.TranscodingRendition
+	logs       map[string][]string
+	created    []repositories.TranscodingJobInput
+}
+
+func newFakeRepo(jobs ...repositories.TranscodingJob) *fakeRepo {
+	repo := &fakeRepo{
+		jobs:       make(map[string]repositories.TranscodingJob),
+		renditions: make(map[string][]repositories.TranscodingRendition),
+		logs:       make(map[string][]string),
+	}
+	for _, job := range jobs {
+		repo.jobs[job.JobID] = job
+	}
+	return repo
+}
+
+func (r *fakeRepo) CreateJob(input repositories.TranscodingJobInput) (string, error) {
+	jobID := input.JobID
+	if jobID == "" {
+		jobID = fmt.Sprintf("job-%d", len(r.created)+1)
+	}
+	r.created = append(r.created, input)
+	r.jobs[jobID] = repositories.TranscodingJob{JobID: jobID, JobType: input.JobType, VideoID: input.VideoID, InputFile: input.InputFile, OutputFile: input.OutputFile, Status: domain.Queued, EnqueuedAt: time.Now()}
+	for i, rendition := range input.Renditions {
+		r.renditions[jobID] = append(r.renditions[jobID], repositories.TranscodingRendition{
+			JobID:      jobID,
+			Position:   i,
+			Resolution: string(rendition.Resolution),
+			Bitrate:    rendition.Bitrate,
+			OutputFile: rendition.OutputFile,
+			Status:     domain.RenditionQueued,
+		})
+	}
+	return jobID, nil
+}
+
+func (r *fakeRepo) GetJobStatus(jobID string) (repositories.TranscodingJob, error) {
+	job, ok := r.jobs[jobID]
+	if !ok {
+		return repositories.TranscodingJob{}, fmt.Errorf("%w: %s", repositories.ErrJobNotFound, jobID)
+	}
+	return job, nil
+}
+
+func (r *fakeRepo) UpdateJobStatus(jobID string, status domain.TranscodingStatus) error {
+	job, ok := r.jobs[jobID]
+	if !ok {
+		return fmt.Errorf("%w: %s", repositories.ErrJobNotFound, jobID)
+	}
+	if err := job.Status.ValidateTransition(status); err != nil {
+		return err
+	}
+	job.Status = status
+	if status == domain.Queued || status == domain.Retrying {
+		job.EnqueuedAt = time.Now()
+	}
+	r.jobs[jobID] = job
+	return nil
+}
+
+func (r *fakeRepo) RetryJob(jobID string) error {
+	job, ok := r.jobs[jobID]
+	if !ok {
+		return fmt.Errorf("%w: %s", repositories.ErrJobNotFound, jobID)
+	}
+	if job.Status != domain.Failed {
+		return &domain.TransitionError{From: job.Status, To: domain.Retrying}
+	}
+	return r.UpdateJobStatus(jobID, domain.Retrying)
+}
+
+func (r *fakeRepo) UpdateJobPriority(jobID string, priority int) error {
+	job, ok := r.jobs[jobID]
+	if !ok {
+		return fmt.Errorf("%w: %s", repositories.ErrJobNotFound, jobID)
+	}
+	job.Priority = priority
+	r.jobs[jobID] = job
+	return nil
+}
+
+func (r *fakeRepo) GetJobsByStatus(status domain.TranscodingStatus) ([]repositories.TranscodingJob, error) {
+	var jobs []repositories.TranscodingJob
+	for _, job := range r.jobs {
+		if job.Status == status {
+			jobs = append(jobs, job)
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].JobID < jobs[j].JobID })
+	return jobs, nil
+}
+
+func (r *fakeRepo) GetJobsByVideoID(videoID string) ([]repositories.TranscodingJob, error) {
+	var jobs []repositories.TranscodingJob
+	for _, job := range r.jobs {
+		if job.VideoID == videoID {
+			jobs = append(jobs, job)
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].JobID < jobs[j].JobID })
+	return jobs, nil
+}
+
+func (r *fakeRepo) MarkJobStarted(jobID string, workerID string, lease time.Duration) error {
+	job := r.jobs[jobID]
+	if err := job.Status.ValidateTransition(domain.Running); err != nil {
+		return err
+	}
+	job.Status = domain.Running
+	job.WorkerID = workerID
+	job.Attempts++
+	r.jobs[jobID] = job
+	return nil
+}
+
+func (r *fakeRepo) UpdateJobProgress(jobID string, progress float64) error {
+	job := r.jobs[jobID]
+	job.Progress = progress
+	r.jobs[jobID] = job
+	return nil
+}
+
+func (r *fakeRepo) MarkJobFinished(jobID string, status domain.TranscodingStatus, errorMessage string) error {
+	job, ok := r.jobs[jobID]
+	if !ok {
+		return fmt.Errorf("%w: %s", repositories.ErrJobNotFound, jobID)
+	}
+	if err := job.Status.ValidateTransition(status); err != nil {
+		return err
+	}
+	job.Status = status
+	job.ErrorMessage = errorMessage
+	r.jobs[jobID] = job
+	return nil
+}
+
+func (r *fakeRepo) GetRenditions(jobID string) ([]repositories.TranscodingRendition, error) {
+	return r.renditions[jobID], nil
+}
+
+func (r *fakeRepo) UpdateRendition(jobID string, position int, status domain.RenditionStatus, errorMessage string) error {
+	renditions := r.renditions[jobID]
+	if position < 0 || position >= len(renditions) {
+		return fmt.Errorf("no rendition %d for job %s", position, jobID)
+	}
+	renditions[position].Status = status
+	renditions[position].ErrorMessage = errorMessage
+	return nil
+}
+
+func (r *fakeRepo) AppendJobLog(jobID string, message string) error {
+	r.logs[jobID] = append(r.logs[jobID], message)
+	return nil
+}
+
+func (r *fakeRepo) GetJobLogs(jobID string) ([]string, error) {
+	return r.logs[jobID], nil
+}
+
+// newTestService returns a service over repo whose queue holds queueSize tasks and is not being worked
+func newTestService(repo repositories.TranscodingRepository, queueSize int) *transcodingServiceImpl {
+	cfg := &config.Config{
+		Transcoding: config.TranscodingConfig{QueueSize: queueSize, MaxConcurrentJobs: 1},
+		RetryPolicy: config.RetryPolicyConfig{MaxRetries: 2},
+	}
+	s := NewTranscodingService(repo, cfg).(*transcodingServiceImpl)
+	s.capabilities.caps = fullCapabilities()
+	return s
+}
+
+// probedMovie is what ffprobe reports for the one-minute 1080p test input
+const probedMovie = `{"streams":[{"index":0,"codec_type":"video","codec_name":"h264","width":1920,"height":1080,"avg_frame_rate":"24/1"},` +
+	`{"index":1,"codec_type":"audio","codec_name":"aac","channels":2,"tags":{"language":"en"}}],` +
+	`"format":{"format_name":"mov,mp4,m4a,3gp,3g2,mj2","duration":"60.000000"}}`
+
+// fakeFFprobe puts an ffprobe on PATH that prints output, or fails like ffprobe on a corrupt file when output is empty
+func fakeFFprobe(t *testing.T, output string) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake ffprobe is a shell script")
+	}
+	script := "#!/bin/sh\necho 'Invalid data found when processing input' >&2\nexit 1\n"
+	if output != "" {
+		script = "#!/bin/sh\ncat <<'EOF'\n" + output + "\nEOF\n"
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "ffprobe"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+// newTestInput creates an input file that the fake ffprobe reports as probedMovie
+func newTestInput(t *testing.T) string {
+	fakeFFprobe(t, probedMovie)
+	input := filepath.Join(t.TempDir(), "movie.mov")
+	if err := os.WriteFile(input, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return input
+}
+
+func TestTranscodeQueuesJob(t *testing.T) {
+	repo := newFakeRepo()
+	s := newTestService(repo, 1)
+	input := newTestInput(t)
+
+	result, err := s.Transcode(domain.TranscodingRequest{VideoID: "v1", InputFile: input, OutputFile: "/out/movie", TargetFormat: domain.MP4, TargetResolution: domain.HD})
+	if err != nil {
+		t.Fatalf("Transcode() = %v", err)
+	}
+	if result.Status != domain.Queued {
+		t.Errorf("status = %s, want Queued", result.Status)
+	}
+	want := repositories.TranscodingJobInput{
+		JobID: result.JobID, VideoID: "v1", InputFormat: "mov", OutputFormat: "mp4", VideoCodec: "h264", AudioCodec: "aac",
+		InputFile: input, OutputFile: "/out/movie.mp4", Resolution: "720p",
+		Renditions: []domain.Rendition{{Resolution: domain.HD, VideoCodec: domain.H264, AudioCodec: domain.AAC, OutputFile: "/out/movie.mp4", Status: domain.RenditionQueued}},
+	}
+	if len(repo.created) != 1 || !reflect.DeepEqual(repo.created[0], want) {
+		t.Errorf("created jobs = %+v, want %+v", repo.created, want)
+	}
+	if s.taskQueue.Len() != 1 {
+		t.Errorf("queued tasks = %d, want 1", s.taskQueue.Len())
+	}
+}
+
+func TestTranscodeQueueFull(t *testing.T) {
+	repo := newFakeRepo()
+	s := newTestService(repo, 0)
+
+	_, err := s.Transcode(domain.TranscodingRequest{VideoID: "v1", InputFile: newTestInput(t), OutputFile: "/out/movie", TargetFormat: domain.MP4, TargetResolution: domain.HD})
+	if !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("Transcode() = %v, want %v", err, ErrQueueFull)
+	}
+	if len(repo.created) != 1 {
+		t.Fatalf("created %d jobs, want 1", len(repo.created))
+	}
+	if got := repo.jobs[repo.created[0].JobID].Status; got != domain.Failed {
+		t.Errorf("recorded status = %s, want failed", got)
+	}
+}
+
+func TestTranscodeChecksCodecs(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  domain.VideoFormat
+		video   domain.VideoCodec
+		audio   domain.AudioCodec
+		wantErr bool
+	}{
+		{name: "vp9 and opus in webm", format: domain.WebM, video: domain.VP9, audio: domain.Opus},
+		{name: "hevc in mp4", format: domain.MP4, video: domain.H265},
+		{name: "vp9 in mp4", format: domain.MP4, video: domain.VP9, wantErr: true},
+		{name: "aac in webm", format: domain.WebM, audio: domain.AAC, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newFakeRepo()
+			s := newTestService(repo, 1)
+
+			_, err := s.Transcode(domain.TranscodingRequest{VideoID: "v1", InputFile: newTestInput(t), OutputFile: "/out/movie", TargetFormat: tt.format, TargetResolution: domain.HD, VideoCodec: tt.video, AudioCodec: tt.audio})
+			if tt.wantErr {
+				if !errors.Is(err, domain.ErrUnsupportedCodec) {
+					t.Fatalf("Transcode() = %v, want %v", err, domain.ErrUnsupportedCodec)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Transcode() = %v", err)
+			}
+			video, audio := domain.DefaultCodecs(tt.format)
+			if tt.video != "" {
+				video = tt.video
+			}
+			if tt.audio != "" {
+				audio = tt.audio
+			}
+			if got := repo.created[0]; got.VideoCodec != string(video) || got.AudioCodec != string(audio) {
+				t.Errorf("recorded codecs = %s, %s, want %s, %s", got.VideoCodec, got.AudioCodec, video, audio)
+			}
+		})
+	}
+}
+
+func TestTranscodeRejectsUnusableInput(t *testing.T) {
+	tests := []struct {
+		name  string
+		probe string
+	}{
+		{name: "unreadable", probe: ""},
+		{name: "no video stream", probe: `{"streams":[{"index":0,"codec_type":"audio","codec_name":"aac"}],"format":{"duration":"60"}}`},
+		{name: "no duration", probe: `{"streams":[{"index":0,"codec_type":"video","codec_name":"h264","width":1920,"height":1080}],"format":{}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newFakeRepo()
+			s := newTestService(repo, 1)
+			input := newTestInput(t)
+			fakeFFprobe(t, tt.probe)
+
+			_, err := s.Transcode(domain.TranscodingRequest{VideoID: "v1", InputFile: input, OutputFile: "/out/movie", TargetFormat: domain.MP4, TargetResolution: domain.HD})
+			if !errors.Is(err, domain.ErrInvalidMedia) {
+				t.Fatalf("Transcode() = %v, want %v", err, domain.ErrInvalidMedia)
+			}
+			if len(repo.created) != 0 || s.taskQueue.Len() != 0 {
+				t.Errorf("rejected input left %d jobs and %d queued tasks", len(repo.created), s.taskQueue.Len())
+			}
+		})
+	}
+}
+
+func TestResubmitJob(t *testing.T) {
+	tests := []struct {
+		status     domain.TranscodingStatus
+		wantErr    bool
+		wantStatus domain.TranscodingStatus
+	}{
+		{status: domain.Failed, wantStatus: domain.Retrying},
+		{status: domain.Completed, wantErr: true, wantStatus: domain.Completed},
+		{status: domain.Queued, wantErr: true, wantStatus: domain.Queued},
+		{status: domain.Running, wantErr: true, wantStatus: domain.Running},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.status), func(t *testing.T) {
+			repo := newFakeRepo(repositories.TranscodingJob{JobID: "job-1", OutputFormat: "mp4", Status: tt.status})
+			s := newTestService(repo, 1)
+
+			err := s.ResubmitJob("job-1")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ResubmitJob() = %v, want error %v", err, tt.wantErr)
+			}
+			if got := repo.jobs["job-1"].Status; got != tt.wantStatus {
+				t.Errorf("recorded status = %s, want %s", got, tt.wantStatus)
+			}
+			if wantQueued := !tt.wantErr; (s.taskQueue.Len() == 1) != wantQueued {
+				t.Errorf("queued tasks = %d, want queued %v", s.taskQueue.Len(), wantQueued)
+			}
+		})
+	}
+}
+
+func TestResubmitJobWaitsRetryDelay(t *testing.T) {
+	repo := newFakeRepo(
+		repositories.TranscodingJob{JobID: "job-1", OutputFormat: "mp4", Status: domain.Failed},
+		repositories.TranscodingJob{JobID: "job-2", OutputFormat: "mp4", Status: domain.Failed},
+	)
+	s := newTestService(repo, 2)
+	s.retryDelay = 50 * time.Millisecond
+
+	for _, jobID := range []string{"job-1", "job-2"} {
+		if err := s.ResubmitJob(jobID); err != nil {
+			t.Fatalf("ResubmitJob(%s) = %v", jobID, err)
+		}
+	}
+	if s.taskQueue.Len() != 0 {
+		t.Fatalf("queued tasks = %d before the retry delay, want 0", s.taskQueue.Len())
+	}
+	if err := s.CancelJob("job-2"); err != nil {
+		t.Fatalf("CancelJob() of a retry waiting out its delay = %v", err)
+	}
+
+	time.Sleep(4 * s.retryDelay)
+	if got := popIDs(s.taskQueue.(*priorityQueue)); !reflect.DeepEqual(got, []string{"job-1"}) {
+		t.Errorf("queued jobs after the retry delay = %v, want [job-1]", got)
+	}
+	if got := repo.jobs["job-2"].Status; got != domain.Cancelled {
+		t.Errorf("cancelled retry status = %s, want %s", got, domain.Cancelled)
+	}
+}
+
+func TestGetStatusOverlaysActiveTask(t *testing.T) {
+	repo := newFakeRepo(repositories.TranscodingJob{JobID: "job-1", Status: domain.Running}, repositories.TranscodingJob{JobID: "job-2", Status: domain.Completed, Progress: 100})
+	s := newTestService(repo, 1)
+	s.activeTasks["job-1"] = &TranscodingTask{ID: "job-1", Status: domain.Running, Progress: 42}
+
+	tests := []struct {
+		jobID        string
+		wantStatus   domain.TranscodingStatus
+		wantProgress float64
+	}{
+		{jobID: "job-1", wantStatus: domain.Running, wantProgress: 42},
+		{jobID: "job-2", wantStatus: domain.Completed, wantProgress: 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.jobID, func(t *testing.T) {
+			status, err := s.GetStatus(tt.jobID)
+			if err != nil {
+				t.Fatalf("GetStatus() = %v", err)
+			}
+			if status.Status != tt.wantStatus || status.Progress != tt.wantProgress {
+				t.Errorf("GetStatus() = %s at %.0f%%, want %s at %.0f%%", status.Status, status.Progress, tt.wantStatus, tt.wantProgress)
+			}
+		})
+	}
+	if _, err := s.GetStatus("missing"); err == nil {
+		t.Error("GetStatus() of an unknown job succeeded")
+	}
+}
+
+func TestCancelQueuedTask(t *testing.T) {
+	repo := newFakeRepo(repositories.TranscodingJob{JobID: "job-1", Status: domain.Queued})
+	s := newTestService(repo, 1)
+	if err := s.AddTask(&TranscodingTask{ID: "job-1", Status: domain.Queued}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.CancelJob("job-1"); err != nil {
+		t.Fatalf("CancelJob() = %v", err)
+	}
+	if s.taskQueue.Len() != 0 {
+		t.Error("cancelled task is still queued")
+	}
+	if got := repo.jobs["job-1"].Status; got != domain.Cancelled {
+		t.Errorf("recorded status = %s, want cancelled", got)
+	}
+}
+
+func TestCancelRunningTask(t *testing.T) {
+	repo := newFakeRepo(repositories.TranscodingJob{JobID: "job-1", Status: domain.Running})
+	s := newTestService(repo, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	s.activeTasks["job-1"] = &TranscodingTask{ID: "job-1", Status: domain.Running, cancel: cancel}
+
+	if err := s.CancelJob("job-1"); err != nil {
+		t.Fatalf("CancelJob() = %v", err)
+	}
+	if ctx.Err() == nil {
+		t.Error("running task's context was not cancelled")
+	}
+	if err := s.CancelJob("missing"); err == nil {
+		t.Error("CancelJob() of an unknown job succeeded")
+	}
+}
+
+func TestUpdatePriority(t *testing.T) {
+	repo := newFakeRepo(repositories.TranscodingJob{JobID: "job-1", Status: domain.Queued}, repositories.TranscodingJob{JobID: "job-2", Status: domain.Queued})
+	s := newTestService(repo, 2)
+	for _, id := range []string{"job-1", "job-2"} {
+		if err := s.AddTask(&TranscodingTask{ID: id, Status: domain.Queued}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := s.UpdatePriority("job-2", 5); err != nil {
+		t.Fatalf("UpdatePriority() = %v", err)
+	}
+	if got := repo.jobs["job-2"].Priority; got != 5 {
+		t.Errorf("recorded priority = %d, want 5", got)
+	}
+	if got := popIDs(s.taskQueue.(*priorityQueue)); !reflect.DeepEqual(got, []string{"job-2", "job-1"}) {
+		t.Errorf("pop order = %v, want [job-2 job-1]", got)
+	}
+	if _, started := s.startTask(s.queuedTasks["job-1"]); !started {
+		t.Fatal("startTask() = false, want job-1 started")
+	}
+	if err := s.UpdatePriority("job-1", 5); err == nil {
+		t.Error("UpdatePriority() of a job no longer queued succeeded")
+	}
+}
+
+func TestPauseResumeQueuedJob(t *testing.T) {
+	repo := newFakeRepo(repositories.TranscodingJob{JobID: "job-1", Status: domain.Queued})
+	s := newTestService(repo, 1)
+	if err := s.AddTask(&TranscodingTask{ID: "job-1", Status: domain.Queued}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.PauseJob("job-1"); err != nil {
+		t.Fatalf("PauseJob() = %v", err)
+	}
+	if got := repo.jobs["job-1"].Status; got != domain.Paused || s.taskQueue.Len() != 0 {
+		t.Errorf("after PauseJob() status = %s with %d queued, want paused with none", got, s.taskQueue.Len())
+	}
+	if err := s.PauseJob("job-1"); err == nil {
+		t.Error("PauseJob() of a paused job succeeded")
+	}
+
+	if err := s.ResumeJob("job-1"); err != nil {
+		t.Fatalf("ResumeJob() = %v", err)
+	}
+	if got := repo.jobs["job-1"].Status; got != domain.Queued || s.taskQueue.Len() != 1 {
+		t.Errorf("after ResumeJob() status = %s with %d queued, want queued with 1", got, s.taskQueue.Len())
+	}
+	if err := s.ResumeJob("job-1"); err == nil {
+		t.Error("ResumeJob() of a queued job succeeded")
+	}
+}
+
+func TestCancelPausedJob(t *testing.T) {
+	repo := newFakeRepo(repositories.TranscodingJob{JobID: "job-1", Status: domain.Queued})
+	s := newTestService(repo, 1)
+	if err := s.AddTask(&TranscodingTask{ID: "job-1", Status: domain.Queued}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.PauseJob("job-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.CancelJob("job-1"); err != nil {
+		t.Fatalf("CancelJob() = %v", err)
+	}
+	if err := s.ResumeJob("job-1"); err == nil {
+		t.Error("ResumeJob() of a cancelled job succeeded")
+	}
+	if got := repo.jobs["job-1"].Status; got != domain.Cancelled {
+		t.Errorf("recorded status = %s, want cancelled", got)
+	}
+}
+
+func TestJobActionsOnUnknownJob(t *testing.T) {
+	repo := newFakeRepo(repositories.TranscodingJob{JobID: "job-1", Status: domain.Completed})
+	s := newTestService(repo, 1)
+
+	actions := map[string]func(jobID string) error{
+		"CancelJob":      s.CancelJob,
+		"PauseJob":       s.PauseJob,
+		"ResumeJob":      s.ResumeJob,
+		"UpdatePriority": func(jobID string) error { return s.UpdatePriority(jobID, 5) },
+		"ResubmitJob":    s.ResubmitJob,
+		"GetStatus": func(jobID string) error {
+			_, err := s.GetStatus(jobID)
+			return err
+		},
+		"GetJobLogs": func(jobID string) error {
+			_, err := s.GetJobLogs(jobID)
+			return err
+		},
+	}
+	for name, action := range actions {
+		t.Run(name, func(t *testing.T) {
+			if err := action("job-2"); !errors.Is(err, repositories.ErrJobNotFound) {
+				t.Errorf("%s() of an unknown job = %v, want %v", name, err, repositories.ErrJobNotFound)
+			}
+			if err := action("job-1"); errors.Is(err, repositories.ErrJobNotFound) {
+				t.Errorf("%s() of a completed job = %v, want it found", name, err)
+			}
+		})
+	}
+}
+
+func TestRecoverInterruptedJobs(t *testing.T) {
+	repo := newFakeRepo(
+		repositories.TranscodingJob{JobID: "waiting", Status: domain.Queued},
+		repositories.TranscodingJob{JobID: "interrupted", Status: domain.Running, Attempts: 2},
+		repositories.TranscodingJob{JobID: "exhausted", Status: domain.Running, Attempts: 3},
+		repositories.TranscodingJob{JobID: "done", Status: domain.Completed},
+	)
+	s := newTestService(repo, 4)
+
+	s.recoverInterruptedJobs()
+
+	want := map[string]domain.TranscodingStatus{"waiting": domain.Queued, "interrupted": domain.Retrying, "exhausted": domain.Failed, "done": domain.Completed}
+	for jobID, status := range want {
+		if got := repo.jobs[jobID].Status; got != status {
+			t.Errorf("job %s status = %s, want %s", jobID, got, status)
+		}
+	}
+	if got := popIDs(s.taskQueue.(*priorityQueue)); !reflect.DeepEqual(got, []string{"waiting", "interrupted"}) {
+		t.Errorf("queued jobs = %v, want [waiting interrupted]", got)
+	}
+	if repo.jobs["exhausted"].ErrorMessage == "" {
+		t.Error("exhausted job failed without a reason")
+	}
+}
+
+func TestCompleteTaskRecordsOutcome(t *testing.T) {
+	tests := []struct {
+		name       string
+		stored     domain.TranscodingStatus
+		task       TranscodingTask
+		wantStatus domain.TranscodingStatus
+		wantError  string
+	}{
+		{name: "completed", task: TranscodingTask{Status: domain.Completed}, wantStatus: domain.Completed},
+		{name: "cancelled elsewhere first", stored: domain.Cancelled, task: TranscodingTask{Status: domain.Completed}, wantStatus: domain.Cancelled},
+		{name: "failed", task: TranscodingTask{Status: domain.Failed, Error: errors.New("exit status 1")}, wantStatus: domain.Failed, wantError: "exit status 1"},
+		{name: "cancelled", task: TranscodingTask{Status: domain.Cancelled}, wantStatus: domain.Cancelled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stored := tt.stored
+			if stored == "" {
+				stored = domain.Running
+			}
+			repo := newFakeRepo(repositories.TranscodingJob{JobID: "job-1", Status: stored})
+			s := newTestService(repo, 1)
+			task := tt.task
+			task.ID = "job-1"
+			task.cancel = func() {}
+			s.activeTasks["job-1"] = &task
+
+			s.completeTask(&task)
+
+			job := repo.jobs["job-1"]
+			if job.Status != tt.wantStatus || job.ErrorMessage != tt.wantError {
+				t.Errorf("recorded %s (%q), want %s (%q)", job.Status, job.ErrorMessage, tt.wantStatus, tt.wantError)
+			}
+			if _, active := s.activeTasks["job-1"]; active {
+				t.Error("finished task is still active")
+			}
+			if logs, _ := s.GetJobLogs("job-1"); len(logs) == 0 {
+				t.Error("no log line recorded for the finished task")
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package services
+
+import (
+	"TranscodingService/src/domain"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// runTrickplay tiles thumbnails of the input into sprite sheets and writes the WebVTT track mapping them
+func (s *transcodingServiceImpl) runTrickplay(ctx context.Context, task *TranscodingTask) error {
+	if task.Trickplay == nil {
+		return errors.New("trickplay job has no recorded options")
+	}
+	media, err := probeMedia(ctx, task.InputFile)
+	if err != nil {
+		return fmt.Errorf("trickplay thumbnails need the source duration and frame size: %v", err)
+	}
+	var width, height int
+	if video := media.VideoStream(); video != nil {
+		width, height = video.Width, video.Height
+	}
+	plan, err := domain.PlanTrickplay(*task.Trickplay, width, height, media.Duration())
+	if err != nil {
+		return err
+	}
+
+	s.taskMutex.Lock()
+	task.Duration = plan.Duration
+	task.encodeIndex, task.encodeCount = 0, 1
+	s.taskMutex.Unlock()
+
+	// Sheets left by an earlier attempt with other settings would end up in the track
+	removeArtifacts(task.Type, task.OutputFile)
+	if err := os.MkdirAll(task.OutputFile, 0755); err != nil {
+		return fmt.Errorf("failed to create trickplay directory: %v", err)
+	}
+	args, err := domain.NewTrickplayCommand(s.paths, task.InputFile, task.OutputFile, plan).
+		Global("-nostats", "-progress", "pipe:1").
+		Build()
+	if err != nil {
+		return err
+	}
+
+	onStart, onProgress := s.progressReporter(task)
+	output, err := runCommand(ctx, exec.Command("ffmpeg", args...), onStart, onProgress)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		s.appendLog(task.ID, "Thumbnail extraction error: %v\nOutput: %s", err, string(output))
+		return fmt.Errorf("thumbnail extraction failed: %v", err)
+	}
+
+	sprites, err := domain.TrickplaySprites(task.OutputFile)
+	if err != nil {
+		return err
+	}
+	track, err := domain.WriteTrickplayTrack(task.OutputFile, plan, sprites)
+	if err != nil {
+		return err
+	}
+
+	s.saveMetadata(task.ID, domain.OutputMetadata{
+		SourceWidth:  width,
+		SourceHeight: height,
+		Trickplay: &domain.TrickplayArtifacts{
+			TrackFile:       track,
+			Sprites:         sprites,
+			IntervalSeconds: plan.IntervalSeconds,
+			Columns:         plan.Columns,
+			Rows:            plan.Rows,
+			Width:           plan.Width,
+			Height:          plan.Height,
+			Thumbnails:      plan.Held(len(sprites)),
+		},
+	})
+	s.appendLog(task.ID, "Wrote %d thumbnails in %d sprite sheets, track %s", plan.Held(len(sprites)), len(sprites), track)
+	return nil
+}
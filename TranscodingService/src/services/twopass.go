@@ -0,0 +1,58 @@
+package services
+
+import (
+	"TranscodingService/src/domain"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// encodeTwoPass encodes a rendition in two passes, removing the pass log once it is done
+func (s *transcodingServiceImpl) encodeTwoPass(ctx context.Context, task *TranscodingTask, rendition domain.Rendition) error {
+	logFile := rendition.TwoPass.LogFile
+	if err := os.MkdirAll(filepath.Dir(logFile), 0755); err != nil {
+		return fmt.Errorf("failed to create job workspace: %v", err)
+	}
+	defer removePassLogs(logFile)
+
+	args, err := domain.NewFirstPassCommand(s.paths, task.Format, task.InputFile, rendition.Pass(1)).
+		Global("-nostats", "-progress", "pipe:1").
+		Build()
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command("ffmpeg", args...)
+	onStart, onProgress := s.progressReporter(task)
+	output, err := runCommand(ctx, cmd, onStart, onProgress)
+	s.recordUsage(task, cmd)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		s.appendLog(task.ID, "First pass of %s rendition failed: %v\nOutput: %s", rendition.Resolution, err, string(output))
+		return fmt.Errorf("first pass of %s rendition failed: %v", rendition.Resolution, err)
+	}
+	s.appendLog(task.ID, "Analysed %s rendition for an average of %s, peaking at %s",
+		rendition.Resolution, rendition.Bitrate, domain.FormatBitrate(rendition.TwoPass.MaxRateKbps))
+
+	s.taskMutex.Lock()
+	task.encodeIndex++
+	s.taskMutex.Unlock()
+	return s.encodeRendition(ctx, task, rendition.Pass(2))
+}
+
+// removePassLogs deletes the files encoders wrote under a pass log prefix
+func removePassLogs(logFile string) {
+	files, err := filepath.Glob(logFile + "*")
+	if err != nil {
+		return
+	}
+	for _, file := range files {
+		if err := os.Remove(file); err != nil {
+			log.Printf("Failed to remove pass log %s: %v", file, err)
+		}
+	}
+}
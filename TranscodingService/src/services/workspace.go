@@ -0,0 +1,23 @@
+package services
+
+import (
+	"TranscodingService/src/domain"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// workspace is the scratch directory of a task, created on first use by whatever writes there
+func (s *transcodingServiceImpl) workspace(task *TranscodingTask) string {
+	return domain.JobWorkspace(task.Format, task.OutputFile, task.ID)
+}
+
+// removeWorkspace deletes a task's scratch directory, and their parent once no other job uses it
+func (s *transcodingServiceImpl) removeWorkspace(task *TranscodingTask) {
+	dir := s.workspace(task)
+	if err := os.RemoveAll(dir); err != nil {
+		log.Printf("Failed to remove workspace of job %s: %v", task.ID, err)
+		return
+	}
+	os.Remove(filepath.Dir(dir))
+}
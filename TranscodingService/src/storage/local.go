@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// localStorage keeps objects as files beneath a root directory
+type localStorage struct {
+	root string
+}
+
+// NewLocal creates a backend storing objects as files beneath root
+func NewLocal(root string) Storage {
+	return &localStorage{root: root}
+}
+
+// file maps a key to its path beneath the root
+func (l *localStorage) file(key string) (string, error) {
+	clean := path.Clean("/" + key)
+	if clean == "/" {
+		return "", fmt.Errorf("invalid object key %q", key)
+	}
+	return filepath.Join(l.root, filepath.FromSlash(clean)), nil
+}
+
+// Get opens the file stored at key
+func (l *localStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	file, err := l.file(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	return f, err
+}
+
+// Put writes body to the file at key, which is only replaced once the body has been written in full
+func (l *localStorage) Put(ctx context.Context, key string, body io.Reader, size int64) error {
+	file, err := l.file(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	return writeFile(file, body)
+}
+
+// Stat describes the file stored at key
+func (l *localStorage) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	file, err := l.file(key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	info, err := os.Stat(file)
+	if errors.Is(err, fs.ErrNotExist) || (err == nil && info.IsDir()) {
+		return ObjectInfo{}, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return ObjectInfo{Key: key, Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+// List walks the directory holding prefix for files whose keys start with it
+func (l *localStorage) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	dir := strings.TrimSuffix(prefix, "/")
+	if !strings.HasSuffix(prefix, "/") {
+		dir = path.Dir(prefix)
+	}
+	start := filepath.Join(l.root, filepath.FromSlash(path.Clean("/"+dir)))
+
+	var objects []ObjectInfo
+	err := filepath.WalkDir(start, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(l.root, file)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, ObjectInfo{Key: key, Size: info.Size(), ModTime: info.ModTime()})
+		return nil
+	})
+	return objects, err
+}
+
+// Delete removes the file stored at key
+func (l *localStorage) Delete(ctx context.Context, key string) error {
+	file, err := l.file(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(file); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/url"
+	"path"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3Options locates an S3-compatible service and the credentials to use with it
+type S3Options struct {
+	Endpoint        string // e.g. https://s3.amazonaws.com or http://localhost:9000
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+	PathStyle       bool // address buckets in the path, as most self-hosted services expect
+}
+
+// streamingContentTypes covers the outputs the standard MIME table does not know
+var streamingContentTypes = map[string]string{
+	".m3u8": "application/vnd.apple.mpegurl",
+	".mpd":  "application/dash+xml",
+	".ts":   "video/mp2t",
+	".m4s":  "video/iso.segment",
+	".vtt":  "text/vtt",
+}
+
+// s3Storage keeps objects in one bucket of an S3-compatible service
+type s3Storage struct {
+	client *minio.Client
+	bucket string
+}
+
+// newS3Client connects a client to the service the options describe
+func newS3Client(options S3Options) (*minio.Client, error) {
+	endpoint, err := url.Parse(options.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint %q", options.Endpoint)
+	}
+	lookup := minio.BucketLookupAuto
+	if options.PathStyle {
+		lookup = minio.BucketLookupPath
+	}
+	return minio.New(endpoint.Host, &minio.Options{
+		Creds:        credentials.NewStaticV4(options.AccessKeyID, options.SecretAccessKey, ""),
+		Secure:       endpoint.Scheme != "http",
+		Region:       options.Region,
+		BucketLookup: lookup,
+	})
+}
+
+// NewS3 creates a backend storing objects in bucket
+func NewS3(options S3Options, bucket string) (Storage, error) {
+	client, err := newS3Client(options)
+	if err != nil {
+		return nil, err
+	}
+	return &s3Storage{client: client, bucket: bucket}, nil
+}
+
+// Get streams the object stored at key
+func (s *s3Storage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	object, err := s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, s.translate(err, key)
+	}
+	// GetObject only sends the request on first use, so a missing object surfaces here
+	if _, err := object.Stat(); err != nil {
+		object.Close()
+		return nil, s.translate(err, key)
+	}
+	return object, nil
+}
+
+// Put uploads body to key, in parts when it is large or its size is not known
+func (s *s3Storage) Put(ctx context.Context, key string, body io.Reader, size int64) error {
+	_, err := s.client.PutObject(ctx, s.bucket, key, body, size, minio.PutObjectOptions{ContentType: contentType(key)})
+	return s.translate(err, key)
+}
+
+// Stat describes the object stored at key
+func (s *s3Storage) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	info, err := s.client.StatObject(ctx, s.bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return ObjectInfo{}, s.translate(err, key)
+	}
+	return ObjectInfo{Key: info.Key, Size: info.Size, ModTime: info.LastModified}, nil
+}
+
+// List returns the objects whose keys start with prefix, across every page of the listing
+func (s *s3Storage) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var objects []ObjectInfo
+	for info := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if info.Err != nil {
+			return nil, s.translate(info.Err, prefix)
+		}
+		objects = append(objects, ObjectInfo{Key: info.Key, Size: info.Size, ModTime: info.LastModified})
+	}
+	return objects, nil
+}
+
+// Delete removes the object stored at key
+func (s *s3Storage) Delete(ctx context.Context, key string) error {
+	return s.translate(s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{}), key)
+}
+
+// translate maps missing objects onto ErrNotFound and names the object in other errors
+func (s *s3Storage) translate(err error, key string) error {
+	if err == nil {
+		return nil
+	}
+	switch minio.ToErrorResponse(err).Code {
+	case "NoSuchKey", "NotFound":
+		return fmt.Errorf("%w: s3://%s/%s", ErrNotFound, s.bucket, key)
+	}
+	return fmt.Errorf("s3://%s/%s: %v", s.bucket, key, err)
+}
+
+// contentType picks the type players expect for an object from its extension
+func contentType(key string) string {
+	ext := path.Ext(key)
+	if contentType, ok := streamingContentTypes[ext]; ok {
+		return contentType
+	}
+	if contentType := mime.TypeByExtension(ext); contentType != "" {
+		return contentType
+	}
+	return "application/octet-stream"
+}
@@ -0,0 +1,203 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned when no object is stored at a key
+	ErrNotFound = errors.New("object not found")
+	// ErrUnsupportedScheme is returned for URIs naming a backend that is not configured
+	ErrUnsupportedScheme = errors.New("unsupported storage scheme")
+)
+
+// ObjectInfo describes a stored object
+type ObjectInfo struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// Storage streams objects stored under slash-separated keys
+type Storage interface {
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Put stores body at key, replacing any object there. size is -1 when it is not known in advance.
+	Put(ctx context.Context, key string, body io.Reader, size int64) error
+	Stat(ctx context.Context, key string) (ObjectInfo, error)
+	// List returns every object whose key starts with prefix
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+	// Delete removes the object at key. Deleting a missing object is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// URI locates an object, as s3://bucket/key or file:///path for the local filesystem
+type URI struct {
+	Scheme string
+	Bucket string // empty for file URIs
+	Key    string
+}
+
+// IsURI reports whether a location is a storage URI rather than a bare local path
+func IsURI(location string) bool {
+	return strings.Contains(location, "://")
+}
+
+// ParseURI parses an s3:// or file:// URI
+func ParseURI(raw string) (URI, error) {
+	scheme, rest, ok := strings.Cut(raw, "://")
+	if !ok {
+		return URI{}, fmt.Errorf("%s is not a storage URI", raw)
+	}
+	switch scheme {
+	case "file":
+		if !strings.HasPrefix(rest, "/") {
+			return URI{}, fmt.Errorf("file URI %s must hold an absolute path", raw)
+		}
+		return URI{Scheme: scheme, Key: strings.TrimPrefix(path.Clean(rest), "/")}, nil
+	case "s3":
+		bucket, key, _ := strings.Cut(rest, "/")
+		if bucket == "" || key == "" {
+			return URI{}, fmt.Errorf("s3 URI %s needs a bucket and a key", raw)
+		}
+		return URI{Scheme: scheme, Bucket: bucket, Key: path.Clean(key)}, nil
+	default:
+		return URI{}, fmt.Errorf("%w: %s", ErrUnsupportedScheme, scheme)
+	}
+}
+
+// String formats the URI
+func (u URI) String() string {
+	if u.Scheme == "file" {
+		return "file:///" + u.Key
+	}
+	return u.Scheme + "://" + u.Bucket + "/" + u.Key
+}
+
+// Path is the local filesystem path of a file URI
+func (u URI) Path() string {
+	return filepath.FromSlash("/" + u.Key)
+}
+
+// Base is the last element of the key
+func (u URI) Base() string {
+	return path.Base(u.Key)
+}
+
+// Sibling returns the URI of rel, a slash-separated path relative to the directory holding the key
+func (u URI) Sibling(rel string) URI {
+	u.Key = path.Join(path.Dir(u.Key), rel)
+	if u.Key == "." || u.Key == "/" {
+		u.Key = ""
+	}
+	return u
+}
+
+// Backends opens the local filesystem for file URIs and the configured S3-compatible service for s3 URIs
+type Backends struct {
+	local Storage
+	s3    func(bucket string) Storage
+}
+
+// NewBackends creates the backends, connecting to an S3-compatible service when options are given
+func NewBackends(s3 *S3Options) (*Backends, error) {
+	backends := &Backends{local: NewLocal("/")}
+	if s3 != nil {
+		client, err := newS3Client(*s3)
+		if err != nil {
+			return nil, err
+		}
+		backends.s3 = func(bucket string) Storage { return &s3Storage{client: client, bucket: bucket} }
+	}
+	return backends, nil
+}
+
+// Open returns the storage holding a URI's object, which is addressed by the URI's key
+func (b *Backends) Open(uri URI) (Storage, error) {
+	switch {
+	case uri.Scheme == "file":
+		return b.local, nil
+	case uri.Scheme == "s3" && b.s3 != nil:
+		return b.s3(uri.Bucket), nil
+	}
+	return nil, fmt.Errorf("%w: %s is not configured", ErrUnsupportedScheme, uri.Scheme)
+}
+
+// Download streams the object at key into file, which only appears once it is complete
+func Download(ctx context.Context, store Storage, key, file string) error {
+	body, err := store.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	return writeFile(file, body)
+}
+
+// UploadDir streams every file beneath dir to prefix and returns the number of files uploaded
+func UploadDir(ctx context.Context, store Storage, dir, prefix string) (int, error) {
+	uploaded := 0
+	err := filepath.WalkDir(dir, func(file string, entry os.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+		if err := uploadFile(ctx, store, file, path.Join(prefix, filepath.ToSlash(rel))); err != nil {
+			return err
+		}
+		uploaded++
+		return nil
+	})
+	return uploaded, err
+}
+
+// uploadFile streams one local file to key
+func uploadFile(ctx context.Context, store Storage, file, key string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if err := store.Put(ctx, key, f, info.Size()); err != nil {
+		return fmt.Errorf("failed to upload %s: %v", key, err)
+	}
+	return nil
+}
+
+// writeFile copies body into a temporary file beside file, then renames it into place
+func writeFile(file string, body io.Reader) error {
+	partial, err := os.CreateTemp(filepath.Dir(file), "."+filepath.Base(file)+".partial-*")
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(partial, body)
+	if closeErr := partial.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(partial.Name(), file)
+	}
+	if err != nil {
+		os.Remove(partial.Name())
+	}
+	return err
+}
@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseURI(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    URI
+		wantErr error
+	}{
+		{raw: "s3://video-uploads/in/movie.mp4", want: URI{Scheme: "s3", Bucket: "video-uploads", Key: "in/movie.mp4"}},
+		{raw: "s3://video-uploads/in//sub/./movie.mp4", want: URI{Scheme: "s3", Bucket: "video-uploads", Key: "in/sub/movie.mp4"}},
+		{raw: "file:///data/in/movie.mp4", want: URI{Scheme: "file", Key: "data/in/movie.mp4"}},
+		{raw: "file:///data/in/../out/movie.mp4", want: URI{Scheme: "file", Key: "data/out/movie.mp4"}},
+		{raw: "file:///../../etc/passwd", want: URI{Scheme: "file", Key: "etc/passwd"}},
+		{raw: "s3://video-uploads"},
+		{raw: "s3://video-uploads/"},
+		{raw: "s3:///in/movie.mp4"},
+		{raw: "file://data/in/movie.mp4"},
+		{raw: "/data/in/movie.mp4"},
+		{raw: "gs://bucket/movie.mp4", wantErr: ErrUnsupportedScheme},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			got, err := ParseURI(tt.raw)
+			if tt.want == (URI{}) {
+				if err == nil {
+					t.Fatalf("ParseURI() = %+v, want an error", got)
+				}
+				if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+					t.Fatalf("ParseURI() = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("ParseURI() = %+v, %v, want %+v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestURIString(t *testing.T) {
+	for _, raw := range []string{"s3://video-uploads/in/movie.mp4", "file:///data/in/movie.mp4"} {
+		uri, err := ParseURI(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := uri.String(); got != raw {
+			t.Errorf("String() = %s, want %s", got, raw)
+		}
+	}
+}
+
+func TestURISibling(t *testing.T) {
+	manifest := URI{Scheme: "s3", Bucket: "video-uploads", Key: "out/movie/hls/master.m3u8"}
+
+	tests := []struct {
+		name string
+		uri  URI
+		rel  string
+		want string
+	}{
+		{name: "file alongside", uri: manifest, rel: "720p/index.m3u8", want: "out/movie/hls/720p/index.m3u8"},
+		{name: "parent directory", uri: manifest, rel: "../trickplay/sprites.vtt", want: "out/movie/trickplay/sprites.vtt"},
+		{name: "own directory", uri: manifest, rel: ".", want: "out/movie/hls"},
+		{name: "directory of a top-level key", uri: URI{Scheme: "s3", Bucket: "video-uploads", Key: "movie.mp4"}, rel: ".", want: ""},
+		{name: "file URI", uri: URI{Scheme: "file", Key: "data/in/movie.mp4"}, rel: "movie.en.srt", want: "data/in/movie.en.srt"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.uri.Sibling(tt.rel)
+			if got.Key != tt.want || got.Scheme != tt.uri.Scheme || got.Bucket != tt.uri.Bucket {
+				t.Errorf("Sibling(%s) = %+v, want key %s in %s://%s", tt.rel, got, tt.want, tt.uri.Scheme, tt.uri.Bucket)
+			}
+		})
+	}
+}